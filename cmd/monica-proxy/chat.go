@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/service"
+	"monica-proxy/internal/utils"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// runChat 发送单次对话并把回复流式输出到标准输出；提示词取自命令参数，未给出时读取标准输入
+func runChat(args []string) error {
+	fs, flags := newFlagSet("chat")
+	model := fs.String("model", "gpt-4o", "使用的模型，可通过 models 命令查看")
+	system := fs.String("system", "", "系统提示词")
+	fs.Parse(args)
+	quietLogger()
+
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("读取标准输入失败: %w", err)
+		}
+		prompt = string(data)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return fmt.Errorf("提示词为空")
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	utils.InitHTTPClients(cfg)
+	holder := config.NewHolder(cfg, nil)
+
+	req := &openai.ChatCompletionRequest{Model: *model, Stream: true}
+	if *system != "" {
+		req.Messages = append(req.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: *system})
+	}
+	req.Messages = append(req.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt})
+
+	// Ctrl+C 时取消上游请求
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var result interface{}
+	if cfg.Monica.EnableCustomBotMode {
+		result, err = service.NewCustomBotService(holder).HandleCustomBotChat(ctx, req, cfg.Monica.BotUID)
+	} else {
+		result, err = service.NewChatService(holder).HandleChatCompletion(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	body, ok := result.(io.Reader)
+	if !ok {
+		return fmt.Errorf("上游返回了非流式响应")
+	}
+	if closer, ok := body.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	served := *model
+	if stream, ok := result.(*monica.ChatStream); ok && stream.Model != "" {
+		served = stream.Model
+	}
+	if served != *model {
+		fmt.Fprintf(os.Stderr, "已降级到备用模型: %s\n", served)
+	}
+
+	out := &deltaWriter{w: os.Stdout}
+	err = monica.StreamMonicaSSEToClientWithConfig(served, out, body, cfg)
+	fmt.Println()
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// deltaWriter 解析 OpenAI 格式的流式响应，只把增量文本写到终端
+type deltaWriter struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (d *deltaWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data := append(d.partial, p...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		if err := d.writeLine(data[:idx]); err != nil {
+			return 0, err
+		}
+		data = data[idx+1:]
+	}
+	d.partial = append(d.partial[:0], data...)
+	return len(p), nil
+}
+
+func (d *deltaWriter) writeLine(line []byte) error {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return nil
+	}
+	payload = bytes.TrimSpace(payload)
+	if string(payload) == "[DONE]" {
+		return nil
+	}
+
+	var chunk openai.ChatCompletionStreamResponse
+	if json.Unmarshal(payload, &chunk) != nil {
+		return nil
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content == "" {
+			continue
+		}
+		if _, err := io.WriteString(d.w, choice.Delta.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush 使 StreamMonicaSSEToClientWithConfig 定期刷新缓冲区，回复能及时显示
+func (d *deltaWriter) Flush() {}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+// quotaCheckTimeout 单个账号额度查询的超时时间
+const quotaCheckTimeout = 10 * time.Second
+
+// runCheckConfig 校验配置，并通过额度查询逐个检查账号 Cookie 是否可用；任一项失败时返回错误
+func runCheckConfig(args []string) error {
+	fs, flags := newFlagSet("check-config")
+	offline := fs.Bool("offline", false, "只校验配置，不检查账号 Cookie")
+	fs.Parse(args)
+	quietLogger()
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	if path := flags.filePath(); path != "" {
+		fmt.Printf("配置文件: %s\n", path)
+	}
+	fmt.Println("配置校验: 通过")
+	if *offline {
+		return nil
+	}
+
+	failed := 0
+	for i, cookie := range cfg.MonicaCookies() {
+		accountCfg := *cfg
+		accountCfg.Monica.Cookie = cookie
+
+		ctx, cancel := context.WithTimeout(context.Background(), quotaCheckTimeout)
+		quota, err := utils.GetMonicaQuotaContext(ctx, &accountCfg)
+		cancel()
+		if err != nil {
+			failed++
+			fmt.Printf("账号 %d: 不可用 (%v)\n", i, err)
+			continue
+		}
+		geniusBot, credits := planQuota(quota)
+		fmt.Printf("账号 %d: 可用 (genius_bot=%d, credits=%d)\n", i, geniusBot, credits)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个账号 Cookie 不可用", failed)
+	}
+	return nil
+}
+
+// runQuota 查询主账号的额度
+func runQuota(args []string) error {
+	fs, flags := newFlagSet("quota")
+	asJSON := fs.Bool("json", false, "输出原始 JSON 响应")
+	fs.Parse(args)
+	quietLogger()
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	quota, err := utils.GetMonicaQuota(cfg)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(quota)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tSCENE\tCURRENT\tDEFAULT\tRESET")
+	for _, module := range quota.Data.ModuleQuotas {
+		for _, q := range module.Quotas {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", module.Module, q.Scene, q.CurrentQuota, q.DefaultQuota, q.ResetFrequency)
+		}
+	}
+	return w.Flush()
+}
+
+// runModels 列出支持的模型，不需要配置
+func runModels(args []string) error {
+	fs := flag.NewFlagSet("models", flag.ExitOnError)
+	fs.Parse(args)
+
+	for _, model := range types.GetSupportedModels() {
+		fmt.Println(model)
+	}
+	return nil
+}
+
+// planQuota 返回套餐内 genius_bot 与 credits 的剩余额度
+func planQuota(quota *utils.MonicaQuotaResponse) (geniusBot, credits int) {
+	for _, module := range quota.Data.ModuleQuotas {
+		for _, q := range module.Quotas {
+			if q.Scene != "plan" {
+				continue
+			}
+			switch module.Module {
+			case "genius_bot":
+				geniusBot = q.CurrentQuota
+			case "credits":
+				credits = q.CurrentQuota
+			}
+		}
+	}
+	return geniusBot, credits
+}
+
+// runPrintEffectiveConfig 输出合并后的配置及每项的来源，敏感值脱敏；配置校验失败时仍然输出并返回错误
+func runPrintEffectiveConfig(args []string) error {
+	fs, flags := newFlagSet("print-effective-config")
+	showSecrets := fs.Bool("show-secrets", false, "输出敏感配置项的原文")
+	fs.Parse(args)
+
+	cfg, sources, err := config.Resolve(flags.options())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSOURCE\tVALUE")
+	for _, b := range config.Bindings() {
+		value := b.Value(cfg)
+		if b.Secret && value != "" && !*showSecrets {
+			value = redact.Secret(value)
+		}
+		// 按行分隔的列表转义后输出，保持表格每项一行
+		if strings.Contains(value, "\n") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", b.Path, sources[b.Path], value)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
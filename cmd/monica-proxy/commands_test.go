@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"monica-proxy/internal/utils"
+)
+
+func TestDeltaWriter(t *testing.T) {
+	chunk := func(content string) string {
+		return `data: {"choices":[{"index":0,"delta":{"content":"` + content + `"}}]}` + "\n\n"
+	}
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"content deltas", []string{chunk("你好"), chunk("，世界"), "data: [DONE]\n\n"}, "你好，世界"},
+		{"lines split across writes", []string{chunk("He")[:30], chunk("He")[30:], chunk("llo")}, "Hello"},
+		{"ignores non data and invalid lines", []string{": ping\n", "event: message\n", "data: oops\n", chunk("ok")}, "ok"},
+		{"unterminated line not written", []string{strings.TrimSuffix(chunk("late"), "\n\n")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			d := &deltaWriter{w: &out}
+			for _, w := range tt.writes {
+				if n, err := d.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write = %d, %v", n, err)
+				}
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanQuota(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantGeniusBot int
+		wantCredits   int
+	}{
+		{
+			name: "plan scene only",
+			body: `{"data":{"module_quotas":[
+				{"module":"genius_bot","quotas":[{"scene":"plan","current_quota":40},{"scene":"bonus","current_quota":5}]},
+				{"module":"credits","quotas":[{"scene":"plan","current_quota":300}]},
+				{"module":"image","quotas":[{"scene":"plan","current_quota":9}]}
+			]}}`,
+			wantGeniusBot: 40,
+			wantCredits:   300,
+		},
+		{"empty", `{"data":{}}`, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var quota utils.MonicaQuotaResponse
+			if err := json.Unmarshal([]byte(tt.body), &quota); err != nil {
+				t.Fatal(err)
+			}
+			geniusBot, credits := planQuota(&quota)
+			if geniusBot != tt.wantGeniusBot || credits != tt.wantCredits {
+				t.Errorf("planQuota = %d, %d, want %d, %d", geniusBot, credits, tt.wantGeniusBot, tt.wantCredits)
+			}
+		})
+	}
+}
+
+func TestConfigFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantFile string
+		wantPort string
+		wantArgs []string
+	}{
+		{"no flags", []string{"hello"}, "", "", []string{"hello"}},
+		{"config and setting", []string{"-config", "custom.yaml", "-server.port", "9000", "hi", "there"}, "custom.yaml", "9000", []string{"hi", "there"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, flags := newFlagSet("chat")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			opts := flags.options()
+			if opts.File != tt.wantFile || opts.Flags["server.port"] != tt.wantPort {
+				t.Errorf("options = %+v", opts)
+			}
+			if strings.Join(fs.Args(), " ") != strings.Join(tt.wantArgs, " ") {
+				t.Errorf("args = %v, want %v", fs.Args(), tt.wantArgs)
+			}
+			if tt.wantFile != "" && flags.filePath() != tt.wantFile {
+				t.Errorf("filePath = %q", flags.filePath())
+			}
+		})
+	}
+}
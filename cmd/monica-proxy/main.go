@@ -0,0 +1,112 @@
+// monica-proxy 无界面的服务端程序，与 Wails 版本共用 internal 包，适合部署在 Linux 服务器上。
+// 配置加载方式与 Wails 版本一致（配置文件、.env 与环境变量），也可以通过 -config 指定配置文件。
+//
+//	monica-proxy serve                          启动 API 服务，收到 SIGINT/SIGTERM 后优雅停机
+//	monica-proxy check-config                   校验配置并逐个检查账号 Cookie 是否可用
+//	monica-proxy quota                          查询主账号的剩余额度
+//	monica-proxy models                         列出支持的模型
+//	monica-proxy chat -model gpt-4o "你好"       单次对话，流式输出回复；未给出提示词时从标准输入读取
+//	monica-proxy print-effective-config         输出生效的配置及每项的来源
+//
+// 每个配置项都可以通过命令行参数设置（如 -server.port 8081），优先级：
+// 命令行参数 > 环境变量 > -config/CONFIG_FILE 指定的文件 > 自动查找的配置文件 > 默认值。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/logger"
+)
+
+// command 子命令
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "启动 API 服务", runServe},
+	{"check-config", "校验配置并检查账号 Cookie", runCheckConfig},
+	{"quota", "查询主账号剩余额度", runQuota},
+	{"models", "列出支持的模型", runModels},
+	{"chat", "单次对话并流式输出回复", runChat},
+	{"print-effective-config", "输出生效的配置及每项的来源", runPrintEffectiveConfig},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if name != "-h" && name != "-help" && name != "--help" && name != "help" {
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", name)
+	}
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法: monica-proxy <命令> [参数]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "命令:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "使用 monica-proxy <命令> -h 查看命令参数")
+}
+
+// configFlags 需要读取配置的子命令共用的参数：-config 与每个配置项对应的参数
+type configFlags struct {
+	path   *string
+	values config.FlagValues
+}
+
+// newFlagSet 创建子命令参数集，并注册配置相关的参数
+func newFlagSet(name string) (*flag.FlagSet, *configFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	flags := &configFlags{
+		path:   fs.String("config", "", "配置文件路径，优先于 CONFIG_FILE 和自动查找"),
+		values: config.RegisterFlags(fs),
+	}
+	return fs, flags
+}
+
+func (f *configFlags) options() config.Options {
+	return config.Options{File: *f.path, Flags: f.values}
+}
+
+// load 加载并校验配置，优先级：命令行参数 > 环境变量 > -config/CONFIG_FILE > 自动查找的文件 > 默认值
+func (f *configFlags) load() (*config.Config, error) {
+	return config.LoadWithOptions(f.options())
+}
+
+// filePath 返回使用的配置文件路径，未使用配置文件时为空
+func (f *configFlags) filePath() string {
+	if *f.path != "" {
+		return *f.path
+	}
+	return config.FilePath()
+}
+
+// quietLogger 非 serve 命令只把警告以上的日志输出到标准错误，避免干扰命令输出
+func quietLogger() {
+	logger.UpdateConfig("warn", "text", "stderr", true, logger.RotateConfig{})
+}
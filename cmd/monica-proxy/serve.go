@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"monica-proxy/internal/apiserver"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/filestore"
+	"monica-proxy/internal/logger"
+	customMiddleware "monica-proxy/internal/middleware"
+	"monica-proxy/internal/recorder"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/tracing"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
+	"monica-proxy/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.uber.org/zap"
+)
+
+// defaultLogFile 日志输出为 file 时使用的日志文件
+const defaultLogFile = "./logs/monica-proxy.log"
+
+// runServe 启动 API 服务，直到收到 SIGINT/SIGTERM 后排空进行中的请求再退出
+func runServe(args []string) error {
+	fs, flags := newFlagSet("serve")
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+
+	logOutput := cfg.Logging.Output
+	if logOutput == "file" {
+		logOutput = defaultLogFile
+	}
+	logger.UpdateConfig(cfg.Logging.Level, cfg.Logging.Format, logOutput, cfg.Logging.MaskSensitive, logger.RotateConfig{
+		MaxSizeMB:  cfg.Logging.MaxSizeMB,
+		Interval:   cfg.Logging.RotateInterval,
+		MaxAgeDays: cfg.Logging.MaxAgeDays,
+		MaxBackups: cfg.Logging.MaxBackups,
+		Compress:   cfg.Logging.Compress,
+	})
+
+	utils.InitHTTPClients(cfg)
+
+	shutdownTracing, err := tracing.Init(cfg)
+	if err != nil {
+		return fmt.Errorf("初始化链路追踪失败: %w", err)
+	}
+	if err := redact.Init(cfg); err != nil {
+		return fmt.Errorf("初始化脱敏规则失败: %w", err)
+	}
+	if err := recorder.Init(cfg); err != nil {
+		return fmt.Errorf("初始化流量录制失败: %w", err)
+	}
+	defer recorder.Close()
+	// 账本、文件存储和附件缓存的相对路径位于数据目录下，不随启动目录变化
+	dataCfg := cfg.WithDataPaths()
+	if err := usage.Init(dataCfg); err != nil {
+		return fmt.Errorf("打开用量账本失败: %w", err)
+	}
+	defer usage.Close()
+	if err := filestore.Init(dataCfg); err != nil {
+		return fmt.Errorf("打开文件存储失败: %w", err)
+	}
+	defer filestore.Close()
+	if err := types.InitAttachmentCache(dataCfg); err != nil {
+		return fmt.Errorf("打开附件缓存失败: %w", err)
+	}
+	defer types.CloseAttachmentCache()
+
+	holder, stopWatch := newConfigHolder(cfg, flags)
+	defer stopWatch()
+
+	e := echo.New()
+	e.Logger.SetOutput(os.Stderr)
+	e.HideBanner = true
+
+	e.Server.ReadTimeout = cfg.Server.ReadTimeout
+	e.Server.WriteTimeout = cfg.Server.WriteTimeout
+	e.Server.IdleTimeout = cfg.Server.IdleTimeout
+
+	e.Use(middleware.Recover())
+	e.Use(middleware.CORS())
+	e.Use(middleware.RequestID())
+	e.Use(customMiddleware.RateLimit(holder))
+
+	drainer := apiserver.RegisterRoutes(e, holder)
+
+	metrics := apiserver.NewMetricsServer(holder)
+	if metrics != nil {
+		go func() {
+			if err := metrics.Start(cfg.GetMetricsAddress()); err != nil && err != http.ErrServerClosed {
+				logger.Error("指标服务启动失败", zap.Error(err))
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("服务启动", zap.String("address", cfg.GetAddress()))
+		serveErr <- e.Start(cfg.GetAddress())
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("服务器启动失败: %w", err)
+		}
+	case sig := <-signals:
+		logger.Info("收到停止信号，开始优雅停机",
+			zap.String("signal", sig.String()),
+			zap.Duration("grace_period", cfg.Server.ShutdownGracePeriod),
+		)
+		stopWatch()
+		if err := drainer.Shutdown(e, cfg.Server.ShutdownGracePeriod); err != nil {
+			logger.Warn("服务停止异常", zap.Error(err))
+		}
+	}
+
+	if metrics != nil {
+		metrics.Close()
+	}
+	if shutdownTracing != nil {
+		// 刷新尚未导出的 span
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("关闭链路追踪失败", zap.Error(err))
+		}
+	}
+	logger.Info("服务已停止")
+	return nil
+}
+
+// newConfigHolder 创建运行中服务的配置持有者；使用配置文件时监听其变化自动重载，
+// 重载时命令行参数与环境变量仍然优先
+func newConfigHolder(cfg *config.Config, flags *configFlags) (*config.Holder, func()) {
+	path := flags.filePath()
+	holder := config.NewHolder(cfg, flags.load)
+	holder.OnChange(apiserver.ApplyConfigChange)
+	holder.OnChange(func(_, cfg *config.Config) {
+		cfg = cfg.WithDataPaths()
+		if err := usage.Init(cfg); err != nil {
+			logger.Error("重载用量账本失败", zap.Error(err))
+		}
+		if err := filestore.Init(cfg); err != nil {
+			logger.Error("重载文件存储失败", zap.Error(err))
+		}
+		if err := types.InitAttachmentCache(cfg); err != nil {
+			logger.Error("重载附件缓存失败", zap.Error(err))
+		}
+	})
+
+	if path == "" {
+		return holder, func() {}
+	}
+	stopWatch := holder.Watch(path, 2*time.Second, func(err error) {
+		if err != nil {
+			logger.Warn("配置文件已变化但重载失败，继续使用原配置", zap.String("path", path), zap.Error(err))
+		}
+	})
+	return holder, stopWatch
+}
@@ -0,0 +1,173 @@
+// monica-replay 将流量录制文件中的上游 SSE 离线回放到 StreamMonicaSSEToClientWithConfig，
+// 无需 Monica 账号即可复现解析问题。
+//
+//	monica-replay -file recordings.jsonl -id <request_id>   输出指定记录回放后的客户端 SSE
+//	monica-replay -file recordings.jsonl -check             回放全部记录并与录制时的输出比对
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/recorder"
+)
+
+var (
+	filePath = flag.String("file", "recordings.jsonl", "流量录制文件")
+	id       = flag.String("id", "", "只回放指定ID的记录")
+	index    = flag.Int("index", -1, "只回放第N条记录（从0开始）")
+	check    = flag.Bool("check", false, "与录制的客户端输出比对（忽略随机ID和时间戳），不一致时返回非零退出码")
+)
+
+func main() {
+	flag.Parse()
+
+	exchanges, err := load(*filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取录制文件失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	var selected []recorder.Exchange
+	for i, ex := range exchanges {
+		if (*id == "" || ex.ID == *id) && (*index < 0 || i == *index) {
+			selected = append(selected, ex)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Fprintln(os.Stderr, "没有匹配的录制记录")
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, ex := range selected {
+		if len(ex.UpstreamSSE) == 0 {
+			fmt.Fprintf(os.Stderr, "[%s] 跳过：没有录制上游SSE\n", ex.ID)
+			continue
+		}
+
+		output, err := replay(ex)
+		if !*check {
+			os.Stdout.Write(output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] 回放失败: %v\n", ex.ID, err)
+				failed++
+			}
+			continue
+		}
+
+		switch {
+		case err != nil:
+			fmt.Printf("FAIL %s: %v\n", ex.ID, err)
+			failed++
+		case ex.Truncated:
+			fmt.Printf("SKIP %s: 录制内容被截断\n", ex.ID)
+		case len(ex.ClientSSE) == 0:
+			fmt.Printf("SKIP %s: 没有录制客户端输出\n", ex.ID)
+		default:
+			if diff := compare(ex.ClientSSE, splitLines(output)); diff != "" {
+				fmt.Printf("FAIL %s: %s\n", ex.ID, diff)
+				failed++
+			} else {
+				fmt.Printf("ok   %s\n", ex.ID)
+			}
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// load 读取 JSONL 录制文件
+func load(path string) ([]recorder.Exchange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var exchanges []recorder.Exchange
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var ex recorder.Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges, scanner.Err()
+}
+
+// replay 将录制的上游SSE重新转换为客户端SSE
+func replay(ex recorder.Exchange) ([]byte, error) {
+	upstream := strings.NewReader(strings.Join(ex.UpstreamSSE, "\n") + "\n")
+	var out bytes.Buffer
+	err := monica.StreamMonicaSSEToClientWithConfig(servedModel(ex), &out, upstream, nil)
+	return out.Bytes(), err
+}
+
+// servedModel 录制时实际使用的模型（发生降级时与请求的模型不同），从客户端输出中读取
+func servedModel(ex recorder.Exchange) string {
+	for _, line := range ex.ClientSSE {
+		var chunk struct {
+			Model string `json:"model"`
+		}
+		if payload, ok := strings.CutPrefix(line, "data: "); ok && json.Unmarshal([]byte(payload), &chunk) == nil && chunk.Model != "" {
+			return chunk.Model
+		}
+	}
+	return ex.Model
+}
+
+// compare 比对两组SSE输出，返回第一处差异的描述
+func compare(recorded, replayed []string) string {
+	want, got := normalize(recorded), normalize(replayed)
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			return fmt.Sprintf("回放输出缺少第 %d 行: %s", i+1, want[i])
+		case i >= len(want):
+			return fmt.Sprintf("回放输出多出第 %d 行: %s", i+1, got[i])
+		case !reflect.DeepEqual(want[i], got[i]):
+			return fmt.Sprintf("第 %d 行不一致:\n  录制: %s\n  回放: %s", i+1, want[i], got[i])
+		}
+	}
+	return ""
+}
+
+// normalize 去掉空行，并移除每个数据块中随机生成的 id、created 和 system_fingerprint
+func normalize(lines []string) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		payload, ok := strings.CutPrefix(line, "data: ")
+		var chunk map[string]any
+		if ok && json.Unmarshal([]byte(payload), &chunk) == nil {
+			delete(chunk, "id")
+			delete(chunk, "created")
+			delete(chunk, "system_fingerprint")
+			normalized, _ := json.Marshal(chunk)
+			line = "data: " + string(normalized)
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+func splitLines(data []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
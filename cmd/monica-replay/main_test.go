@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"monica-proxy/internal/recorder"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded []string
+		replayed []string
+		want     string
+	}{
+		{
+			name:     "ignores ids, timestamps and blank lines",
+			recorded: []string{`data: {"id":"a","created":1,"model":"gpt-4o","system_fingerprint":"x"}`, "", "data: [DONE]"},
+			replayed: []string{`data: {"created":2,"id":"b","model":"gpt-4o"}`, "data: [DONE]"},
+		},
+		{
+			name:     "content differs",
+			recorded: []string{`data: {"model":"gpt-4o","text":"hi"}`},
+			replayed: []string{`data: {"model":"gpt-4o","text":"ho"}`},
+			want:     "第 1 行不一致",
+		},
+		{
+			name:     "missing line",
+			recorded: []string{`data: {"text":"hi"}`, "data: [DONE]"},
+			replayed: []string{`data: {"text":"hi"}`},
+			want:     "回放输出缺少第 2 行",
+		},
+		{
+			name:     "extra line",
+			recorded: []string{"data: [DONE]"},
+			replayed: []string{"data: [DONE]", "data: [DONE]"},
+			want:     "回放输出多出第 2 行",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compare(tt.recorded, tt.replayed)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("compare = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServedModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		client []string
+		want   string
+	}{
+		{"fallback model from output", []string{"", `data: {"model":"claude-3-5-sonnet"}`}, "claude-3-5-sonnet"},
+		{"requested model without output", nil, "gpt-4o"},
+		{"non json output", []string{"data: [DONE]"}, "gpt-4o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := recorder.Exchange{Model: "gpt-4o", ClientSSE: tt.client}
+			if got := servedModel(ex); got != tt.want {
+				t.Errorf("servedModel = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{"skips blank lines", `{"id":"a"}` + "\n\n" + `{"id":"b"}` + "\n", []string{"a", "b"}, ""},
+		{"reports bad line", `{"id":"a"}` + "\n" + "not json\n", nil, "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "recordings.jsonl")
+			os.WriteFile(path, []byte(tt.content), 0600)
+			got, err := load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			var ids []string
+			for _, ex := range got {
+				ids = append(ids, ex.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ids = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
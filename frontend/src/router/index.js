@@ -2,6 +2,7 @@ import { createRouter, createWebHistory } from 'vue-router'
 import MainConfig from '@/views/MainConfig.vue'
 import ServerConfig from '@/views/ServerConfig.vue'
 import LoggingConfig from '@/views/LoggingConfig.vue'
+import UsageStats from '@/views/UsageStats.vue'
 import Copyright from '@/views/Copyright.vue'
 
 const routes = [
@@ -9,6 +10,7 @@ const routes = [
   { path: '/main', name: 'MainConfig', component: MainConfig },
   { path: '/server', name: 'ServerConfig', component: ServerConfig },
   { path: '/logging', name: 'LoggingConfig', component: LoggingConfig },
+  { path: '/usage', name: 'UsageStats', component: UsageStats },
   { path: '/copyright', name: 'Copyright', component: Copyright }
 ]
 
@@ -14,6 +14,8 @@ export function GetQuota():Promise<main.QuotaInfo>;
 
 export function GetServiceStatus():Promise<main.ServiceStatus>;
 
+export function GetUsageChart(arg1:number):Promise<main.UsageChart>;
+
 export function OpenLogDirectory():Promise<void>;
 
 export function StartService():Promise<void>;
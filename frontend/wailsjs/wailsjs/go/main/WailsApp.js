@@ -26,6 +26,10 @@ export function GetServiceStatus() {
   return window['go']['main']['WailsApp']['GetServiceStatus']();
 }
 
+export function GetUsageChart(arg1) {
+  return window['go']['main']['WailsApp']['GetUsageChart'](arg1);
+}
+
 export function OpenLogDirectory() {
   return window['go']['main']['WailsApp']['OpenLogDirectory']();
 }
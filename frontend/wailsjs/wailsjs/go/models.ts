@@ -18,6 +18,8 @@ export namespace main {
 	}
 	export class ServiceStatus {
 	    isRunning: boolean;
+	    stopping: boolean;
+	    inFlight: number;
 	    message: string;
 	    address?: string;
 	    apiKey?: string;
@@ -29,11 +31,69 @@ export namespace main {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.isRunning = source["isRunning"];
+	        this.stopping = source["stopping"];
+	        this.inFlight = source["inFlight"];
 	        this.message = source["message"];
 	        this.address = source["address"];
 	        this.apiKey = source["apiKey"];
 	    }
 	}
+	export class UsageSeries {
+	    model: string;
+	    requests: number[];
+	    tokens: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new UsageSeries(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.model = source["model"];
+	        this.requests = source["requests"];
+	        this.tokens = source["tokens"];
+	    }
+	}
+	export class UsageChart {
+	    days: string[];
+	    series: UsageSeries[];
+	    totalRequests: number;
+	    totalTokens: number;
+	    totalCredits: number;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new UsageChart(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.days = source["days"];
+	        this.series = this.convertValues(source["series"], UsageSeries);
+	        this.totalRequests = source["totalRequests"];
+	        this.totalTokens = source["totalTokens"];
+	        this.totalCredits = source["totalCredits"];
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class WailsTestResult {
 	    endpoint: string;
 	    url: string;
@@ -0,0 +1,189 @@
+package apiserver
+
+import (
+	"context"
+	"io"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Drainer 跟踪进行中的请求，停机时拒绝新请求并等待已有的流式响应结束
+type Drainer struct {
+	inFlight atomic.Int64
+	streams  atomic.Int64
+	draining atomic.Bool
+
+	abort     chan struct{} // 宽限期结束时关闭，通知仍在进行的流终止
+	abortOnce sync.Once
+
+	ctx    context.Context // 后台任务的服务级上下文，请求排空后取消
+	cancel context.CancelFunc
+	tasks  sync.WaitGroup
+}
+
+// NewDrainer 创建请求排空器
+func NewDrainer() *Drainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Drainer{abort: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+// Go 在后台运行不属于任何请求的任务（如跟踪文件解析）。停机时在请求排空后取消 ctx，
+// 并等待任务退出，之后才关闭文件存储等全局组件
+func (d *Drainer) Go(task func(ctx context.Context)) {
+	d.tasks.Add(1)
+	go func() {
+		defer d.tasks.Done()
+		task(d.ctx)
+	}()
+}
+
+// Middleware 统计进行中的请求，排空期间直接拒绝新请求
+func (d *Drainer) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if d.draining.Load() {
+				c.Response().Header().Set(echo.HeaderConnection, "close")
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+			}
+
+			d.inFlight.Add(1)
+			defer d.inFlight.Add(-1)
+			return next(c)
+		}
+	}
+}
+
+// InFlight 返回进行中的请求数
+func (d *Drainer) InFlight() int64 {
+	return d.inFlight.Load()
+}
+
+// Streams 返回进行中的流式响应数
+func (d *Drainer) Streams() int64 {
+	return d.streams.Load()
+}
+
+// Draining 是否正在排空
+func (d *Drainer) Draining() bool {
+	return d.draining.Load()
+}
+
+// Aborted 宽限期结束后关闭的通道
+func (d *Drainer) Aborted() <-chan struct{} {
+	return d.abort
+}
+
+// aborted 宽限期是否已结束
+func (d *Drainer) aborted() bool {
+	select {
+	case <-d.abort:
+		return true
+	default:
+		return false
+	}
+}
+
+// trackStream 登记一个流式响应；宽限期结束时关闭上游响应体以中断阻塞的读取。
+// 返回的函数在流结束时调用
+func (d *Drainer) trackStream(upstream io.Closer) func() {
+	d.streams.Add(1)
+	metrics.InFlightStreams.Inc()
+	var mu sync.Mutex
+	finished := false
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-d.abort:
+			// 流已结束时不再关闭上游，避免与 done 同时就绪时误关
+			mu.Lock()
+			if !finished {
+				upstream.Close()
+			}
+			mu.Unlock()
+		case <-done:
+		}
+	}()
+	return func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		close(done)
+		d.streams.Add(-1)
+		metrics.InFlightStreams.Dec()
+	}
+}
+
+// Shutdown 优雅停机：停止接受新请求，在宽限期内等待进行中的请求完成；
+// 超时后通知剩余的流发送终止错误事件并关闭连接。最后取消后台任务并等待其退出
+func (d *Drainer) Shutdown(e *echo.Echo, grace time.Duration) error {
+	d.draining.Store(true)
+
+	logger.Info("开始优雅停机",
+		zap.Int64("in_flight", d.InFlight()),
+		zap.Int64("streams", d.Streams()),
+		zap.Duration("grace_period", grace),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	err := e.Shutdown(ctx)
+	if err != nil {
+		err = d.abortStreams(e)
+	}
+	d.stopTasks()
+	return err
+}
+
+// abortStreams 宽限期结束后终止剩余的流式响应并关闭服务
+func (d *Drainer) abortStreams(e *echo.Echo) error {
+	// 宽限期已过，通知剩余的流终止，并留出少量时间写出终止事件
+	logger.Warn("宽限期结束，终止剩余的流式响应",
+		zap.Int64("in_flight", d.InFlight()),
+		zap.Int64("streams", d.Streams()),
+	)
+	d.abortOnce.Do(func() { close(d.abort) })
+
+	deadline := time.After(5 * time.Second)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for d.InFlight() > 0 {
+		select {
+		case <-deadline:
+			break wait
+		case <-ticker.C:
+		}
+	}
+	return e.Close()
+}
+
+// stopTasks 取消后台任务的上下文，并等待任务退出
+func (d *Drainer) stopTasks() {
+	d.cancel()
+	done := make(chan struct{})
+	go func() {
+		d.tasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		logger.Warn("后台任务未能及时退出")
+	}
+}
+
+// writeShutdownEvent 向流式客户端写出停机终止事件
+func writeShutdownEvent(w http.ResponseWriter) {
+	io.WriteString(w, `data: {"error":{"message":"server is shutting down","type":"server_error","code":"server_shutdown"}}`+"\n\n")
+	io.WriteString(w, "data: [DONE]\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
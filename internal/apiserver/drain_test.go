@@ -0,0 +1,184 @@
+package apiserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestDrainerMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		draining bool
+		want     int
+	}{
+		{"serving", false, http.StatusOK},
+		{"draining rejects new requests", true, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDrainer()
+			d.draining.Store(tt.draining)
+			e := echo.New()
+			e.Use(d.Middleware())
+			var inFlight int64
+			e.GET("/", func(c echo.Context) error {
+				inFlight = d.InFlight()
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if !tt.draining && inFlight != 1 {
+				t.Errorf("in flight during request = %d, want 1", inFlight)
+			}
+			if tt.draining && rec.Header().Get(echo.HeaderConnection) != "close" {
+				t.Error("rejected response does not close the connection")
+			}
+			if d.InFlight() != 0 {
+				t.Errorf("in flight after request = %d", d.InFlight())
+			}
+		})
+	}
+}
+
+type closeRecorder struct{ closed atomic.Bool }
+
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestDrainerTrackStream(t *testing.T) {
+	d := NewDrainer()
+
+	finished := &closeRecorder{}
+	done := d.trackStream(finished)
+	if d.Streams() != 1 {
+		t.Fatalf("streams = %d, want 1", d.Streams())
+	}
+	done()
+	if d.Streams() != 0 {
+		t.Fatalf("streams after done = %d, want 0", d.Streams())
+	}
+
+	running := &closeRecorder{}
+	d.trackStream(running)
+	d.abortOnce.Do(func() { close(d.abort) })
+
+	deadline := time.Now().Add(time.Second)
+	for !running.closed.Load() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !running.closed.Load() {
+		t.Error("upstream of running stream not closed after abort")
+	}
+	if finished.closed.Load() {
+		t.Error("finished stream closed after abort")
+	}
+	if !d.aborted() {
+		t.Error("aborted() = false after abort")
+	}
+}
+
+// startTestServer 在随机端口启动带排空器的服务
+func startTestServer(t *testing.T, handler echo.HandlerFunc) (*echo.Echo, *Drainer, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Listener = ln
+	d := NewDrainer()
+	e.Use(d.Middleware())
+	e.GET("/", handler)
+	go e.Start("")
+	return e, d, "http://" + ln.Addr().String() + "/"
+}
+
+func TestDrainerShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		grace    time.Duration
+		wantBody string
+	}{
+		{"request finishes within grace period", 2 * time.Second, "finished"},
+		{"stream aborted after grace period", 50 * time.Millisecond, "server_shutdown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			var d *Drainer
+			e, d, url := startTestServer(t, func(c echo.Context) error {
+				c.Response().WriteHeader(http.StatusOK)
+				c.Response().Flush()
+				close(started)
+				select {
+				case <-time.After(200 * time.Millisecond):
+					io.WriteString(c.Response(), "finished")
+				case <-d.Aborted():
+					writeShutdownEvent(c.Response())
+				}
+				return nil
+			})
+
+			body := make(chan string, 1)
+			go func() {
+				resp, err := http.Get(url)
+				if err != nil {
+					body <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+				data, _ := io.ReadAll(resp.Body)
+				body <- string(data)
+			}()
+			<-started
+
+			if err := d.Shutdown(e, tt.grace); err != nil {
+				t.Errorf("Shutdown: %v", err)
+			}
+			if got := <-body; !strings.Contains(got, tt.wantBody) {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if !d.Draining() {
+				t.Error("not draining after Shutdown")
+			}
+		})
+	}
+}
+
+func TestDrainerShutdownStopsTasks(t *testing.T) {
+	e, d, _ := startTestServer(t, func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	var stopped atomic.Bool
+	d.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond) // 模拟退出前的收尾工作
+		stopped.Store(true)
+	})
+
+	if err := d.Shutdown(e, time.Second); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	// Shutdown 返回后才会关闭文件存储，此时后台任务必须已经退出
+	if !stopped.Load() {
+		t.Error("Shutdown returned before background task exited")
+	}
+}
@@ -0,0 +1,226 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// quotaProbeTTL 额度探测结果的缓存时间，过期后在后台刷新
+	quotaProbeTTL = 60 * time.Second
+	// quotaProbeTimeout 单次额度探测的超时时间
+	quotaProbeTimeout = 5 * time.Second
+)
+
+// 检查项状态
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+// healthCheck 单个检查项的结果
+type healthCheck struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// accountHealth 单个上游账号的健康状态
+type accountHealth struct {
+	Account   int                  `json:"account"`
+	Healthy   bool                 `json:"healthy"`
+	Error     string               `json:"error,omitempty"`
+	CheckedAt time.Time            `json:"checked_at"`
+	Breaker   monica.BreakerStatus `json:"breaker"`
+}
+
+// quotaProbe 账号额度探测的缓存结果
+type quotaProbe struct {
+	checkedAt  time.Time
+	err        error
+	refreshing bool
+	ready      chan struct{} // 首次探测完成时关闭
+}
+
+// healthChecker 就绪检查，通过缓存的额度查询判断账号Cookie是否可用，避免每次检查都请求上游
+type healthChecker struct {
+	holder *config.Holder
+	quota  func(ctx context.Context, cfg *config.Config) error // 额度查询，测试时替换
+
+	mu     sync.Mutex
+	probes map[uint64]*quotaProbe // cookie 哈希 -> 探测结果
+}
+
+func newHealthChecker(holder *config.Holder) *healthChecker {
+	return &healthChecker{
+		holder: holder,
+		quota: func(ctx context.Context, cfg *config.Config) error {
+			_, err := utils.GetMonicaQuotaContext(ctx, cfg)
+			return err
+		},
+		probes: make(map[uint64]*quotaProbe),
+	}
+}
+
+// createHealthzHandler 存活检查，进程能处理请求即返回成功
+// GET /healthz
+func createHealthzHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// createReadyzHandler 就绪检查，返回各检查项明细，任一项失败时返回 503
+// GET /readyz
+func createReadyzHandler(checker *healthChecker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		checks := checker.check(c.Request().Context())
+
+		status, code := "ready", http.StatusOK
+		for _, check := range checks {
+			if check.Status != checkOK {
+				status, code = "not_ready", http.StatusServiceUnavailable
+				break
+			}
+		}
+		return c.JSON(code, map[string]interface{}{
+			"status": status,
+			"checks": checks,
+		})
+	}
+}
+
+// check 执行全部就绪检查项
+func (h *healthChecker) check(ctx context.Context) map[string]healthCheck {
+	cfg := h.holder.Get()
+	checks := make(map[string]healthCheck, 4)
+
+	// Validate 会规范化部分字段，对副本校验，避免与读取运行中配置的请求竞争
+	snapshot := *cfg
+	checks["config"] = healthCheck{Status: checkOK}
+	if err := snapshot.Validate(); err != nil {
+		checks["config"] = healthCheck{Status: checkFail, Message: err.Error()}
+	}
+
+	checks["http_clients"] = healthCheck{Status: checkOK}
+	if utils.RestySSEClient() == nil || utils.RestyDefaultClient() == nil {
+		checks["http_clients"] = healthCheck{Status: checkFail, Message: "HTTP客户端未初始化"}
+	}
+
+	accounts := h.accounts(ctx, cfg)
+	healthy, open := 0, 0
+	for _, a := range accounts {
+		if a.Healthy {
+			healthy++
+		}
+		// 半开的账号会放行下一个请求，仍视为可用
+		if a.Breaker.State == monica.BreakerOpen {
+			open++
+		}
+	}
+
+	cookies := healthCheck{Status: checkOK, Message: fmt.Sprintf("%d/%d 个账号可用", healthy, len(accounts)), Details: accounts}
+	if healthy == 0 {
+		cookies.Status = checkFail
+	}
+	checks["cookies"] = cookies
+
+	// 只有全部账号熔断时才不就绪，单个备用账号失效不影响其他账号提供服务
+	breakers := healthCheck{Status: checkOK}
+	if open > 0 {
+		breakers.Message = fmt.Sprintf("%d 个账号处于熔断状态", open)
+		if open == len(accounts) {
+			breakers.Status = checkFail
+		}
+	}
+	checks["breakers"] = breakers
+
+	return checks
+}
+
+// accounts 返回所有账号的健康状态：首次检查时同步等待探测（包括其他请求发起的首次探测），
+// 结果过期后先返回缓存并在后台刷新
+func (h *healthChecker) accounts(ctx context.Context, cfg *config.Config) []accountHealth {
+	cookies := cfg.MonicaCookies()
+
+	var pending []*quotaProbe
+	for _, cookie := range cookies {
+		key := xxhash.Sum64String(cookie)
+		h.mu.Lock()
+		probe, ok := h.probes[key]
+		if !ok {
+			probe = &quotaProbe{refreshing: true, ready: make(chan struct{})}
+			h.probes[key] = probe
+		}
+		stale := ok && !probe.refreshing && time.Since(probe.checkedAt) > quotaProbeTTL
+		if stale {
+			probe.refreshing = true
+		}
+		if probe.checkedAt.IsZero() {
+			pending = append(pending, probe)
+		}
+		h.mu.Unlock()
+
+		// 探测结果被其他检查共享，不随当前请求取消
+		if !ok || stale {
+			go h.probe(context.WithoutCancel(ctx), cfg, cookie, probe)
+		}
+	}
+	for _, probe := range pending {
+		select {
+		case <-probe.ready:
+		case <-ctx.Done():
+		}
+	}
+
+	accounts := make([]accountHealth, 0, len(cookies))
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, cookie := range cookies {
+		probe := h.probes[xxhash.Sum64String(cookie)]
+		a := accountHealth{
+			Account:   i,
+			Healthy:   probe.err == nil && !probe.checkedAt.IsZero(),
+			CheckedAt: probe.checkedAt,
+			Breaker:   monica.AccountBreaker(cookie),
+		}
+		if probe.err != nil {
+			a.Error = probe.err.Error()
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts
+}
+
+// probe 使用指定账号查询额度，并更新缓存结果
+func (h *healthChecker) probe(ctx context.Context, cfg *config.Config, cookie string, probe *quotaProbe) {
+	ctx, cancel := context.WithTimeout(ctx, quotaProbeTimeout)
+	defer cancel()
+
+	probeCfg := *cfg
+	probeCfg.Monica.Cookie = cookie
+	err := h.quota(ctx, &probeCfg)
+	if err == nil {
+		// 实例不就绪时没有对话流量，由探测关闭半开的熔断器
+		monica.AccountProbeSucceeded(cookie)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	first := probe.checkedAt.IsZero()
+	probe.checkedAt = time.Now()
+	probe.err = err
+	probe.refreshing = false
+	if first {
+		close(probe.ready)
+	}
+}
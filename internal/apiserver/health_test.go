@@ -0,0 +1,146 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// testHealthChecker 创建使用给定额度查询结果的就绪检查，每次调用使用新的 Cookie，避免共享全局熔断器
+func testHealthChecker(t *testing.T, quota func(cookie string) error) (*healthChecker, *config.Config) {
+	t.Helper()
+	suffix := fmt.Sprintf("-%s-%d", t.Name(), time.Now().UnixNano())
+	cfg := config.GetDefaultConfig()
+	cfg.Monica.Cookie = "primary" + suffix
+	cfg.Monica.BackupCookies = []string{"backup" + suffix}
+	cfg.Security.BearerToken = "token"
+	utils.InitHTTPClients(cfg)
+
+	h := newHealthChecker(config.NewHolder(cfg, nil))
+	h.quota = func(ctx context.Context, cfg *config.Config) error {
+		return quota(cfg.Monica.Cookie[:len(cfg.Monica.Cookie)-len(suffix)])
+	}
+	return h, cfg
+}
+
+// readyz 请求就绪检查，返回状态码和 breakers 检查项
+func readyz(t *testing.T, h *healthChecker) (int, healthCheck) {
+	t.Helper()
+	e := echo.New()
+	e.GET("/readyz", createReadyzHandler(h))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body struct {
+		Checks map[string]healthCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return rec.Code, body.Checks["breakers"]
+}
+
+// openBreaker 通过连续失败的对话请求让账号熔断
+func openBreaker(t *testing.T, cfg *config.Config, cookie string) {
+	t.Helper()
+	accountCfg := *cfg
+	accountCfg.Monica.Cookie = cookie
+	accountCfg.Monica.BackupCookies = nil
+	accountCfg.HTTPClient.RetryCount = 0
+	fail := func(ctx context.Context, attempt monica.ChatAttempt) (*resty.Response, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	for monica.AccountBreaker(cookie).State != monica.BreakerOpen {
+		if _, err := monica.OpenChatStream(context.Background(), &accountCfg, "gpt-4o", false, fail); err == nil {
+			t.Fatal("failing request succeeded")
+		}
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	failing := fmt.Errorf("cookie expired")
+	tests := []struct {
+		name       string
+		failed     map[string]bool // 额度查询失败的账号
+		open       []string        // 熔断的账号
+		want       int
+		wantBroken string
+	}{
+		{"all healthy", nil, nil, http.StatusOK, ""},
+		{"backup cookie expired", map[string]bool{"backup": true}, nil, http.StatusOK, ""},
+		{"all cookies expired", map[string]bool{"primary": true, "backup": true}, nil, http.StatusServiceUnavailable, ""},
+		{"backup breaker open", nil, []string{"backup"}, http.StatusOK, "1 个账号处于熔断状态"},
+		{"all breakers open", nil, []string{"primary", "backup"}, http.StatusServiceUnavailable, "2 个账号处于熔断状态"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, cfg := testHealthChecker(t, func(cookie string) error {
+				if tt.failed[cookie] {
+					return failing
+				}
+				return nil
+			})
+			cookies := map[string]string{"primary": cfg.Monica.Cookie, "backup": cfg.Monica.BackupCookies[0]}
+			for _, name := range tt.open {
+				openBreaker(t, cfg, cookies[name])
+			}
+
+			code, breakers := readyz(t, h)
+			if code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+			if breakers.Message != tt.wantBroken {
+				t.Errorf("breakers = %+v, want message %q", breakers, tt.wantBroken)
+			}
+		})
+	}
+}
+
+func TestReadyzConcurrentFirstProbe(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	h, _ := testHealthChecker(t, func(cookie string) error {
+		calls.Add(1)
+		<-release
+		return nil
+	})
+
+	// 两个检查同时到达：第二个等待第一个发起的探测，而不是把未完成的探测当作失败
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i], _ = readyz(t, h)
+		}()
+	}
+	for calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("check %d status = %d, want 200", i, code)
+		}
+	}
+	// 每个账号只探测一次
+	if got := calls.Load(); got != 2 {
+		t.Errorf("quota calls = %d, want 2", got)
+	}
+}
@@ -0,0 +1,79 @@
+package apiserver
+
+import (
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/recorder"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// createConfigReloadHandler 创建配置重载处理器，新配置校验失败时继续使用原配置
+// POST /admin/config/reload
+func createConfigReloadHandler(holder *config.Holder) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		old := holder.Get()
+		cfg, err := holder.Reload()
+		if err != nil {
+			return errors.NewUnprocessableError("配置重载失败，继续使用原配置: "+err.Error(), err)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"status":           "reloaded",
+			"restart_required": RestartRequired(old, cfg),
+		})
+	}
+}
+
+// ApplyConfigChange 将重载后的配置应用到全局组件（HTTP客户端与 URL 下载器、日志级别、脱敏规则、流量录制），
+// 用于注册到 config.Holder.OnChange
+func ApplyConfigChange(old, cfg *config.Config) {
+	if !reflect.DeepEqual(old.HTTPClient, cfg.HTTPClient) || !reflect.DeepEqual(old.Proxy, cfg.Proxy) ||
+		!reflect.DeepEqual(old.URLFetch, cfg.URLFetch) || old.Security.TLSSkipVerify != cfg.Security.TLSSkipVerify {
+		utils.InitHTTPClients(cfg)
+	}
+	if old.Logging.Level != cfg.Logging.Level {
+		logger.SetLevel(cfg.Logging.Level)
+	}
+	if err := redact.Init(cfg); err != nil {
+		logger.Error("重载脱敏规则失败", zap.Error(err))
+	}
+	if !reflect.DeepEqual(old.Recorder, cfg.Recorder) {
+		if err := recorder.Init(cfg); err != nil {
+			logger.Error("重载流量录制失败", zap.Error(err))
+		}
+	}
+
+	fields := []zap.Field{}
+	if restart := RestartRequired(old, cfg); len(restart) > 0 {
+		fields = append(fields, zap.Strings("restart_required", restart))
+	}
+	logger.Info("配置已重载", fields...)
+}
+
+// RestartRequired 返回发生变化但需要重启服务才能生效的配置项
+func RestartRequired(old, cfg *config.Config) []string {
+	var fields []string
+	if old.Server != cfg.Server {
+		fields = append(fields, "server")
+	}
+	// 指标令牌在每个请求时读取，修改后立即生效
+	if old.Metrics.Enabled != cfg.Metrics.Enabled || old.Metrics.Port != cfg.Metrics.Port {
+		fields = append(fields, "metrics")
+	}
+	if old.Tracing != cfg.Tracing {
+		fields = append(fields, "tracing")
+	}
+	if old.Logging.Format != cfg.Logging.Format || old.Logging.Output != cfg.Logging.Output ||
+		old.Logging.MaxSizeMB != cfg.Logging.MaxSizeMB || old.Logging.RotateInterval != cfg.Logging.RotateInterval ||
+		old.Logging.MaxAgeDays != cfg.Logging.MaxAgeDays ||
+		old.Logging.MaxBackups != cfg.Logging.MaxBackups || old.Logging.Compress != cfg.Logging.Compress {
+		fields = append(fields, "logging")
+	}
+	return fields
+}
@@ -0,0 +1,93 @@
+package apiserver
+
+import (
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRestartRequired(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *config.Config)
+		want   []string
+	}{
+		{"no change", func(cfg *config.Config) {}, nil},
+		{"server port", func(cfg *config.Config) { cfg.Server.Port++ }, []string{"server"}},
+		{"metrics", func(cfg *config.Config) { cfg.Metrics.Enabled = !cfg.Metrics.Enabled }, []string{"metrics"}},
+		{"tracing", func(cfg *config.Config) { cfg.Tracing.SampleRatio = 0.5 }, []string{"tracing"}},
+		{"log format", func(cfg *config.Config) { cfg.Logging.Format = "console" }, []string{"logging"}},
+		// 以下配置在重载时直接生效
+		{"log level", func(cfg *config.Config) { cfg.Logging.Level = "debug" }, nil},
+		{"http client", func(cfg *config.Config) { cfg.HTTPClient.Timeout = time.Minute }, nil},
+		{"usage path", func(cfg *config.Config) { cfg.Usage.DBPath = "other.db" }, nil},
+		{"metrics token", func(cfg *config.Config) { cfg.Metrics.BearerToken = "rotated" }, nil},
+		{"bearer token", func(cfg *config.Config) { cfg.Security.BearerToken = "rotated" }, nil},
+		{"admin token", func(cfg *config.Config) { cfg.Security.AdminToken = "rotated" }, nil},
+		{"several", func(cfg *config.Config) {
+			cfg.Server.Port++
+			cfg.Logging.MaxBackups++
+		}, []string{"server", "logging"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := config.GetDefaultConfig()
+			cfg := config.GetDefaultConfig()
+			tt.change(cfg)
+			if got := RestartRequired(old, cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RestartRequired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigReloadHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   func() (*config.Config, error)
+		want     int
+		wantBody string
+	}{
+		{"valid config", func() (*config.Config, error) {
+			cfg := config.GetDefaultConfig()
+			cfg.Monica.Cookie, cfg.Security.BearerToken = "cookie", "token"
+			return cfg, nil
+		}, http.StatusOK, "reloaded"},
+		{"validation error", func() (*config.Config, error) {
+			return config.GetDefaultConfig(), nil
+		}, http.StatusUnprocessableEntity, "MONICA_COOKIE is required"},
+		{"unreadable file", func() (*config.Config, error) {
+			return nil, fmt.Errorf("yaml: line 3: did not find expected key")
+		}, http.StatusUnprocessableEntity, "line 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.GetDefaultConfig()
+			cfg.Monica.Cookie, cfg.Security.BearerToken = "cookie", "token"
+			holder := config.NewHolder(cfg, tt.source)
+
+			e := echo.New()
+			e.HTTPErrorHandler = middleware.ErrorHandler()
+			e.POST("/admin/config/reload", createConfigReloadHandler(holder))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/config/reload", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if tt.want != http.StatusOK && holder.Get() != cfg {
+				t.Error("failed reload replaced the running config")
+			}
+		})
+	}
+}
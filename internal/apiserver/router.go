@@ -1,68 +1,154 @@
 package apiserver
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"mime"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
+	"monica-proxy/internal/filestore"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
 	"monica-proxy/internal/middleware"
 	"monica-proxy/internal/monica"
+	"monica-proxy/internal/recorder"
 	"monica-proxy/internal/service"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
-// RegisterRoutes 注册 Echo 路由
-func RegisterRoutes(e *echo.Echo, cfg *config.Config) {
+// fallbackHeader 发生模型降级时返回实际服务的模型
+const fallbackHeader = "x-monica-proxy-fallback"
+
+// multipartMemory 文件上传时在内存中保存的最大字节数
+const multipartMemory = 1 << 20
+
+// RegisterRoutes 注册 Echo 路由，返回用于优雅停机的请求排空器
+func RegisterRoutes(e *echo.Echo, holder *config.Holder) *Drainer {
+	cfg := holder.Get()
+
 	// 设置自定义错误处理器
 	e.HTTPErrorHandler = middleware.ErrorHandler()
 
 	// 添加中间件
-	e.Use(middleware.BearerAuth(cfg))
-	e.Use(middleware.RequestLogger(cfg))
+	metrics.SetModels(types.GetSupportedModels())
+	e.Use(middleware.Metrics())
+	e.Use(middleware.Tracing())
+	drainer := NewDrainer()
+	e.Use(drainer.Middleware())
+	e.Use(middleware.BearerAuth(holder))
+	e.Use(middleware.RequestLogger(holder))
+
+	// Prometheus 指标，未配置独立端口时与 API 共用端口
+	if cfg.Metrics.Enabled && cfg.Metrics.Port == 0 {
+		e.GET("/metrics", echo.WrapHandler(metrics.Handler()), middleware.TokenAuth(func() string {
+			cfg := holder.Get()
+			if cfg.Metrics.BearerToken != "" {
+				return cfg.Metrics.BearerToken
+			}
+			return cfg.Security.BearerToken
+		}))
+	}
+
+	// 健康检查，供负载均衡与编排系统探测，无需认证
+	e.GET("/healthz", createHealthzHandler())
+	e.GET("/readyz", createReadyzHandler(newHealthChecker(holder)))
 
 	// 初始化服务实例
-	chatService := service.NewChatService(cfg)
-	modelService := service.NewModelService(cfg)
-	imageService := service.NewImageService(cfg)
-	customBotService := service.NewCustomBotService(cfg)
-	fileService := service.NewFileService(cfg)
+	chatService := service.NewChatService(holder)
+	modelService := service.NewModelService(holder)
+	imageService := service.NewImageService(holder)
+	customBotService := service.NewCustomBotService(holder)
+	fileService := service.NewFileService(holder, drainer)
+	uploadService := service.NewUploadService(holder, drainer)
 
 	// ChatGPT 风格的请求转发到 /v1/chat/completions
-	e.POST("/v1/chat/completions", createChatCompletionHandler(chatService, customBotService, cfg))
+	e.POST("/v1/chat/completions", createChatCompletionHandler(chatService, customBotService, drainer, holder), middleware.Usage(holder), middleware.Recorder())
 	// 获取支持的模型列表
 	e.GET("/v1/models", createListModelsHandler(modelService))
 	// DALL-E 风格的图片生成请求
-	e.POST("/v1/images/generations", createImageGenerationHandler(imageService))
+	e.POST("/v1/images/generations", createImageGenerationHandler(imageService), middleware.Usage(holder))
 
 	// OpenAI兼容的文件管理API
 	e.POST("/v1/files", createFileUploadHandler(fileService))
 	e.GET("/v1/files/:file_id", createGetFileHandler(fileService))
+	e.GET("/v1/files/:file_id/content", createFileContentHandler(fileService))
 	e.GET("/v1/files", createListFilesHandler(fileService))
 	e.DELETE("/v1/files/:file_id", createDeleteFileHandler(fileService))
 
+	// OpenAI兼容的分片上传API，用于大文件
+	e.POST("/v1/uploads", createUploadHandler(uploadService))
+	e.GET("/v1/uploads/:upload_id", createGetUploadHandler(uploadService))
+	e.POST("/v1/uploads/:upload_id/parts", createUploadPartHandler(uploadService))
+	e.POST("/v1/uploads/:upload_id/complete", createCompleteUploadHandler(uploadService))
+	e.POST("/v1/uploads/:upload_id/cancel", createCancelUploadHandler(uploadService))
+
 	// Custom Bot 测试接口
-	e.POST("/v1/chat/custom-bot/:bot_uid", createCustomBotHandler(customBotService, cfg))
+	e.POST("/v1/chat/custom-bot/:bot_uid", createCustomBotHandler(customBotService, drainer, holder), middleware.Usage(holder), middleware.Recorder())
 	// 新增不带bot_uid的路由，使用环境变量中的BOT_UID
-	e.POST("/v1/chat/custom-bot", createCustomBotHandler(customBotService, cfg))
+	e.POST("/v1/chat/custom-bot", createCustomBotHandler(customBotService, drainer, holder), middleware.Usage(holder), middleware.Recorder())
+
+	// 管理接口使用独立的管理令牌，未配置时不开放
+	admin := e.Group("/admin", middleware.AdminAuth(func() string {
+		return holder.Get().Security.AdminToken
+	}))
+
+	// 用量统计
+	admin.GET("/usage", createUsageReportHandler())
+	admin.GET("/usage/records", createUsageRecordsHandler())
+
+	// 附件缓存统计
+	admin.GET("/cache", createAttachmentCacheHandler())
+
+	// 配置热重载
+	admin.POST("/config/reload", createConfigReloadHandler(holder))
+
+	return drainer
+}
+
+// NewMetricsServer 创建独立端口的指标服务，未启用或与 API 共用端口时返回 nil
+func NewMetricsServer(holder *config.Holder) *echo.Echo {
+	cfg := holder.Get()
+	if !cfg.Metrics.Enabled || cfg.Metrics.Port == 0 {
+		return nil
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = middleware.ErrorHandler()
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()), middleware.TokenAuth(func() string {
+		return holder.Get().Metrics.BearerToken
+	}))
+	return e
 }
 
 // createChatCompletionHandler 创建聊天完成处理器
-func createChatCompletionHandler(chatService service.ChatService, customBotService service.CustomBotService, cfg *config.Config) echo.HandlerFunc {
+func createChatCompletionHandler(chatService service.ChatService, customBotService service.CustomBotService, drainer *Drainer, holder *config.Holder) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		cfg := holder.Get()
 		var req openai.ChatCompletionRequest
-		if err := c.Bind(&req); err != nil {
+		ctx, err := bindChatRequest(c, &req)
+		if err != nil {
 			return errors.NewBadRequestError("无效的请求数据", err)
 		}
+		c.Set(metrics.ModelContextKey, req.Model)
 
-		ctx := c.Request().Context()
+		rec := recorder.FromContext(ctx)
+		rec.SetRequest(req.Model, req.Stream, req)
+		usage.FromContext(ctx).SetChatRequest(&req)
 		var result interface{}
-		var err error
 
 		// 检查是否启用了 Custom Bot 模式
 		if cfg.Monica.EnableCustomBotMode {
@@ -77,6 +163,12 @@ func createChatCompletionHandler(chatService service.ChatService, customBotServi
 			return err
 		}
 
+		// 降级到备用模型时通过响应头告知客户端
+		model := servedModel(result, req.Model)
+		if model != req.Model {
+			c.Response().Header().Set(fallbackHeader, model)
+		}
+
 		// 根据请求参数决定响应方式
 		if req.Stream {
 			// 对于流式请求，result是一个io.ReadCloser
@@ -89,6 +181,8 @@ func createChatCompletionHandler(chatService service.ChatService, customBotServi
 			closer, isCloser := rawBody.(io.Closer)
 			if isCloser {
 				defer closer.Close()
+				// 登记到排空器，停机宽限期结束时中断上游读取
+				defer drainer.trackStream(closer)()
 			}
 
 			// 设置响应头
@@ -98,17 +192,39 @@ func createChatCompletionHandler(chatService service.ChatService, customBotServi
 			c.Response().WriteHeader(http.StatusOK)
 
 			// 流式处理响应（带配置参数）
-			if err := monica.StreamMonicaSSEToClientWithConfig(req.Model, c.Response().Writer, rawBody, cfg); err != nil {
+			_, span := tracing.Start(ctx, "sse.relay",
+				attribute.String("gen_ai.response.model", model),
+				attribute.Bool("stream", true),
+			)
+			err := monica.StreamMonicaSSEToClientWithConfig(model, rec.TeeClient(c.Response().Writer), rawBody, cfg)
+			tracing.End(span, err)
+			if err != nil {
+				if drainer.aborted() {
+					writeShutdownEvent(c.Response())
+					return nil
+				}
 				return errors.NewInternalError(err)
 			}
 			return nil
 		} else {
 			// 对于非流式请求，直接返回JSON响应
+			rec.SetResponse(result)
 			return c.JSON(http.StatusOK, result)
 		}
 	}
 }
 
+// servedModel 获取实际提供服务的模型，未发生降级时返回请求的模型
+func servedModel(result interface{}, requested string) string {
+	switch r := result.(type) {
+	case *monica.ChatStream:
+		return r.Model
+	case *openai.ChatCompletionResponse:
+		return r.Model
+	}
+	return requested
+}
+
 // createListModelsHandler 创建模型列表处理器
 func createListModelsHandler(modelService service.ModelService) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -143,6 +259,8 @@ func createImageGenerationHandler(imageService service.ImageService) echo.Handle
 		if err := c.Bind(&req); err != nil {
 			return errors.NewBadRequestError("无效的请求数据", err)
 		}
+		c.Set(metrics.ModelContextKey, req.Model)
+		usage.FromContext(c.Request().Context()).SetModel(req.Model)
 
 		// 调用服务生成图片
 		resp, err := imageService.GenerateImage(c.Request().Context(), &req)
@@ -156,8 +274,9 @@ func createImageGenerationHandler(imageService service.ImageService) echo.Handle
 }
 
 // createCustomBotHandler 创建Custom Bot处理器
-func createCustomBotHandler(service service.CustomBotService, cfg *config.Config) echo.HandlerFunc {
+func createCustomBotHandler(service service.CustomBotService, drainer *Drainer, holder *config.Holder) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		cfg := holder.Get()
 		// 获取bot UID，优先从路由参数获取，如果没有则从环境变量获取
 		botUID := c.Param("bot_uid")
 		if botUID == "" {
@@ -169,16 +288,26 @@ func createCustomBotHandler(service service.CustomBotService, cfg *config.Config
 		}
 
 		var req openai.ChatCompletionRequest
-		if err := c.Bind(&req); err != nil {
+		ctx, err := bindChatRequest(c, &req)
+		if err != nil {
 			return errors.NewBadRequestError("请求体解析失败", err)
 		}
+		c.Set(metrics.ModelContextKey, req.Model)
 
-		ctx := c.Request().Context()
+		rec := recorder.FromContext(ctx)
+		rec.SetRequest(req.Model, req.Stream, req)
+		usage.FromContext(ctx).SetChatRequest(&req)
 		result, err := service.HandleCustomBotChat(ctx, &req, botUID)
 		if err != nil {
 			return err
 		}
 
+		// 降级到备用模型时通过响应头告知客户端
+		model := servedModel(result, req.Model)
+		if model != req.Model {
+			c.Response().Header().Set(fallbackHeader, model)
+		}
+
 		// 如果是流式响应
 		if req.Stream {
 			// 设置响应头
@@ -193,10 +322,21 @@ func createCustomBotHandler(service service.CustomBotService, cfg *config.Config
 				return errors.NewInternalError(fmt.Errorf("流式响应类型错误"))
 			}
 			defer stream.Close()
+			// 登记到排空器，停机宽限期结束时中断上游读取
+			defer drainer.trackStream(stream)()
 
 			// 转换并写入响应（带配置参数）
-			err := monica.StreamMonicaSSEToClientWithConfig(req.Model, c.Response().Writer, stream, cfg)
+			_, span := tracing.Start(ctx, "sse.relay",
+				attribute.String("gen_ai.response.model", model),
+				attribute.Bool("stream", true),
+			)
+			err := monica.StreamMonicaSSEToClientWithConfig(model, rec.TeeClient(c.Response().Writer), stream, cfg)
+			tracing.End(span, err)
 			if err != nil {
+				if drainer.aborted() {
+					writeShutdownEvent(c.Response())
+					return nil
+				}
 				logger.Error("流式响应写入失败", zap.Error(err))
 				return err
 			}
@@ -206,18 +346,46 @@ func createCustomBotHandler(service service.CustomBotService, cfg *config.Config
 		}
 
 		// 非流式响应
+		rec.SetResponse(result)
 		return c.JSON(http.StatusOK, result)
 	}
 }
 
+// bindChatRequest 解析对话请求，返回的上下文中带有 go-openai 不支持的内容部分（如 file）和当前 API Key
+func bindChatRequest(c echo.Context, req *openai.ChatCompletionRequest) (context.Context, error) {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+	if err := c.Bind(req); err != nil {
+		return nil, err
+	}
+	ctx := fileContext(c)
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return ctx, nil
+	}
+	parts, err := types.ParseMessageParts(body)
+	if err != nil {
+		return nil, err
+	}
+	return types.WithMessageParts(ctx, parts), nil
+}
+
+// fileContext 返回带有当前 API Key 的请求上下文，文件按上传者隔离
+func fileContext(c echo.Context) context.Context {
+	apiKey := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	return filestore.WithOwner(c.Request().Context(), apiKey)
+}
+
 // createFileUploadHandler 创建文件上传处理器
 func createFileUploadHandler(fileService service.FileService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// 解析multipart form
-		form, err := c.MultipartForm()
-		if err != nil {
+		// 解析multipart form，超过 multipartMemory 的文件写入临时文件，并发上传大文件时不占用内存
+		if err := c.Request().ParseMultipartForm(multipartMemory); err != nil {
 			return errors.NewBadRequestError("解析multipart form失败", err)
 		}
+		form := c.Request().MultipartForm
 		defer form.RemoveAll()
 
 		// 获取上传的文件
@@ -235,7 +403,7 @@ func createFileUploadHandler(fileService service.FileService) echo.HandlerFunc {
 		}
 
 		// 上传文件
-		fileObject, err := fileService.UploadFile(c.Request().Context(), fileHeader, purpose)
+		fileObject, err := fileService.UploadFile(fileContext(c), fileHeader, purpose)
 		if err != nil {
 			return err
 		}
@@ -252,7 +420,7 @@ func createGetFileHandler(fileService service.FileService) echo.HandlerFunc {
 			return errors.NewBadRequestError("file_id参数不能为空", nil)
 		}
 
-		fileObject, err := fileService.GetFile(c.Request().Context(), fileID)
+		fileObject, err := fileService.GetFile(fileContext(c), fileID)
 		if err != nil {
 			return err
 		}
@@ -261,21 +429,70 @@ func createGetFileHandler(fileService service.FileService) echo.HandlerFunc {
 	}
 }
 
-// createListFilesHandler 创建文件列表处理器
-func createListFilesHandler(fileService service.FileService) echo.HandlerFunc {
+// createFileContentHandler 创建文件内容下载处理器，支持 Range 请求
+func createFileContentHandler(fileService service.FileService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		files, err := fileService.ListFiles(c.Request().Context())
+		fileID := c.Param("file_id")
+		if fileID == "" {
+			return errors.NewBadRequestError("file_id参数不能为空", nil)
+		}
+
+		req := c.Request()
+		content, err := fileService.GetFileContent(fileContext(c), fileID, req.Header.Get("Range"))
 		if err != nil {
 			return err
 		}
+		defer content.Close()
 
-		response := types.FileListResponse{
-			Object: "list",
-			Data:   make([]types.FileObject, len(files)),
+		header := c.Response().Header()
+		// CDN 拒绝 Range 时转发 416 及其 Content-Range（bytes */总大小）
+		if content.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			if content.ContentRange != "" {
+				header.Set("Content-Range", content.ContentRange)
+			}
+			return c.NoContent(content.StatusCode)
 		}
+		header.Set(echo.HeaderContentType, content.ContentType)
+		header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": content.Filename}))
 
-		for i, file := range files {
-			response.Data[i] = *file
+		// 本地副本由 ServeContent 处理 Range、If-Range 和 416
+		if content.Local != nil {
+			http.ServeContent(c.Response(), req, content.Filename, content.ModTime, content.Local)
+			return nil
+		}
+
+		header.Set("Accept-Ranges", "bytes")
+		if content.ContentLength != "" {
+			header.Set(echo.HeaderContentLength, content.ContentLength)
+		}
+		if content.ContentRange != "" {
+			header.Set("Content-Range", content.ContentRange)
+		}
+		c.Response().WriteHeader(content.StatusCode)
+		_, err = io.Copy(c.Response(), content.Body)
+		return err
+	}
+}
+
+// createListFilesHandler 创建文件列表处理器
+func createListFilesHandler(fileService service.FileService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := service.FileListQuery{
+			Purpose: c.QueryParam("purpose"),
+			After:   c.QueryParam("after"),
+			Order:   c.QueryParam("order"),
+		}
+		if limit := c.QueryParam("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n <= 0 {
+				return errors.NewBadRequestError("limit参数必须是正整数", err)
+			}
+			query.Limit = n
+		}
+
+		response, err := fileService.ListFiles(fileContext(c), query)
+		if err != nil {
+			return err
 		}
 
 		return c.JSON(http.StatusOK, response)
@@ -290,7 +507,7 @@ func createDeleteFileHandler(fileService service.FileService) echo.HandlerFunc {
 			return errors.NewBadRequestError("file_id参数不能为空", nil)
 		}
 
-		err := fileService.DeleteFile(c.Request().Context(), fileID)
+		err := fileService.DeleteFile(fileContext(c), fileID)
 		if err != nil {
 			return err
 		}
@@ -304,3 +521,96 @@ func createDeleteFileHandler(fileService service.FileService) echo.HandlerFunc {
 		return c.JSON(http.StatusOK, response)
 	}
 }
+
+// createUploadHandler 创建分片上传处理器
+func createUploadHandler(uploadService service.UploadService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req types.CreateUploadRequest
+		if err := c.Bind(&req); err != nil {
+			return errors.NewBadRequestError("无效的请求数据", err)
+		}
+
+		upload, err := uploadService.CreateUpload(fileContext(c), req)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, upload)
+	}
+}
+
+// createGetUploadHandler 创建获取上传状态处理器
+func createGetUploadHandler(uploadService service.UploadService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		upload, err := uploadService.GetUpload(fileContext(c), c.Param("upload_id"))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, upload)
+	}
+}
+
+// createUploadPartHandler 创建添加分片处理器，分片内容在 multipart 的 data 字段中
+func createUploadPartHandler(uploadService service.UploadService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := c.Request().ParseMultipartForm(multipartMemory); err != nil {
+			return errors.NewBadRequestError("解析multipart form失败", err)
+		}
+		form := c.Request().MultipartForm
+		defer form.RemoveAll()
+
+		parts := form.File["data"]
+		if len(parts) == 0 {
+			return errors.NewBadRequestError("未找到分片数据", nil)
+		}
+		data, err := parts[0].Open()
+		if err != nil {
+			return errors.NewInternalError(err)
+		}
+		defer data.Close()
+
+		part, err := uploadService.AddPart(fileContext(c), c.Param("upload_id"), data)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, part)
+	}
+}
+
+// createCompleteUploadHandler 创建完成上传处理器
+func createCompleteUploadHandler(uploadService service.UploadService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req types.CompleteUploadRequest
+		if err := c.Bind(&req); err != nil {
+			return errors.NewBadRequestError("无效的请求数据", err)
+		}
+
+		upload, err := uploadService.CompleteUpload(fileContext(c), c.Param("upload_id"), req)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, upload)
+	}
+}
+
+// createCancelUploadHandler 创建取消上传处理器
+func createCancelUploadHandler(uploadService service.UploadService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		upload, err := uploadService.CancelUpload(fileContext(c), c.Param("upload_id"))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, upload)
+	}
+}
+
+// createAttachmentCacheHandler 创建附件缓存统计处理器
+func createAttachmentCacheHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, types.AttachmentCacheStats())
+	}
+}
@@ -0,0 +1,158 @@
+package apiserver
+
+import (
+	"encoding/csv"
+	"fmt"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/usage"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultUsageWindow 未指定时间范围时查询最近30天
+const defaultUsageWindow = 30 * 24 * time.Hour
+
+// createUsageReportHandler 创建用量聚合处理器
+// GET /admin/usage?group_by=key,model,day&from=2025-01-01&to=2025-01-31&format=csv
+func createUsageReportHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ledger := usage.Current()
+		if ledger == nil {
+			return errors.NewNotFoundError("用量账本未启用")
+		}
+		from, to, err := parseUsageRange(c)
+		if err != nil {
+			return err
+		}
+		groupBy, err := usage.ParseGroupBy(c.QueryParam("group_by"))
+		if err != nil {
+			return errors.NewBadRequestError("无效的group_by参数", err)
+		}
+
+		rows, err := ledger.Aggregate(from, to, groupBy)
+		if err != nil {
+			return errors.NewInternalError(err)
+		}
+
+		if c.QueryParam("format") == "csv" {
+			header := []string{"key", "model", "day", "requests", "errors", "prompt_tokens", "completion_tokens", "attachments", "credits", "avg_latency_ms"}
+			records := make([][]string, 0, len(rows))
+			for _, r := range rows {
+				records = append(records, []string{
+					r.Key, r.Model, r.Day,
+					strconv.Itoa(r.Requests), strconv.Itoa(r.Errors),
+					strconv.Itoa(r.PromptTokens), strconv.Itoa(r.CompletionTokens),
+					strconv.Itoa(r.Attachments), strconv.Itoa(r.Credits),
+					strconv.FormatInt(r.AvgLatencyMs, 10),
+				})
+			}
+			return writeCSV(c, "usage.csv", header, records)
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"object":   "list",
+			"from":     from,
+			"to":       to,
+			"group_by": groupBy,
+			"data":     rows,
+		})
+	}
+}
+
+// createUsageRecordsHandler 创建用量明细处理器
+// GET /admin/usage/records?from=2025-01-01&to=2025-01-31&limit=1000&format=csv
+func createUsageRecordsHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ledger := usage.Current()
+		if ledger == nil {
+			return errors.NewNotFoundError("用量账本未启用")
+		}
+		from, to, err := parseUsageRange(c)
+		if err != nil {
+			return err
+		}
+		limit := 1000
+		if v := c.QueryParam("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+				return errors.NewBadRequestError("无效的limit参数", err)
+			}
+		}
+
+		records, err := ledger.Records(from, to, limit)
+		if err != nil {
+			return errors.NewInternalError(err)
+		}
+
+		if c.QueryParam("format") == "csv" {
+			header := []string{"time", "id", "key", "route", "requested_model", "model", "account", "stream",
+				"prompt_tokens", "completion_tokens", "attachments", "latency_ms", "status", "outcome", "credits"}
+			rows := make([][]string, 0, len(records))
+			for _, r := range records {
+				rows = append(rows, []string{
+					r.Time.Format(time.RFC3339), r.ID, r.APIKey, r.Route, r.RequestedModel, r.Model,
+					strconv.Itoa(r.Account), strconv.FormatBool(r.Stream),
+					strconv.Itoa(r.PromptTokens), strconv.Itoa(r.CompletionTokens), strconv.Itoa(r.Attachments),
+					strconv.FormatInt(r.LatencyMs, 10), strconv.Itoa(r.Status), r.Outcome, strconv.Itoa(r.Credits),
+				})
+			}
+			return writeCSV(c, "usage-records.csv", header, rows)
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"object": "list",
+			"data":   records,
+		})
+	}
+}
+
+// parseUsageRange 解析 from/to 参数，支持日期（本地时区）或 RFC3339；to 为日期时包含当天
+func parseUsageRange(c echo.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	from := to.Add(-defaultUsageWindow)
+
+	if v := c.QueryParam("from"); v != "" {
+		t, _, err := parseUsageTime(v)
+		if err != nil {
+			return from, to, errors.NewBadRequestError("无效的from参数", err)
+		}
+		from = t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, isDay, err := parseUsageTime(v)
+		if err != nil {
+			return from, to, errors.NewBadRequestError("无效的to参数", err)
+		}
+		if isDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		return from, to, errors.NewBadRequestError("from必须早于to", nil)
+	}
+	return from, to, nil
+}
+
+func parseUsageTime(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(usage.DayLayout, value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// writeCSV 以附件形式输出CSV
+func writeCSV(c echo.Context, filename string, header []string, rows [][]string) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	w.Write(header)
+	w.WriteAll(rows)
+	return w.Error()
+}
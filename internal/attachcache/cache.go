@@ -0,0 +1,282 @@
+package attachcache
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+	bolt "go.etcd.io/bbolt"
+)
+
+var entriesBucket = []byte("entries")
+
+// Options 缓存的容量与有效期
+type Options struct {
+	MaxEntries int           // 内存中最多保留的条目数，超出时淘汰最久未使用的
+	TTL        time.Duration // 条目写入后的有效期，过期后视为未命中
+	DiskPath   string        // bbolt 数据库文件，为空时只使用内存
+}
+
+// Stats 缓存统计
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	DiskHits  int64 `json:"disk_hits"` // 内存未命中、从磁盘恢复的次数，包含在 Hits 中
+	Evictions int64 `json:"evictions"` // 因容量淘汰的条目数
+	Expired   int64 `json:"expired"`   // 因过期移除的条目数
+	Entries   int   `json:"entries"`   // 内存中的条目数
+	Disk      bool  `json:"disk"`      // 是否启用磁盘层
+}
+
+// Cache 带容量上限和有效期的 LRU 缓存，可选写入磁盘以便重启后继续使用
+type Cache[V any] struct {
+	mu      sync.Mutex
+	opts    Options
+	order   *list.List // 前端为最近使用
+	entries map[string]*list.Element
+	db      *bolt.DB
+
+	hits, misses, diskHits, evictions, expired atomic.Int64
+}
+
+// entry 缓存条目，磁盘中以 JSON 保存
+type entry[V any] struct {
+	Key       string `json:"key"`
+	Value     V      `json:"value"`
+	ExpiresAt int64  `json:"expires_at"` // UnixNano
+}
+
+// New 创建缓存，DiskPath 不为空时打开磁盘层并清理其中已过期的条目
+func New[V any](opts Options) (*Cache[V], error) {
+	c := &Cache[V]{
+		opts:    opts,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	if opts.DiskPath == "" {
+		return c, nil
+	}
+
+	if dir := filepath.Dir(opts.DiskPath); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("create attachment cache directory failed: %w", err)
+		}
+	}
+	db, err := bolt.Open(opts.DiskPath, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open attachment cache failed: %w", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init attachment cache failed: %w", err)
+	}
+	c.db = db
+	c.pruneDisk()
+	return c, nil
+}
+
+// Options 返回创建时的选项
+func (c *Cache[V]) Options() Options {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+// SetLimits 调整容量和有效期，容量变小时立即淘汰多出的条目；已写入条目的过期时间不变
+func (c *Cache[V]) SetLimits(maxEntries int, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts.MaxEntries = maxEntries
+	c.opts.TTL = ttl
+	c.evictLocked()
+}
+
+// Get 读取条目，内存未命中时查询磁盘层并放回内存
+func (c *Cache[V]) Get(key string) (V, bool) {
+	now := time.Now().UnixNano()
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[V])
+		if e.ExpiresAt > now {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return e.Value, true
+		}
+		c.order.Remove(el)
+		delete(c.entries, key)
+		// 磁盘层中的同一条目也已过期，由 loadDisk 计数
+		if c.db == nil {
+			c.expired.Add(1)
+		}
+	}
+	c.mu.Unlock()
+
+	if e, ok := c.loadDisk(key, now); ok {
+		c.mu.Lock()
+		c.addLocked(e)
+		c.mu.Unlock()
+		c.hits.Add(1)
+		c.diskHits.Add(1)
+		return e.Value, true
+	}
+
+	c.misses.Add(1)
+	var zero V
+	return zero, false
+}
+
+// Set 写入条目，启用磁盘层时同时写入磁盘；磁盘写入失败只影响重启后的命中
+func (c *Cache[V]) Set(key string, value V) {
+	e := &entry[V]{Key: key, Value: value}
+
+	c.mu.Lock()
+	e.ExpiresAt = time.Now().Add(c.opts.TTL).UnixNano()
+	c.addLocked(e)
+	c.mu.Unlock()
+
+	if c.db == nil {
+		return
+	}
+	data, err := sonic.Marshal(e)
+	if err != nil {
+		return
+	}
+	c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Put([]byte(key), data)
+	})
+}
+
+// DeleteFunc 删除值满足 match 的全部条目，包括磁盘中的条目，返回删除的数量
+func (c *Cache[V]) DeleteFunc(match func(V) bool) int {
+	removed := make(map[string]bool)
+
+	c.mu.Lock()
+	for key, el := range c.entries {
+		if match(el.Value.(*entry[V]).Value) {
+			c.order.Remove(el)
+			delete(c.entries, key)
+			removed[key] = true
+		}
+	}
+	c.mu.Unlock()
+
+	if c.db != nil {
+		c.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(entriesBucket)
+			var keys [][]byte
+			bucket.ForEach(func(key, data []byte) error {
+				var e entry[V]
+				if sonic.Unmarshal(data, &e) == nil && match(e.Value) {
+					keys = append(keys, append([]byte(nil), key...))
+				}
+				return nil
+			})
+			for _, key := range keys {
+				bucket.Delete(key)
+				removed[string(key)] = true
+			}
+			return nil
+		})
+	}
+	return len(removed)
+}
+
+// Stats 返回命中统计和当前条目数
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		DiskHits:  c.diskHits.Load(),
+		Evictions: c.evictions.Load(),
+		Expired:   c.expired.Load(),
+		Entries:   entries,
+		Disk:      c.db != nil,
+	}
+}
+
+// Close 关闭磁盘层，内存中的条目不受影响
+func (c *Cache[V]) Close() error {
+	if c.db == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// addLocked 插入或替换条目并按容量淘汰，调用方持有 mu
+func (c *Cache[V]) addLocked(e *entry[V]) {
+	if el, ok := c.entries[e.Key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[e.Key] = c.order.PushFront(e)
+	}
+	c.evictLocked()
+}
+
+// evictLocked 淘汰超出容量的最久未使用条目，磁盘中的条目保留到过期，调用方持有 mu
+func (c *Cache[V]) evictLocked() {
+	for c.opts.MaxEntries > 0 && c.order.Len() > c.opts.MaxEntries {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.entries, el.Value.(*entry[V]).Key)
+		c.evictions.Add(1)
+	}
+}
+
+// loadDisk 从磁盘层读取未过期的条目，过期的条目顺带删除
+func (c *Cache[V]) loadDisk(key string, now int64) (*entry[V], bool) {
+	if c.db == nil {
+		return nil, false
+	}
+	var e entry[V]
+	var found bool
+	c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(entriesBucket).Get([]byte(key))
+		found = data != nil && sonic.Unmarshal(data, &e) == nil
+		return nil
+	})
+	if !found {
+		return nil, false
+	}
+	if e.ExpiresAt <= now {
+		c.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(entriesBucket).Delete([]byte(key))
+		})
+		c.expired.Add(1)
+		return nil, false
+	}
+	return &e, true
+}
+
+// pruneDisk 删除磁盘中已过期的条目，磁盘层的大小因此受有效期约束
+func (c *Cache[V]) pruneDisk() {
+	now := time.Now().UnixNano()
+	c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+		var keys [][]byte
+		bucket.ForEach(func(key, data []byte) error {
+			var e entry[V]
+			if sonic.Unmarshal(data, &e) != nil || e.ExpiresAt <= now {
+				keys = append(keys, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		for _, key := range keys {
+			bucket.Delete(key)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,181 @@
+package attachcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, opts Options) *Cache[string] {
+	t.Helper()
+	c, err := New[string](opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// present 按 Get 检查每个键是否命中，返回命中的键
+func present(c *Cache[string], keys ...string) map[string]bool {
+	result := make(map[string]bool)
+	for _, k := range keys {
+		if _, ok := c.Get(k); ok {
+			result[k] = true
+		}
+	}
+	return result
+}
+
+func TestCacheLRU(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     func(c *Cache[string])
+		want    []string
+		evicted int64
+	}{
+		{
+			name: "oldest evicted",
+			ops: func(c *Cache[string]) {
+				c.Set("a", "1")
+				c.Set("b", "2")
+				c.Set("c", "3")
+			},
+			want:    []string{"b", "c"},
+			evicted: 1,
+		},
+		{
+			name: "get refreshes recency",
+			ops: func(c *Cache[string]) {
+				c.Set("a", "1")
+				c.Set("b", "2")
+				c.Get("a")
+				c.Set("c", "3")
+			},
+			want:    []string{"a", "c"},
+			evicted: 1,
+		},
+		{
+			name: "overwrite does not grow",
+			ops: func(c *Cache[string]) {
+				c.Set("a", "1")
+				c.Set("b", "2")
+				c.Set("a", "3")
+			},
+			want:    []string{"a", "b"},
+			evicted: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, Options{MaxEntries: 2, TTL: time.Hour})
+			tt.ops(c)
+			evictions := c.Stats().Evictions
+			got := present(c, "a", "b", "c")
+			if len(got) != len(tt.want) {
+				t.Fatalf("present = %v, want %v", got, tt.want)
+			}
+			for _, k := range tt.want {
+				if !got[k] {
+					t.Errorf("%s missing, present = %v", k, got)
+				}
+			}
+			if evictions != tt.evicted {
+				t.Errorf("evictions = %d, want %d", evictions, tt.evicted)
+			}
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := newTestCache(t, Options{MaxEntries: 10, TTL: 20 * time.Millisecond})
+	c.Set("a", "1")
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Fatalf("Get before expiry = %q, %v", v, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expired entry returned")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Expired != 1 || stats.Entries != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// 调整有效期只影响之后写入的条目
+	c.SetLimits(10, time.Hour)
+	c.Set("b", "2")
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("b"); !ok {
+		t.Error("entry written after SetLimits expired early")
+	}
+}
+
+func TestCacheSetLimitsShrinks(t *testing.T) {
+	c := newTestCache(t, Options{MaxEntries: 5, TTL: time.Hour})
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Set(k, k)
+	}
+	c.SetLimits(2, time.Hour)
+	if got := c.Stats(); got.Entries != 2 || got.Evictions != 2 {
+		t.Errorf("stats = %+v", got)
+	}
+	if got := present(c, "a", "b", "c", "d"); !got["c"] || !got["d"] || len(got) != 2 {
+		t.Errorf("present = %v, want c and d", got)
+	}
+}
+
+func TestCacheDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "attachments.db")
+	c, err := New[string](Options{MaxEntries: 1, TTL: time.Hour, DiskPath: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c.Set("a", "1")
+	c.Set("b", "2") // 从内存淘汰 a，磁盘中仍保留
+
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Fatalf("Get evicted entry = %q, %v", v, ok)
+	}
+	if got := c.Stats(); got.DiskHits != 1 || !got.Disk {
+		t.Errorf("stats = %+v", got)
+	}
+	// 缓存内容包含上传的文件信息，目录只对当前用户可见
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("cache directory mode = %v, %v", info.Mode().Perm(), err)
+	}
+
+	if n := c.DeleteFunc(func(v string) bool { return v == "2" }); n != 1 {
+		t.Errorf("DeleteFunc removed %d, want 1", n)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后从磁盘恢复未过期的条目，已删除的不再出现
+	c = newTestCache(t, Options{MaxEntries: 10, TTL: time.Hour, DiskPath: path})
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Errorf("Get after reopen = %q, %v", v, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("deleted entry restored from disk")
+	}
+}
+
+func TestCacheDiskExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attachments.db")
+	c, err := New[string](Options{MaxEntries: 10, TTL: 20 * time.Millisecond, DiskPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("a", "1")
+	c.Close()
+	time.Sleep(30 * time.Millisecond)
+
+	c = newTestCache(t, Options{MaxEntries: 10, TTL: time.Hour, DiskPath: path})
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired disk entry returned after reopen")
+	}
+}
@@ -0,0 +1,358 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置项取值来源，优先级从高到低：命令行参数 > 环境变量 > CONFIG_FILE 指定的文件 > 自动查找的文件 > 默认值
+const (
+	SourceDefault    = "default"
+	SourceFile       = "file"        // 自动查找到的配置文件
+	SourceConfigFile = "config_file" // CONFIG_FILE 或 -config 明确指定的配置文件
+	SourceEnv        = "env"
+	SourceFlag       = "flag"
+)
+
+// Source 配置项的取值来源
+type Source struct {
+	Kind string // 见 Source* 常量
+	Name string // 文件路径、环境变量名或命令行参数名
+}
+
+func (s Source) String() string {
+	if s.Name == "" {
+		return s.Kind
+	}
+	return s.Kind + ":" + s.Name
+}
+
+// Sources 各配置项的取值来源，键为 Binding.Path
+type Sources map[string]Source
+
+// Binding 配置项与环境变量、命令行参数的绑定，由结构体的 yaml/env/secret/sep 标签生成
+type Binding struct {
+	Path   string   // YAML 路径，如 server.write_timeout
+	Env    []string // 环境变量，靠前的优先，其余为兼容旧版本的别名
+	Flag   string   // 命令行参数名，如 server.write-timeout
+	Secret bool     // 敏感值，展示时需要脱敏
+
+	index []int
+	sep   string // 列表项的分隔符，由 sep 标签指定，默认为 "||"
+}
+
+// Value 返回配置项在 cfg 中的值，格式与环境变量相同
+func (b Binding) Value(cfg *Config) string {
+	return formatValue(reflect.ValueOf(cfg).Elem().FieldByIndex(b.index), b.sep)
+}
+
+// Set 按环境变量的格式解析 value 并写入 cfg
+func (b Binding) Set(cfg *Config, value string) error {
+	return setValue(reflect.ValueOf(cfg).Elem().FieldByIndex(b.index), value, b.sep)
+}
+
+var (
+	bindingsOnce sync.Once
+	bindings     []Binding
+)
+
+// Bindings 返回全部配置项的绑定，顺序与结构体字段一致
+func Bindings() []Binding {
+	bindingsOnce.Do(func() {
+		bindings = collectBindings(reflect.TypeOf(Config{}), nil, "")
+	})
+	return bindings
+}
+
+func collectBindings(t reflect.Type, index []int, prefix string) []Binding {
+	var result []Binding
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		path := prefix + name
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			result = append(result, collectBindings(field.Type, fieldIndex, path+".")...)
+			continue
+		}
+		result = append(result, Binding{
+			Path:   path,
+			Env:    splitNonEmpty(field.Tag.Get("env"), ","),
+			Flag:   strings.ReplaceAll(path, "_", "-"),
+			Secret: field.Tag.Get("secret") == "true",
+			index:  fieldIndex,
+			sep:    listSeparator(field.Tag),
+		})
+	}
+	return result
+}
+
+// listSeparator 返回字段的列表分隔符。"||" 可能出现在正则中，正则列表通过 sep 标签改用换行分隔
+func listSeparator(tag reflect.StructTag) string {
+	if sep := tag.Get("sep"); sep != "" {
+		return sep
+	}
+	return "||"
+}
+
+// Options 加载配置的选项
+type Options struct {
+	File  string     // 明确指定的配置文件，优先于 CONFIG_FILE 和自动查找，读取失败时返回错误
+	Flags FlagValues // 命令行参数设置的配置值
+}
+
+// Resolve 按优先级合并默认值、配置文件、环境变量和命令行参数，并返回每个配置项的来源；不做校验。
+// 配置文件中的 ${NAME} 会展开为环境变量，加密的敏感字段使用 KeyFile 解密，
+// cookie/bearer_token 为空时读取 cookie_file/bearer_token_file
+func Resolve(opts Options) (*Config, Sources, error) {
+	config := getDefaultConfig()
+	sources := make(Sources, len(Bindings()))
+	for _, b := range Bindings() {
+		sources[b.Path] = Source{Kind: SourceDefault}
+	}
+
+	// .env 中也可以设置 CONFIG_FILE
+	_ = godotenv.Load()
+
+	path, kind := opts.File, SourceConfigFile
+	if path == "" {
+		path, kind = resolveFilePath()
+	}
+	if path != "" {
+		config.keyFile = KeyFile(path)
+		keys, err := loadFileWithKeys(path, config)
+		switch {
+		case err != nil && kind == SourceFile:
+			// 自动查找到的配置文件加载失败不是致命错误，继续使用环境变量和默认值
+			fmt.Fprintf(os.Stderr, "Warning: Failed to load config file: %v\n", err)
+		case err != nil:
+			return nil, nil, fmt.Errorf("加载配置文件失败: %w", err)
+		default:
+			for _, b := range Bindings() {
+				if keys[b.Path] {
+					sources[b.Path] = Source{Kind: kind, Name: path}
+				}
+			}
+			if err := expandFileValues(config, path); err != nil {
+				return nil, nil, fmt.Errorf("加载配置文件失败: %w", err)
+			}
+		}
+	}
+
+	for _, b := range Bindings() {
+		for _, name := range b.Env {
+			value := os.Getenv(name)
+			if value == "" {
+				continue
+			}
+			if err := b.Set(config, value); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Ignoring environment variable %s: %v\n", name, err)
+				continue
+			}
+			sources[b.Path] = Source{Kind: SourceEnv, Name: name}
+			break
+		}
+	}
+
+	for _, b := range Bindings() {
+		value, ok := opts.Flags[b.Flag]
+		if !ok {
+			continue
+		}
+		if err := b.Set(config, value); err != nil {
+			return nil, nil, fmt.Errorf("invalid value for -%s: %w", b.Flag, err)
+		}
+		sources[b.Path] = Source{Kind: SourceFlag, Name: "-" + b.Flag}
+	}
+
+	if err := resolveSecretFiles(config, sources); err != nil {
+		return nil, nil, err
+	}
+	recordResolvedValues(config)
+	return config, sources, nil
+}
+
+// loadFileWithKeys 加载配置文件，并返回文件中出现的配置项路径
+func loadFileWithKeys(path string, config *Config) (map[string]bool, error) {
+	if err := loadFromFile(path, config); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON 是 YAML 的子集，两种格式都按 YAML 解析出键
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	collectKeys(raw, "", keys)
+	return keys, nil
+}
+
+func collectKeys(raw map[string]interface{}, prefix string, keys map[string]bool) {
+	for key, value := range raw {
+		keys[prefix+key] = true
+		if nested, ok := value.(map[string]interface{}); ok && prefix == "" {
+			collectKeys(nested, key+".", keys)
+		}
+	}
+}
+
+// FlagValues 命令行参数设置的配置值，键为 Binding.Flag
+type FlagValues map[string]string
+
+// RegisterFlags 为每个配置项注册命令行参数，解析时校验取值，设置过的参数保存在返回值中
+func RegisterFlags(fs *flag.FlagSet) FlagValues {
+	values := make(FlagValues)
+	defaults := GetDefaultConfig()
+	for _, b := range Bindings() {
+		b := b
+		usage := b.Path
+		if len(b.Env) > 0 {
+			usage += "，环境变量 " + strings.Join(b.Env, "/")
+		}
+		field := reflect.ValueOf(defaults).Elem().FieldByIndex(b.index)
+		// 列表和映射的默认值较长，不在帮助中展示
+		if def := b.Value(defaults); def != "" && !b.Secret && field.Kind() != reflect.Slice && field.Kind() != reflect.Map {
+			usage += "，默认 " + def
+		}
+		set := func(value string) error {
+			if err := b.Set(GetDefaultConfig(), value); err != nil {
+				return err
+			}
+			values[b.Flag] = value
+			return nil
+		}
+
+		if field.Kind() == reflect.Bool {
+			fs.BoolFunc(b.Flag, usage, set)
+		} else {
+			fs.Func(b.Flag, usage, set)
+		}
+	}
+	return values
+}
+
+// setValue 解析文本并写入字段：列表用 sep 分隔，映射的条目用 ";" 分隔
+func setValue(field reflect.Value, value, sep string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		// 多个值之间默认使用 "||" 分隔，避免与Cookie内部的分号冲突
+		field.Set(reflect.ValueOf(splitNonEmpty(value, sep)))
+	case reflect.Map:
+		switch field.Type() {
+		case reflect.TypeOf(map[string][]string(nil)):
+			// 格式: "claude-4-opus=claude-4-sonnet,gpt-4.1;gpt-5=gpt-4.1"
+			field.Set(reflect.ValueOf(parseFallbacks(value)))
+		case reflect.TypeOf(map[string]int(nil)):
+			// 格式: "gpt-4o=1;claude-4-opus=10"
+			counts, err := parseCounts(value)
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(counts))
+		default:
+			return fmt.Errorf("unsupported map type %s", field.Type())
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// formatValue 按 setValue 接受的格式输出字段值
+func formatValue(field reflect.Value, sep string) string {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(field.Int()).String()
+	}
+
+	switch v := field.Interface().(type) {
+	case []string:
+		return strings.Join(v, sep)
+	case map[string][]string:
+		entries := make([]string, 0, len(v))
+		for _, model := range sortedKeys(v) {
+			entries = append(entries, model+"="+strings.Join(v[model], ","))
+		}
+		return strings.Join(entries, ";")
+	case map[string]int:
+		entries := make([]string, 0, len(v))
+		for _, model := range sortedKeys(v) {
+			entries = append(entries, fmt.Sprintf("%s=%d", model, v[model]))
+		}
+		return strings.Join(entries, ";")
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseCounts 解析 "model=N" 形式的条目，条目之间用 ";" 分隔
+func parseCounts(value string) (map[string]int, error) {
+	result := make(map[string]int)
+	for _, entry := range splitNonEmpty(value, ";") {
+		key, count, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %q: %w", entry, err)
+		}
+		result[key] = n
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func bindingFor(t *testing.T, path string) Binding {
+	t.Helper()
+	for _, b := range Bindings() {
+		if b.Path == path {
+			return b
+		}
+	}
+	t.Fatalf("no binding for %s", path)
+	return Binding{}
+}
+
+func TestBindingSetValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		value   string
+		want    interface{}
+		format  string
+		wantErr bool
+	}{
+		{"duration", "server.write_timeout", "90s", 90 * time.Second, "1m30s", false},
+		{"invalid duration", "server.write_timeout", "soon", nil, "", true},
+		{"int", "server.port", "9000", 9000, "9000", false},
+		{"bool", "usage.enabled", "false", false, "false", false},
+		{"list", "url_fetch.deny_hosts", "a.com|| b.com ||", []string{"a.com", "b.com"}, "a.com||b.com", false},
+		// 正则中的 || 不能被当作分隔符
+		{"pattern list", "redaction.patterns", "(?:foo||bar)\n\nsk-\\w+\n", []string{"(?:foo||bar)", "sk-\\w+"}, "(?:foo||bar)\nsk-\\w+", false},
+		{"fallbacks", "fallbacks", "gpt-5=gpt-4.1,gpt-4o;o1=o3", map[string][]string{"gpt-5": {"gpt-4.1", "gpt-4o"}, "o1": {"o3"}}, "gpt-5=gpt-4.1,gpt-4o;o1=o3", false},
+		{"counts", "usage.credit_costs", "gpt-4o=1; claude=10", map[string]int{"gpt-4o": 1, "claude": 10}, "claude=10;gpt-4o=1", false},
+		{"invalid count", "usage.credit_costs", "gpt-4o=many", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := bindingFor(t, tt.path)
+			cfg := GetDefaultConfig()
+			err := b.Set(cfg, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := reflect.ValueOf(cfg).Elem().FieldByIndex(b.index).Interface()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value = %#v, want %#v", got, tt.want)
+			}
+			if formatted := b.Value(cfg); formatted != tt.format {
+				t.Errorf("Value = %q, want %q", formatted, tt.format)
+			}
+		})
+	}
+}
+
+func TestBindingListSeparator(t *testing.T) {
+	if sep := bindingFor(t, "redaction.patterns").sep; sep != "\n" {
+		t.Errorf("patterns sep = %q", sep)
+	}
+	if sep := bindingFor(t, "redaction.paths").sep; sep != "||" {
+		t.Errorf("paths sep = %q", sep)
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "server:\n  host: file-host\n  port: 9000\nlogging:\n  level: warn\nredaction:\n  patterns:\n    - 'a||b'\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SERVER_PORT", "9100")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "")
+	t.Setenv("LOG_MAX_BACKUPS", "many") // 无法解析的环境变量被忽略
+	t.Setenv("HTTP_CLIENT_RETRY_COUNT", "")
+	t.Setenv("PORT", "")
+
+	cfg, sources, err := Resolve(Options{File: path, Flags: FlagValues{"server.port": "9200"}})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		wantValue  string
+		wantSource Source
+	}{
+		{"server.host", "file-host", Source{Kind: SourceConfigFile, Name: path}},
+		{"server.port", "9200", Source{Kind: SourceFlag, Name: "-server.port"}},
+		{"logging.level", "debug", Source{Kind: SourceEnv, Name: "LOG_LEVEL"}},
+		{"logging.format", "json", Source{Kind: SourceDefault}},
+		{"logging.max_backups", "5", Source{Kind: SourceDefault}},
+		{"redaction.patterns", "a||b", Source{Kind: SourceConfigFile, Name: path}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b := bindingFor(t, tt.path)
+			if got := b.Value(cfg); got != tt.wantValue {
+				t.Errorf("value = %q, want %q", got, tt.wantValue)
+			}
+			if got := sources[tt.path]; got != tt.wantSource {
+				t.Errorf("source = %v, want %v", got, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestResolveMissingConfigFile(t *testing.T) {
+	// 明确指定的配置文件读取失败时返回错误，不回退到默认值
+	if _, _, err := Resolve(Options{File: filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Fatal("expected error for missing config file")
+	}
+}
+
+func TestResolveEnvAlias(t *testing.T) {
+	t.Setenv("SERVER_PORT", "")
+	t.Setenv("PORT", "7000")
+	cfg, sources, err := Resolve(Options{})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if cfg.Server.Port != 7000 {
+		t.Errorf("port = %d, want 7000", cfg.Server.Port)
+	}
+	if want := (Source{Kind: SourceEnv, Name: "PORT"}); sources["server.port"] != want {
+		t.Errorf("source = %v, want %v", sources["server.port"], want)
+	}
+}
@@ -5,12 +5,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
-	"strconv"
+	"regexp"
 	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
 )
 
@@ -33,82 +33,192 @@ type Config struct {
 
 	// 代理配置
 	Proxy ProxyConfig `yaml:"proxy" json:"proxy"`
+
+	// 下载消息中 URL 附件的限制
+	URLFetch URLFetchConfig `yaml:"url_fetch" json:"url_fetch"`
+
+	// 监控指标配置
+	Metrics MetricsConfig `yaml:"metrics" json:"metrics"`
+
+	// 链路追踪配置
+	Tracing TracingConfig `yaml:"tracing" json:"tracing"`
+
+	// 流量录制配置
+	Recorder RecorderConfig `yaml:"recorder" json:"recorder"`
+
+	// 数据目录，账本、文件存储和附件缓存的相对路径以此为基准，为空时使用 ~/.monica-proxy
+	DataDir string `yaml:"data_dir" json:"data_dir" env:"DATA_DIR"`
+
+	// 用量账本配置
+	Usage UsageConfig `yaml:"usage" json:"usage"`
+
+	// 上传文件元数据存储
+	Files FilesConfig `yaml:"files" json:"files"`
+
+	// 附件上传缓存，相同内容不重复上传到 Monica
+	AttachmentCache AttachmentCacheConfig `yaml:"attachment_cache" json:"attachment_cache"`
+
+	// 日志与录制内容的脱敏规则
+	Redaction RedactionConfig `yaml:"redaction" json:"redaction"`
+
+	// 模型降级链：模型出错或额度耗尽时按顺序尝试的备用模型
+	Fallbacks map[string][]string `yaml:"fallbacks" json:"fallbacks" env:"MODEL_FALLBACKS"`
+
+	// 配置文件中敏感字段和含 ${NAME} 引用字段的原始写法，保存时用于保留引用和密文
+	fileValues map[string]fileValue
+	// 加载配置时使用的密钥文件路径，未加载配置文件时为空
+	keyFile string
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host         string        `yaml:"host" json:"host"`
-	Port         int           `yaml:"port" json:"port"`
-	ReadTimeout  time.Duration `yaml:"read_timeout" json:"read_timeout"`
-	WriteTimeout time.Duration `yaml:"write_timeout" json:"write_timeout"`
-	IdleTimeout  time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
+	Host         string        `yaml:"host" json:"host" env:"SERVER_HOST"`
+	Port         int           `yaml:"port" json:"port" env:"SERVER_PORT,PORT"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" json:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" json:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" json:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+
+	// ShutdownGracePeriod 停机时等待进行中的流式响应完成的最长时间
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period" json:"shutdown_grace_period" env:"SERVER_SHUTDOWN_GRACE_PERIOD"`
 }
 
 // MonicaConfig Monica API 配置
 type MonicaConfig struct {
-	Cookie              string `yaml:"cookie" json:"cookie"`
-	BotUID              string `yaml:"bot_uid" json:"bot_uid"`
-	EnableCustomBotMode bool   `yaml:"enable_custom_bot_mode" json:"enable_custom_bot_mode"`
+	Cookie              string `yaml:"cookie" json:"cookie" env:"MONICA_COOKIE" secret:"true"`
+	CookieFile          string `yaml:"cookie_file" json:"cookie_file" env:"MONICA_COOKIE_FILE"` // 从文件读取 Cookie，cookie 为空时生效
+	BotUID              string `yaml:"bot_uid" json:"bot_uid" env:"BOT_UID"`
+	EnableCustomBotMode bool   `yaml:"enable_custom_bot_mode" json:"enable_custom_bot_mode" env:"ENABLE_CUSTOM_BOT_MODE"`
+
+	// 故障转移配置：在首个内容块返回前失败时切换账号或降级模型
+	BackupCookies   []string `yaml:"backup_cookies" json:"backup_cookies" env:"MONICA_BACKUP_COOKIES" secret:"true"`
+	FailoverEnabled bool     `yaml:"failover_enabled" json:"failover_enabled" env:"MONICA_FAILOVER_ENABLED"`
+	FallbackModel   string   `yaml:"fallback_model" json:"fallback_model" env:"MONICA_FALLBACK_MODEL"`
 }
 
 // SecurityConfig 安全配置
 type SecurityConfig struct {
-	BearerToken      string        `yaml:"bearer_token" json:"bearer_token"`
-	TLSSkipVerify    bool          `yaml:"tls_skip_verify" json:"tls_skip_verify"`
-	RateLimitEnabled bool          `yaml:"rate_limit_enabled" json:"rate_limit_enabled"`
-	RateLimitRPS     int           `yaml:"rate_limit_rps" json:"rate_limit_rps"`
-	RequestTimeout   time.Duration `yaml:"request_timeout" json:"request_timeout"`
+	BearerToken      string        `yaml:"bearer_token" json:"bearer_token" env:"BEARER_TOKEN" secret:"true"`
+	BearerTokenFile  string        `yaml:"bearer_token_file" json:"bearer_token_file" env:"BEARER_TOKEN_FILE"` // 从文件读取 Bearer Token，bearer_token 为空时生效
+	AdminToken       string        `yaml:"admin_token" json:"admin_token" env:"ADMIN_TOKEN" secret:"true"`     // /admin 管理接口的认证令牌，为空时不开放管理接口
+	TLSSkipVerify    bool          `yaml:"tls_skip_verify" json:"tls_skip_verify" env:"TLS_SKIP_VERIFY"`
+	RateLimitEnabled bool          `yaml:"rate_limit_enabled" json:"rate_limit_enabled" env:"RATE_LIMIT_ENABLED"`
+	RateLimitRPS     int           `yaml:"rate_limit_rps" json:"rate_limit_rps" env:"RATE_LIMIT_RPS"`
+	RequestTimeout   time.Duration `yaml:"request_timeout" json:"request_timeout" env:"REQUEST_TIMEOUT"`
 }
 
 // HTTPClientConfig HTTP 客户端配置
 type HTTPClientConfig struct {
-	Timeout             time.Duration `yaml:"timeout" json:"timeout"`
-	MaxIdleConns        int           `yaml:"max_idle_conns" json:"max_idle_conns"`
-	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host" json:"max_idle_conns_per_host"`
-	MaxConnsPerHost     int           `yaml:"max_conns_per_host" json:"max_conns_per_host"`
-	RetryCount          int           `yaml:"retry_count" json:"retry_count"`
-	RetryWaitTime       time.Duration `yaml:"retry_wait_time" json:"retry_wait_time"`
-	RetryMaxWaitTime    time.Duration `yaml:"retry_max_wait_time" json:"retry_max_wait_time"`
+	Timeout             time.Duration `yaml:"timeout" json:"timeout" env:"HTTP_CLIENT_TIMEOUT"`
+	MaxIdleConns        int           `yaml:"max_idle_conns" json:"max_idle_conns" env:"HTTP_CLIENT_MAX_IDLE_CONNS"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host" json:"max_idle_conns_per_host" env:"HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host" json:"max_conns_per_host" env:"HTTP_CLIENT_MAX_CONNS_PER_HOST"`
+	RetryCount          int           `yaml:"retry_count" json:"retry_count" env:"HTTP_CLIENT_RETRY_COUNT"`
+	RetryWaitTime       time.Duration `yaml:"retry_wait_time" json:"retry_wait_time" env:"HTTP_CLIENT_RETRY_WAIT_TIME"`
+	RetryMaxWaitTime    time.Duration `yaml:"retry_max_wait_time" json:"retry_max_wait_time" env:"HTTP_CLIENT_RETRY_MAX_WAIT_TIME"`
 }
 
 // LoggingConfig 日志配置
 type LoggingConfig struct {
-	Level            string `yaml:"level" json:"level"`
-	Format           string `yaml:"format" json:"format"`
-	Output           string `yaml:"output" json:"output"`
-	EnableRequestLog bool   `yaml:"enable_request_log" json:"enable_request_log"`
-	MaskSensitive    bool   `yaml:"mask_sensitive" json:"mask_sensitive"`
+	Level            string        `yaml:"level" json:"level" env:"LOG_LEVEL"`
+	Format           string        `yaml:"format" json:"format" env:"LOG_FORMAT"`
+	Output           string        `yaml:"output" json:"output" env:"LOG_OUTPUT"`
+	EnableRequestLog bool          `yaml:"enable_request_log" json:"enable_request_log" env:"ENABLE_REQUEST_LOG"`
+	MaskSensitive    bool          `yaml:"mask_sensitive" json:"mask_sensitive" env:"LOG_MASK_SENSITIVE"`
+	MaxSizeMB        int           `yaml:"max_size_mb" json:"max_size_mb" env:"LOG_MAX_SIZE_MB"`             // 单个日志文件最大大小(MB)，超过后轮转，0 表示不按大小轮转
+	RotateInterval   time.Duration `yaml:"rotate_interval" json:"rotate_interval" env:"LOG_ROTATE_INTERVAL"` // 当前日志文件写入超过该时长后轮转，0 表示不按时间轮转
+	MaxAgeDays       int           `yaml:"max_age_days" json:"max_age_days" env:"LOG_MAX_AGE_DAYS"`          // 归档日志保留天数，0 表示不按时间清理
+	MaxBackups       int           `yaml:"max_backups" json:"max_backups" env:"LOG_MAX_BACKUPS"`             // 最多保留的归档数量，0 表示不限制
+	Compress         bool          `yaml:"compress" json:"compress" env:"LOG_COMPRESS"`                      // 是否 gzip 压缩归档日志
+	MaxBodyBytes     int           `yaml:"max_body_bytes" json:"max_body_bytes" env:"LOG_MAX_BODY_BYTES"`    // 请求日志中记录的请求/响应体最大字节数
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled" env:"METRICS_ENABLED"`
+	Port        int    `yaml:"port" json:"port" env:"METRICS_PORT"`                                       // 独立监听端口，0 表示与API共用端口
+	BearerToken string `yaml:"bearer_token" json:"bearer_token" env:"METRICS_BEARER_TOKEN" secret:"true"` // /metrics 的独立认证令牌
+}
+
+// TracingConfig OpenTelemetry 链路追踪配置
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled" json:"enabled" env:"TRACING_ENABLED"`
+	Exporter    string  `yaml:"exporter" json:"exporter" env:"TRACING_EXPORTER"`             // otlp 或 file
+	Endpoint    string  `yaml:"endpoint" json:"endpoint" env:"TRACING_ENDPOINT"`             // OTLP/HTTP 地址，如 localhost:4318，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT
+	Insecure    bool    `yaml:"insecure" json:"insecure" env:"TRACING_INSECURE"`             // OTLP 使用 HTTP 而非 HTTPS
+	FilePath    string  `yaml:"file_path" json:"file_path" env:"TRACING_FILE"`               // file 导出器的输出文件，每行一个 span
+	SampleRatio float64 `yaml:"sample_ratio" json:"sample_ratio" env:"TRACING_SAMPLE_RATIO"` // 采样比例，上游已采样的请求始终记录
+}
+
+// RecorderConfig 流量录制配置，将每次对话的请求与 SSE 原文写入 JSONL 文件，便于离线回放
+type RecorderConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled" env:"RECORDER_ENABLED"`
+	FilePath string `yaml:"file_path" json:"file_path" env:"RECORDER_FILE"`
+}
+
+// UsageConfig 用量账本配置
+type UsageConfig struct {
+	Enabled     bool           `yaml:"enabled" json:"enabled" env:"USAGE_ENABLED"`
+	DBPath      string         `yaml:"db_path" json:"db_path" env:"USAGE_DB_PATH"`                // bbolt 数据库文件
+	CreditCosts map[string]int `yaml:"credit_costs" json:"credit_costs" env:"USAGE_CREDIT_COSTS"` // 每个模型单次请求消耗的 Monica 积分，Monica 不返回实际消耗
+}
+
+// FilesConfig 文件存储配置，记录 /v1/files 上传的文件
+type FilesConfig struct {
+	DBPath        string `yaml:"db_path" json:"db_path" env:"FILES_DB_PATH"`                      // bbolt 数据库文件
+	RetainContent bool   `yaml:"retain_content" json:"retain_content" env:"FILES_RETAIN_CONTENT"` // 在本地保留上传文件的副本，下载时不再经过 Monica CDN
+	ContentDir    string `yaml:"content_dir" json:"content_dir" env:"FILES_CONTENT_DIR"`          // 本地副本目录
+	UploadsDir    string `yaml:"uploads_dir" json:"uploads_dir" env:"FILES_UPLOADS_DIR"`          // /v1/uploads 分片的暂存目录
+
+	ProcessingTimeout time.Duration `yaml:"processing_timeout" json:"processing_timeout" env:"FILES_PROCESSING_TIMEOUT"` // 后台跟踪 Monica 解析状态的最长时间
+	ChatWaitTimeout   time.Duration `yaml:"chat_wait_timeout" json:"chat_wait_timeout" env:"FILES_CHAT_WAIT_TIMEOUT"`    // 对话引用仍在解析的文件时最多等待的时间
+	UploadExpiry      time.Duration `yaml:"upload_expiry" json:"upload_expiry" env:"FILES_UPLOAD_EXPIRY"`                // 未完成的分片上传保留的时间，期间可以续传
+}
+
+// AttachmentCacheConfig 附件缓存配置，按完整内容的哈希缓存已上传到 Monica 的文件信息
+type AttachmentCacheConfig struct {
+	MaxEntries int           `yaml:"max_entries" json:"max_entries" env:"ATTACHMENT_CACHE_MAX_ENTRIES"` // 内存中最多保留的条目数
+	TTL        time.Duration `yaml:"ttl" json:"ttl" env:"ATTACHMENT_CACHE_TTL"`                         // 条目有效期，应短于 Monica 文件地址的有效期
+	DBPath     string        `yaml:"db_path" json:"db_path" env:"ATTACHMENT_CACHE_DB_PATH"`             // 磁盘层的 bbolt 数据库文件，为空时只使用内存
+}
+
+// RedactionConfig 脱敏配置，作用于请求日志和流量录制
+type RedactionConfig struct {
+	Mode     string   `yaml:"mode" json:"mode" env:"REDACT_MODE"`                      // mask 替换为 ***，hash 替换为 HMAC-SHA256 前缀
+	Paths    []string `yaml:"paths" json:"paths" env:"REDACT_PATHS"`                   // JSON 路径规则，按 "." 分段，支持 * 通配和 ** 匹配任意层级，不区分大小写
+	Patterns []string `yaml:"patterns" json:"patterns" env:"REDACT_PATTERNS" sep:"\n"` // 文本中的敏感内容正则，含命名分组 v 时只替换该分组；环境变量中每行一条
 }
 
 // ProxyConfig 代理配置
 type ProxyConfig struct {
-	HTTPProxy  string `yaml:"http_proxy" json:"http_proxy"`
-	HTTPSProxy string `yaml:"https_proxy" json:"https_proxy"`
-	NoProxy    string `yaml:"no_proxy" json:"no_proxy"`
+	HTTPProxy  string `yaml:"http_proxy" json:"http_proxy" env:"HTTP_PROXY"`
+	HTTPSProxy string `yaml:"https_proxy" json:"https_proxy" env:"HTTPS_PROXY"`
+	NoProxy    string `yaml:"no_proxy" json:"no_proxy" env:"NO_PROXY"`
 }
 
-// Load 加载配置，优先级：配置文件 > 环境变量 > 默认值
-func Load() (*Config, error) {
-	// 1. 设置默认配置
-	config := getDefaultConfig()
+// URLFetchConfig 下载 URL 附件的限制。主机列表的条目可以是域名（同时匹配其子域名）、IP 或 CIDR
+type URLFetchConfig struct {
+	AllowHosts   []string      `yaml:"allow_hosts" json:"allow_hosts" env:"URL_FETCH_ALLOW_HOSTS"`       // 不为空时只允许这些主机，其中的 IP/CIDR 可以放行内网地址
+	DenyHosts    []string      `yaml:"deny_hosts" json:"deny_hosts" env:"URL_FETCH_DENY_HOSTS"`          // 始终拒绝的主机
+	AllowPrivate bool          `yaml:"allow_private" json:"allow_private" env:"URL_FETCH_ALLOW_PRIVATE"` // 允许访问内网、回环和链路本地地址
+	MaxSize      int           `yaml:"max_size" json:"max_size" env:"URL_FETCH_MAX_SIZE"`                // 响应体最大字节数
+	Timeout      time.Duration `yaml:"timeout" json:"timeout" env:"URL_FETCH_TIMEOUT"`                   // 单次下载的总超时，包括重定向
+	MaxRedirects int           `yaml:"max_redirects" json:"max_redirects" env:"URL_FETCH_MAX_REDIRECTS"`
+}
 
-	// 2. 尝试加载 .env 文件
-	_ = godotenv.Load()
+// Load 加载配置，优先级：环境变量 > CONFIG_FILE 指定的文件 > 自动查找的配置文件 > 默认值
+func Load() (*Config, error) {
+	return LoadWithOptions(Options{})
+}
 
-	// 3. 尝试加载配置文件
-	if err := loadConfigFile(config); err != nil {
-		// 配置文件加载失败不是致命错误，继续使用环境变量和默认值
-		fmt.Printf("Warning: Failed to load config file: %v\n", err)
+// LoadWithOptions 按 Resolve 的优先级加载配置并校验
+func LoadWithOptions(opts Options) (*Config, error) {
+	config, _, err := Resolve(opts)
+	if err != nil {
+		return nil, err
 	}
-
-	// 4. 环境变量覆盖
-	overrideWithEnv(config)
-
-	// 5. 验证配置
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("配置验证失败: %w", err)
 	}
-
 	return config, nil
 }
 
@@ -121,11 +231,15 @@ func GetDefaultConfig() *Config {
 			ReadTimeout:  5 * time.Minute,
 			WriteTimeout: 5 * time.Minute,
 			IdleTimeout:  60 * time.Second,
+
+			ShutdownGracePeriod: 30 * time.Second,
 		},
 		Monica: MonicaConfig{
 			Cookie:              "",
 			BotUID:              "",
 			EnableCustomBotMode: false,
+			FailoverEnabled:     false,
+			FallbackModel:       "",
 		},
 		Security: SecurityConfig{
 			TLSSkipVerify:    true,
@@ -148,12 +262,70 @@ func GetDefaultConfig() *Config {
 			Output:           "file", // 将在运行时替换为实际路径
 			EnableRequestLog: false, // 默认禁用详细请求日志，防止日志爆炸
 			MaskSensitive:    true,
+			MaxSizeMB:        100,
+			RotateInterval:   24 * time.Hour,
+			MaxAgeDays:       7,
+			MaxBackups:       5,
+			Compress:         true,
+			MaxBodyBytes:     4096,
 		},
 		Proxy: ProxyConfig{
 			HTTPProxy:  "",
 			HTTPSProxy: "",
 			NoProxy:    "",
 		},
+		Metrics: MetricsConfig{
+			Enabled: false,
+			Port:    0,
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			Exporter:    "otlp",
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			FilePath:    "traces.jsonl",
+			SampleRatio: 1.0,
+		},
+		Recorder: RecorderConfig{
+			Enabled:  false,
+			FilePath: "recordings.jsonl",
+		},
+		Usage: UsageConfig{
+			Enabled: true,
+			DBPath:  "usage.db",
+		},
+		Files: FilesConfig{
+			DBPath:            "files.db",
+			ContentDir:        "files",
+			UploadsDir:        "uploads",
+			ProcessingTimeout: 30 * time.Minute,
+			ChatWaitTimeout:   60 * time.Second,
+			UploadExpiry:      24 * time.Hour,
+		},
+		URLFetch: URLFetchConfig{
+			MaxSize:      50 * 1024 * 1024,
+			Timeout:      30 * time.Second,
+			MaxRedirects: 5,
+		},
+		AttachmentCache: AttachmentCacheConfig{
+			MaxEntries: 1000,
+			TTL:        12 * time.Hour,
+		},
+		Redaction: RedactionConfig{
+			Mode: "mask",
+			Paths: []string{
+				"**.*authorization*", "**.*cookie*", "**.*password*", "**.*secret*", "**.*credential*",
+				"**.api_key", "**.apikey", "**.api-key", "**.token", "**.*_token", "**.x-api-key",
+			},
+			Patterns: []string{
+				`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, // 邮箱
+				`(?:\+?86[- ]?)?\b1[3-9]\d{9}\b`,                 // 手机号
+				`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}`,              // OpenAI 风格 API Key
+				`\bAKIA[0-9A-Z]{16}\b`,                           // AWS Access Key
+				`(?i)bearer\s+(?P<v>[A-Za-z0-9._~+/=-]{8,})`,     // Bearer Token
+				`(?i)[?&](?:x-amz-signature|x-amz-credential|x-amz-security-token|signature|token|sig)=(?P<v>[^&"\s]+)`, // 预签名URL签名
+			},
+		},
 	}
 }
 
@@ -162,8 +334,18 @@ func getDefaultConfig() *Config {
 	return GetDefaultConfig()
 }
 
-// loadConfigFile 加载配置文件
-func loadConfigFile(config *Config) error {
+// FilePath 返回 Load 使用的配置文件路径：CONFIG_FILE 优先，否则按顺序查找本地文件，未找到时返回空字符串
+func FilePath() string {
+	path, _ := resolveFilePath()
+	return path
+}
+
+// resolveFilePath 返回配置文件路径及其来源（SourceConfigFile 或 SourceFile）
+func resolveFilePath() (string, string) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path, SourceConfigFile
+	}
+
 	configPaths := []string{
 		"config.yaml",
 		"config.yml",
@@ -172,19 +354,17 @@ func loadConfigFile(config *Config) error {
 		"./configs/config.yml",
 		"./configs/config.json",
 	}
-
 	for _, path := range configPaths {
 		if _, err := os.Stat(path); err == nil {
-			return loadFromFile(path, config)
+			return path, SourceFile
 		}
 	}
+	return "", SourceFile
+}
 
-	// 检查环境变量指定的配置文件
-	if configPath := os.Getenv("CONFIG_FILE"); configPath != "" {
-		return loadFromFile(configPath, config)
-	}
-
-	return fmt.Errorf("no config file found")
+// LoadFile 从指定文件加载配置，环境变量仍然覆盖文件中的值
+func LoadFile(path string) (*Config, error) {
+	return LoadWithOptions(Options{File: path})
 }
 
 // loadFromFile 从文件加载配置
@@ -211,116 +391,135 @@ func loadFromFile(path string, config *Config) error {
 	}
 }
 
-// overrideWithEnv 用环境变量覆盖配置
-func overrideWithEnv(config *Config) {
-	// 服务器配置
-	if host := os.Getenv("SERVER_HOST"); host != "" {
-		config.Server.Host = host
-	}
-	// 保持向后兼容，支持原来的PORT环境变量
-	if port := os.Getenv("PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil {
-			config.Server.Port = p
+// parseFallbacks 解析环境变量形式的模型降级链
+func parseFallbacks(value string) map[string][]string {
+	result := make(map[string][]string)
+	for _, entry := range splitNonEmpty(value, ";") {
+		model, chain, ok := strings.Cut(entry, "=")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" {
+			continue
 		}
+		result[model] = splitNonEmpty(chain, ",")
 	}
-	if port := os.Getenv("SERVER_PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil {
-			config.Server.Port = p
-		}
+	return result
+}
+
+// Validate 验证配置
+func (c *Config) Validate() error {
+	var errors []string
+
+	// 验证必要配置
+	if c.Monica.Cookie == "" {
+		errors = append(errors, "MONICA_COOKIE is required")
 	}
-	if timeout := os.Getenv("SERVER_READ_TIMEOUT"); timeout != "" {
-		if t, err := time.ParseDuration(timeout); err == nil {
-			config.Server.ReadTimeout = t
-		}
+	if c.Security.BearerToken == "" {
+		errors = append(errors, "BEARER_TOKEN is required")
 	}
 
-	// Monica 配置
-	if cookie := os.Getenv("MONICA_COOKIE"); cookie != "" {
-		config.Monica.Cookie = cookie
+	// 管理令牌能重载配置和导出用量，不能与普通 API 客户端共用
+	if c.Security.AdminToken != "" && c.Security.AdminToken == c.Security.BearerToken {
+		errors = append(errors, "ADMIN_TOKEN must differ from BEARER_TOKEN")
 	}
-	if botUID := os.Getenv("BOT_UID"); botUID != "" {
-		config.Monica.BotUID = botUID
-	}
-	if enableCustomBot := os.Getenv("ENABLE_CUSTOM_BOT_MODE"); enableCustomBot != "" {
-		if enabled, err := strconv.ParseBool(enableCustomBot); err == nil {
-			config.Monica.EnableCustomBotMode = enabled
-		}
+
+	// 如果启用了 Custom Bot 模式，必须设置 BOT_UID
+	if c.Monica.EnableCustomBotMode && c.Monica.BotUID == "" {
+		errors = append(errors, "BOT_UID is required when ENABLE_CUSTOM_BOT_MODE is true")
 	}
 
-	// 安全配置
-	if token := os.Getenv("BEARER_TOKEN"); token != "" {
-		config.Security.BearerToken = token
+	// 验证端口范围
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errors = append(errors, "SERVER_PORT must be between 1 and 65535")
 	}
-	if skipVerify := os.Getenv("TLS_SKIP_VERIFY"); skipVerify != "" {
-		if skip, err := strconv.ParseBool(skipVerify); err == nil {
-			config.Security.TLSSkipVerify = skip
+
+	// 验证指标端口
+	if c.Metrics.Enabled && c.Metrics.Port != 0 {
+		if c.Metrics.Port < 1 || c.Metrics.Port > 65535 {
+			errors = append(errors, "METRICS_PORT must be between 1 and 65535")
+		} else if c.Metrics.Port == c.Server.Port {
+			errors = append(errors, "METRICS_PORT must differ from SERVER_PORT, use 0 to share the API port")
 		}
 	}
-	if rateLimitEnabled := os.Getenv("RATE_LIMIT_ENABLED"); rateLimitEnabled != "" {
-		if enabled, err := strconv.ParseBool(rateLimitEnabled); err == nil {
-			config.Security.RateLimitEnabled = enabled
+
+	// 验证链路追踪配置
+	if c.Tracing.Enabled {
+		switch c.Tracing.Exporter {
+		case "otlp":
+		case "file":
+			if c.Tracing.FilePath == "" {
+				errors = append(errors, "TRACING_FILE is required when TRACING_EXPORTER is file")
+			}
+		default:
+			errors = append(errors, "TRACING_EXPORTER must be one of: otlp, file")
 		}
-	}
-	if rateLimitRPS := os.Getenv("RATE_LIMIT_RPS"); rateLimitRPS != "" {
-		if rps, err := strconv.Atoi(rateLimitRPS); err == nil {
-			config.Security.RateLimitRPS = rps
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			errors = append(errors, "TRACING_SAMPLE_RATIO must be between 0 and 1")
 		}
 	}
 
-	// 日志配置
-	if level := os.Getenv("LOG_LEVEL"); level != "" {
-		config.Logging.Level = level
+	if c.Usage.Enabled && c.Usage.DBPath == "" {
+		errors = append(errors, "USAGE_DB_PATH is required when USAGE_ENABLED is true")
 	}
-	if format := os.Getenv("LOG_FORMAT"); format != "" {
-		config.Logging.Format = format
+	if c.Files.DBPath == "" {
+		errors = append(errors, "FILES_DB_PATH is required")
 	}
-	if output := os.Getenv("LOG_OUTPUT"); output != "" {
-		config.Logging.Output = output
+	if c.Files.ProcessingTimeout <= 0 {
+		errors = append(errors, "FILES_PROCESSING_TIMEOUT must be positive")
 	}
-	if enableRequestLog := os.Getenv("ENABLE_REQUEST_LOG"); enableRequestLog != "" {
-		if enabled, err := strconv.ParseBool(enableRequestLog); err == nil {
-			config.Logging.EnableRequestLog = enabled
-		}
+	if c.Files.ChatWaitTimeout < 0 {
+		errors = append(errors, "FILES_CHAT_WAIT_TIMEOUT cannot be negative")
 	}
-	
-	// 代理配置
-	if httpProxy := os.Getenv("HTTP_PROXY"); httpProxy != "" {
-		config.Proxy.HTTPProxy = httpProxy
+	if c.Files.UploadsDir == "" {
+		errors = append(errors, "FILES_UPLOADS_DIR is required")
 	}
-	if httpsProxy := os.Getenv("HTTPS_PROXY"); httpsProxy != "" {
-		config.Proxy.HTTPSProxy = httpsProxy
+	if c.Files.UploadExpiry <= 0 {
+		errors = append(errors, "FILES_UPLOAD_EXPIRY must be positive")
 	}
-	if noProxy := os.Getenv("NO_PROXY"); noProxy != "" {
-		config.Proxy.NoProxy = noProxy
+	if c.URLFetch.MaxSize <= 0 {
+		errors = append(errors, "URL_FETCH_MAX_SIZE must be positive")
 	}
-}
-
-// Validate 验证配置
-func (c *Config) Validate() error {
-	var errors []string
-
-	// 验证必要配置
-	if c.Monica.Cookie == "" {
-		errors = append(errors, "MONICA_COOKIE is required")
+	if c.URLFetch.Timeout <= 0 {
+		errors = append(errors, "URL_FETCH_TIMEOUT must be positive")
 	}
-	if c.Security.BearerToken == "" {
-		errors = append(errors, "BEARER_TOKEN is required")
+	if c.URLFetch.MaxRedirects < 0 {
+		errors = append(errors, "URL_FETCH_MAX_REDIRECTS cannot be negative")
 	}
-
-	// 如果启用了 Custom Bot 模式，必须设置 BOT_UID
-	if c.Monica.EnableCustomBotMode && c.Monica.BotUID == "" {
-		errors = append(errors, "BOT_UID is required when ENABLE_CUSTOM_BOT_MODE is true")
+	if c.AttachmentCache.MaxEntries <= 0 {
+		errors = append(errors, "ATTACHMENT_CACHE_MAX_ENTRIES must be positive")
 	}
-
-	// 验证端口范围
-	if c.Server.Port < 1 || c.Server.Port > 65535 {
-		errors = append(errors, "SERVER_PORT must be between 1 and 65535")
+	if c.AttachmentCache.TTL <= 0 {
+		errors = append(errors, "ATTACHMENT_CACHE_TTL must be positive")
+	}
+	if c.Files.RetainContent && c.Files.ContentDir == "" {
+		errors = append(errors, "FILES_CONTENT_DIR is required when FILES_RETAIN_CONTENT is true")
+	}
+	if c.Redaction.Mode != "" && c.Redaction.Mode != "mask" && c.Redaction.Mode != "hash" {
+		errors = append(errors, "REDACT_MODE must be one of: mask, hash")
+	}
+	for _, p := range c.Redaction.Paths {
+		for _, segment := range strings.Split(p, ".") {
+			if _, err := path.Match(segment, ""); err != nil {
+				errors = append(errors, fmt.Sprintf("invalid redaction path %q: %v", p, err))
+				break
+			}
+		}
+	}
+	for _, p := range c.Redaction.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid redaction pattern %q: %v", p, err))
+		}
+	}
+	if c.Recorder.Enabled && c.Recorder.FilePath == "" {
+		errors = append(errors, "RECORDER_FILE is required when RECORDER_ENABLED is true")
 	}
 
 	// 验证超时配置
 	if c.Server.ReadTimeout < 0 {
 		errors = append(errors, "SERVER_READ_TIMEOUT must be positive")
 	}
+	if c.Server.ShutdownGracePeriod < 0 {
+		errors = append(errors, "SERVER_SHUTDOWN_GRACE_PERIOD must be positive")
+	}
 	if c.HTTPClient.Timeout < 0 {
 		errors = append(errors, "HTTP_CLIENT_TIMEOUT must be positive")
 	}
@@ -337,11 +536,30 @@ func (c *Config) Validate() error {
 		errors = append(errors, "RATE_LIMIT_RPS should not exceed 10000 for performance reasons")
 	}
 
+	// 验证模型降级链
+	for model, chain := range c.Fallbacks {
+		for _, fallback := range chain {
+			if fallback == "" || fallback == model {
+				errors = append(errors, fmt.Sprintf("fallbacks.%s contains an empty or self-referencing model", model))
+				break
+			}
+		}
+	}
+
 	// 验证日志级别
 	validLevels := []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"}
 	if !contains(validLevels, c.Logging.Level) {
 		errors = append(errors, fmt.Sprintf("LOG_LEVEL must be one of: %s", strings.Join(validLevels, ", ")))
 	}
+	if c.Logging.MaxSizeMB < 0 || c.Logging.MaxAgeDays < 0 || c.Logging.MaxBackups < 0 {
+		errors = append(errors, "LOG_MAX_SIZE_MB, LOG_MAX_AGE_DAYS and LOG_MAX_BACKUPS must not be negative")
+	}
+	if c.Logging.RotateInterval < 0 {
+		errors = append(errors, "LOG_ROTATE_INTERVAL must not be negative")
+	}
+	if c.Logging.MaxBodyBytes < 0 {
+		errors = append(errors, "LOG_MAX_BODY_BYTES must not be negative")
+	}
 
 	if len(errors) > 0 {
 		return fmt.Errorf("%s", strings.Join(errors, "; "))
@@ -350,11 +568,92 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// GetMetricsAddress 获取独立指标服务的监听地址
+func (c *Config) GetMetricsAddress() string {
+	return fmt.Sprintf("%s:%d", c.Server.Host, c.Metrics.Port)
+}
+
+// MonicaCookies 返回按优先级排列的账号Cookie列表，主Cookie在前，备用Cookie去重后依次排列
+func (c *Config) MonicaCookies() []string {
+	cookies := make([]string, 0, 1+len(c.Monica.BackupCookies))
+	seen := make(map[string]struct{}, 1+len(c.Monica.BackupCookies))
+	for _, cookie := range append([]string{c.Monica.Cookie}, c.Monica.BackupCookies...) {
+		cookie = strings.TrimSpace(cookie)
+		if cookie == "" {
+			continue
+		}
+		if _, ok := seen[cookie]; ok {
+			continue
+		}
+		seen[cookie] = struct{}{}
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
+
+// ModelChain 返回请求模型及其降级模型的尝试顺序（去重）。
+// 降级链之后，开启故障转移时追加全局的 FallbackModel
+func (c *Config) ModelChain(model string) []string {
+	candidates := append([]string{model}, c.Fallbacks[model]...)
+	if c.Monica.FailoverEnabled && c.Monica.FallbackModel != "" {
+		candidates = append(candidates, c.Monica.FallbackModel)
+	}
+
+	chain := make([]string, 0, len(candidates))
+	seen := make(map[string]struct{}, len(candidates))
+	for _, m := range candidates {
+		if _, ok := seen[m]; ok || m == "" {
+			continue
+		}
+		seen[m] = struct{}{}
+		chain = append(chain, m)
+	}
+	return chain
+}
+
+// DataPath 将相对路径解析到数据目录下，空路径和绝对路径原样返回
+func (c *Config) DataPath(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	dir := c.DataDir
+	if dir == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return p
+		}
+		dir = filepath.Join(userHome, ".monica-proxy")
+	}
+	return filepath.Join(dir, p)
+}
+
+// WithDataPaths 返回配置的副本，其中账本、文件存储和附件缓存的路径已解析到数据目录下
+func (c *Config) WithDataPaths() *Config {
+	resolved := *c
+	resolved.Usage.DBPath = c.DataPath(c.Usage.DBPath)
+	resolved.Files.DBPath = c.DataPath(c.Files.DBPath)
+	resolved.Files.ContentDir = c.DataPath(c.Files.ContentDir)
+	resolved.Files.UploadsDir = c.DataPath(c.Files.UploadsDir)
+	resolved.AttachmentCache.DBPath = c.DataPath(c.AttachmentCache.DBPath)
+	return &resolved
+}
+
 // GetAddress 获取服务器监听地址
 func (c *Config) GetAddress() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 }
 
+// splitNonEmpty 按分隔符拆分字符串并去掉空白项
+func splitNonEmpty(s, sep string) []string {
+	var result []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
 // contains 检查字符串是否在切片中
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDataPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	abs := filepath.Join(t.TempDir(), "usage.db")
+
+	tests := []struct {
+		name    string
+		dataDir string
+		path    string
+		want    string
+	}{
+		{"empty path", "/data", "", ""},
+		{"absolute path", "/data", abs, abs},
+		{"relative under data dir", "/data", "usage.db", filepath.Join("/data", "usage.db")},
+		{"nested relative", "/data", "files/content", filepath.Join("/data", "files", "content")},
+		{"default data dir", "", "usage.db", filepath.Join(home, ".monica-proxy", "usage.db")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{DataDir: tt.dataDir}
+			if got := cfg.DataPath(tt.path); got != tt.want {
+				t.Errorf("DataPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithDataPaths(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.DataDir = "/data"
+	resolved := cfg.WithDataPaths()
+
+	if resolved.Usage.DBPath != filepath.Join("/data", "usage.db") {
+		t.Errorf("usage db path = %q", resolved.Usage.DBPath)
+	}
+	if resolved.Files.UploadsDir != filepath.Join("/data", "uploads") {
+		t.Errorf("uploads dir = %q", resolved.Files.UploadsDir)
+	}
+	// 为空表示只使用内存，不应被解析成目录
+	if resolved.AttachmentCache.DBPath != "" {
+		t.Errorf("attachment cache db path = %q, want empty", resolved.AttachmentCache.DBPath)
+	}
+	if cfg.Usage.DBPath != "usage.db" {
+		t.Errorf("original config modified: %q", cfg.Usage.DBPath)
+	}
+}
+
+func TestMonicaCookies(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		backups []string
+		want    []string
+	}{
+		{"primary only", "a", nil, []string{"a"}},
+		{"backups in order", "a", []string{"b", "c"}, []string{"a", "b", "c"}},
+		{"duplicates and blanks removed", "a", []string{" b ", "a", "", "b"}, []string{"a", "b"}},
+		{"no primary", "", []string{"b"}, []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Monica: MonicaConfig{Cookie: tt.primary, BackupCookies: tt.backups}}
+			if got := cfg.MonicaCookies(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MonicaCookies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelChain(t *testing.T) {
+	fallbacks := map[string][]string{
+		"claude-4-opus": {"claude-4-sonnet", "gpt-4.1"},
+		"gpt-5":         {"gpt-4.1", "gpt-5", "gpt-4.1"},
+	}
+	tests := []struct {
+		name          string
+		model         string
+		failover      bool
+		fallbackModel string
+		want          []string
+	}{
+		{"no chain", "gpt-4o", false, "", []string{"gpt-4o"}},
+		{"chain in order", "claude-4-opus", false, "", []string{"claude-4-opus", "claude-4-sonnet", "gpt-4.1"}},
+		{"duplicates removed", "gpt-5", false, "", []string{"gpt-5", "gpt-4.1"}},
+		{"global fallback appended", "claude-4-opus", true, "gpt-4o-mini", []string{"claude-4-opus", "claude-4-sonnet", "gpt-4.1", "gpt-4o-mini"}},
+		{"global fallback needs failover", "gpt-4o", false, "gpt-4o-mini", []string{"gpt-4o"}},
+		{"global fallback already in chain", "claude-4-opus", true, "gpt-4.1", []string{"claude-4-opus", "claude-4-sonnet", "gpt-4.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Fallbacks: fallbacks}
+			cfg.Monica.FailoverEnabled = tt.failover
+			cfg.Monica.FallbackModel = tt.fallbackModel
+			if got := cfg.ModelChain(tt.model); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ModelChain = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAdminToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		wantErr    bool
+	}{
+		{"admin routes disabled", "", false},
+		{"separate admin token", "admin", false},
+		{"shared with api clients", "token", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := GetDefaultConfig()
+			cfg.Monica.Cookie = "cookie"
+			cfg.Security.BearerToken = "token"
+			cfg.Security.AdminToken = tt.adminToken
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFallbacks(t *testing.T) {
+	tests := []struct {
+		name      string
+		fallbacks map[string][]string
+		wantErr   bool
+	}{
+		{"valid", map[string][]string{"gpt-5": {"gpt-4.1"}}, false},
+		{"self reference", map[string][]string{"gpt-5": {"gpt-5"}}, true},
+		{"empty entry", map[string][]string{"gpt-5": {""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := GetDefaultConfig()
+			cfg.Monica.Cookie = "cookie"
+			cfg.Security.BearerToken = "token"
+			cfg.Fallbacks = tt.fallbacks
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Holder 持有当前生效的配置。服务在每个请求开始时通过 Get 读取配置，
+// 热重载时整体原子替换，进行中的请求继续使用旧配置
+type Holder struct {
+	current atomic.Pointer[Config]
+	source  func() (*Config, error)
+
+	mu        sync.Mutex // 串行化重载
+	listeners []func(old, new *Config)
+}
+
+// NewHolder 创建配置持有者；source 用于重载时重新读取配置，为 nil 时不支持重载
+func NewHolder(cfg *Config, source func() (*Config, error)) *Holder {
+	h := &Holder{source: source}
+	h.current.Store(cfg)
+	return h
+}
+
+// Get 返回当前配置，调用方不应修改返回值
+func (h *Holder) Get() *Config {
+	return h.current.Load()
+}
+
+// OnChange 注册配置替换后的回调，回调在重载的调用方协程中执行
+func (h *Holder) OnChange(fn func(old, new *Config)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// Reload 重新读取并校验配置，校验通过才替换；失败时保留原配置并返回错误
+func (h *Holder) Reload() (*Config, error) {
+	if h.source == nil {
+		return nil, fmt.Errorf("config reload is not supported")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cfg, err := h.source()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+
+	old := h.current.Swap(cfg)
+	for _, fn := range h.listeners {
+		fn(old, cfg)
+	}
+	return cfg, nil
+}
+
+// Watch 轮询配置文件的修改时间和大小，变化后自动重载，每次重载的结果通过 report 回调；
+// 轮询可以兼容编辑器先写临时文件再重命名的保存方式。返回的函数用于停止监听
+func (h *Holder) Watch(path string, interval time.Duration, report func(error)) (stop func()) {
+	done := make(chan struct{})
+	last, _ := os.Stat(path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil || sameFile(last, info) {
+				continue
+			}
+			last = info
+
+			_, err = h.Reload()
+			if report != nil {
+				report(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// encryptedPrefix 加密后的敏感值前缀，其后为 base64(nonce + AES-256-GCM 密文)
+const encryptedPrefix = "enc:v1:"
+
+// keyFileEnv 指定密钥文件路径的环境变量，未设置时使用配置文件所在目录下的 secret.key
+const keyFileEnv = "MONICA_PROXY_KEY_FILE"
+
+// SourceSecretFile 值读取自 cookie_file/bearer_token_file 引用的文件
+const SourceSecretFile = "secret_file"
+
+// fileValue 字段在配置文件中的原始写法，以及加载完成后的实际值
+type fileValue struct {
+	raw      []string
+	resolved []string
+}
+
+// envRef 匹配 ${NAME} 和 ${NAME:-默认值}
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolate 将文本中的 ${NAME} 替换为环境变量，未设置时使用默认值
+func interpolate(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return envRef.ReplaceAllStringFunc(s, func(match string) string {
+		sub := envRef.FindStringSubmatch(match)
+		if value, ok := os.LookupEnv(sub[1]); ok && value != "" {
+			return value
+		}
+		return sub[2]
+	})
+}
+
+// KeyFile 返回加密配置文件中敏感字段使用的密钥文件路径
+func KeyFile(configPath string) string {
+	if path := os.Getenv(keyFileEnv); path != "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(configPath), "secret.key")
+}
+
+// redactionKeyLabel 从密钥文件派生脱敏 HMAC 密钥时使用的标签，避免直接复用加密密钥
+const redactionKeyLabel = "monica-proxy redaction"
+
+// RedactionKey 返回 hash 脱敏模式使用的 HMAC 密钥，由密钥文件派生，每个安装不同；
+// 未加载配置文件时使用数据目录下的 secret.key，密钥文件不存在时自动生成
+func (c *Config) RedactionKey() ([]byte, error) {
+	path := c.keyFile
+	if path == "" {
+		path = os.Getenv(keyFileEnv)
+	}
+	if path == "" {
+		path = c.DataPath("secret.key")
+	}
+	key, err := loadKey(path, true)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(redactionKeyLabel))
+	return mac.Sum(nil), nil
+}
+
+// loadKey 读取密钥文件，create 为 true 且文件不存在时生成新密钥
+func loadKey(path string, create bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(key)
+		if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("创建密钥文件失败: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("密钥文件 %s 格式错误", path)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret 使用 AES-256-GCM 加密敏感值
+func encryptSecret(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密 encryptSecret 生成的密文
+func decryptSecret(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("密文格式错误")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败，密钥文件可能不匹配")
+	}
+	return string(plain), nil
+}
+
+// expandFileValues 处理配置文件中读出的值：展开 ${NAME}，解密敏感字段，并记录敏感字段和含引用字段的原始写法
+func expandFileValues(config *Config, path string) error {
+	var key []byte
+	for _, b := range Bindings() {
+		field := reflect.ValueOf(config).Elem().FieldByIndex(b.index)
+		values, ok := stringValues(field)
+		if !ok {
+			continue
+		}
+		raw := append([]string(nil), values...)
+
+		for i, value := range values {
+			value = interpolate(value)
+			if b.Secret && strings.HasPrefix(value, encryptedPrefix) {
+				if key == nil {
+					var err error
+					if key, err = loadKey(KeyFile(path), false); err != nil {
+						return fmt.Errorf("%s 已加密: %w", b.Path, err)
+					}
+				}
+				plain, err := decryptSecret(key, value)
+				if err != nil {
+					return fmt.Errorf("%s: %w", b.Path, err)
+				}
+				value = plain
+			}
+			values[i] = value
+		}
+		setStringValues(field, values)
+
+		if b.Secret || !reflect.DeepEqual(raw, values) {
+			if config.fileValues == nil {
+				config.fileValues = make(map[string]fileValue)
+			}
+			config.fileValues[b.Path] = fileValue{raw: raw}
+		}
+	}
+	return nil
+}
+
+// resolveSecretFiles 敏感字段为空时读取 *_file 引用的文件
+func resolveSecretFiles(config *Config, sources Sources) error {
+	refs := []struct {
+		path  string
+		value *string
+		file  string
+	}{
+		{"monica.cookie", &config.Monica.Cookie, config.Monica.CookieFile},
+		{"security.bearer_token", &config.Security.BearerToken, config.Security.BearerTokenFile},
+	}
+	for _, ref := range refs {
+		if *ref.value != "" || ref.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(ref.file)
+		if err != nil {
+			return fmt.Errorf("读取 %s 引用的文件失败: %w", ref.path, err)
+		}
+		*ref.value = strings.TrimSpace(string(data))
+		sources[ref.path] = Source{Kind: SourceSecretFile, Name: ref.file}
+	}
+	return nil
+}
+
+// recordResolvedValues 记录加载完成后的值，保存时未修改的字段写回原始写法；
+// 敏感字段即使不在配置文件中也记录，避免把环境变量或 *_file 中的值写入文件
+func recordResolvedValues(config *Config) {
+	if config.fileValues == nil {
+		config.fileValues = make(map[string]fileValue)
+	}
+	for _, b := range Bindings() {
+		ref, ok := config.fileValues[b.Path]
+		if !ok && !b.Secret {
+			continue
+		}
+		values, isString := stringValues(reflect.ValueOf(config).Elem().FieldByIndex(b.index))
+		if !isString {
+			continue
+		}
+		ref.resolved = values
+		config.fileValues[b.Path] = ref
+	}
+}
+
+// Save 将配置写入文件，权限为 0600。敏感字段使用密钥文件加密；
+// 未修改的字段保留文件中原来的 ${NAME} 引用或密文，来自环境变量和 *_file 的敏感值不会写入文件
+func Save(cfg *Config, path string) error {
+	out := *cfg
+	var key []byte
+	written := make(map[string]fileValue)
+
+	for _, b := range Bindings() {
+		field := reflect.ValueOf(&out).Elem().FieldByIndex(b.index)
+		current, ok := stringValues(field)
+		if !ok {
+			continue
+		}
+
+		values := append([]string(nil), current...)
+		ref, loaded := cfg.fileValues[b.Path]
+		if loaded && reflect.DeepEqual(current, ref.resolved) {
+			values = append([]string(nil), ref.raw...)
+		}
+		if !b.Secret {
+			if loaded {
+				setStringValues(field, values)
+				written[b.Path] = fileValue{raw: values, resolved: current}
+			}
+			continue
+		}
+		for i, value := range values {
+			if value == "" || strings.HasPrefix(value, encryptedPrefix) || envRef.MatchString(value) {
+				continue
+			}
+			if key == nil {
+				var err error
+				if key, err = loadKey(KeyFile(path), true); err != nil {
+					return err
+				}
+			}
+			encrypted, err := encryptSecret(key, value)
+			if err != nil {
+				return err
+			}
+			values[i] = encrypted
+		}
+		setStringValues(field, values)
+		written[b.Path] = fileValue{raw: values, resolved: current}
+	}
+
+	data, err := yaml.Marshal(&out)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return err
+	}
+	cfg.fileValues = written
+	return nil
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免热重载读到写了一半的配置
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// stringValues 返回字符串或字符串列表字段的值
+func stringValues(field reflect.Value) ([]string, bool) {
+	switch v := field.Interface().(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return append([]string(nil), v...), true
+	}
+	return nil, false
+}
+
+func setStringValues(field reflect.Value, values []string) {
+	if field.Kind() == reflect.String {
+		if len(values) == 0 {
+			field.SetString("")
+		} else {
+			field.SetString(values[0])
+		}
+		return
+	}
+	if len(values) == 0 && field.IsNil() {
+		return
+	}
+	field.Set(reflect.ValueOf(values))
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// isolateSecretEnv 清空会覆盖配置文件中敏感字段的环境变量，密钥文件放在临时目录
+func isolateSecretEnv(t *testing.T) string {
+	t.Helper()
+	for _, name := range []string{"MONICA_COOKIE", "MONICA_BACKUP_COOKIES", "BEARER_TOKEN", "METRICS_BEARER_TOKEN", "ADMIN_TOKEN", "CONFIG_FILE"} {
+		t.Setenv(name, "")
+	}
+	dir := t.TempDir()
+	t.Setenv(keyFileEnv, filepath.Join(dir, "secret.key"))
+	return dir
+}
+
+func TestEncryptSecret(t *testing.T) {
+	key := make([]byte, 32)
+	other := make([]byte, 32)
+	other[0] = 1
+
+	encrypted, err := encryptSecret(key, "cookie=value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, encryptedPrefix) {
+		t.Fatalf("encrypted = %q", encrypted)
+	}
+	if again, _ := encryptSecret(key, "cookie=value"); again == encrypted {
+		t.Error("nonce reused across encryptions")
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"round trip", key, encrypted, "cookie=value", false},
+		{"wrong key", other, encrypted, "", true},
+		{"not base64", key, encryptedPrefix + "!!!", "", true},
+		{"too short", key, encryptedPrefix + "AAAA", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptSecret(tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("plain = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TEST_SET", "value")
+	t.Setenv("TEST_EMPTY", "")
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"${TEST_SET}", "value"},
+		{"pre-${TEST_SET}-post", "pre-value-post"},
+		{"${TEST_UNSET_VARIABLE}", ""},
+		{"${TEST_UNSET_VARIABLE:-fallback}", "fallback"},
+		{"${TEST_EMPTY:-fallback}", "fallback"},
+		{"$TEST_SET", "$TEST_SET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := interpolate(tt.in); got != tt.want {
+				t.Errorf("interpolate(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveEncryptsSecrets(t *testing.T) {
+	dir := isolateSecretEnv(t)
+	path := filepath.Join(dir, "config.yaml")
+
+	cfg := GetDefaultConfig()
+	cfg.Monica.Cookie = "session=primary"
+	cfg.Monica.BackupCookies = []string{"session=backup1", "session=backup2"}
+	cfg.Security.BearerToken = "sk-local"
+	cfg.Server.Host = "127.0.0.1"
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"session=primary", "session=backup1", "sk-local"} {
+		if strings.Contains(string(data), plain) {
+			t.Errorf("config file contains plaintext %q", plain)
+		}
+	}
+	for _, p := range []string{path, os.Getenv(keyFileEnv)} {
+		if info, err := os.Stat(p); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, err %v", p, info, err)
+		}
+	}
+
+	loaded, sources, err := Resolve(Options{File: path})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if loaded.Monica.Cookie != cfg.Monica.Cookie || loaded.Security.BearerToken != cfg.Security.BearerToken ||
+		!reflect.DeepEqual(loaded.Monica.BackupCookies, cfg.Monica.BackupCookies) || loaded.Server.Host != "127.0.0.1" {
+		t.Errorf("round trip mismatch: %+v %+v", loaded.Monica, loaded.Security)
+	}
+	if sources["monica.cookie"].Kind != SourceConfigFile {
+		t.Errorf("cookie source = %v", sources["monica.cookie"])
+	}
+
+	// 未修改的密文原样写回，不重新加密
+	if err := Save(loaded, path); err != nil {
+		t.Fatalf("second Save: %v", err)
+	}
+	if again, _ := os.ReadFile(path); string(again) != string(data) {
+		t.Error("unchanged config rewritten with different content")
+	}
+
+	// 密钥文件不匹配时加载失败
+	t.Setenv(keyFileEnv, filepath.Join(t.TempDir(), "other.key"))
+	if _, err := loadKey(os.Getenv(keyFileEnv), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Resolve(Options{File: path}); err == nil {
+		t.Error("expected error with mismatched key file")
+	}
+}
+
+func TestSavePreservesFileReferences(t *testing.T) {
+	dir := isolateSecretEnv(t)
+	path := filepath.Join(dir, "config.yaml")
+	tokenFile := filepath.Join(dir, "token")
+	os.WriteFile(tokenFile, []byte("sk-from-file\n"), 0600)
+	content := "monica:\n  cookie: ${TEST_MONICA_COOKIE}\nserver:\n  host: ${TEST_SERVER_HOST:-0.0.0.0}\nsecurity:\n  bearer_token_file: " + tokenFile + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_MONICA_COOKIE", "session=env")
+	t.Setenv("METRICS_BEARER_TOKEN", "metrics-from-env")
+
+	cfg, sources, err := Resolve(Options{File: path})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	tests := []struct {
+		name   string
+		got    string
+		want   string
+		source Source
+	}{
+		{"monica.cookie", cfg.Monica.Cookie, "session=env", Source{Kind: SourceConfigFile, Name: path}},
+		{"server.host", cfg.Server.Host, "0.0.0.0", Source{Kind: SourceConfigFile, Name: path}},
+		{"security.bearer_token", cfg.Security.BearerToken, "sk-from-file", Source{Kind: SourceSecretFile, Name: tokenFile}},
+		{"metrics.bearer_token", cfg.Metrics.BearerToken, "metrics-from-env", Source{Kind: SourceEnv, Name: "METRICS_BEARER_TOKEN"}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+		if sources[tt.name] != tt.source {
+			t.Errorf("%s source = %v, want %v", tt.name, sources[tt.name], tt.source)
+		}
+	}
+
+	cfg.Logging.Level = "debug"
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	saved := string(data)
+	for _, want := range []string{"${TEST_MONICA_COOKIE}", "${TEST_SERVER_HOST:-0.0.0.0}", "level: debug"} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config missing %q", want)
+		}
+	}
+	// 来自 *_file 和环境变量的敏感值不写入配置文件
+	for _, leaked := range []string{"session=env", "sk-from-file", "metrics-from-env", encryptedPrefix} {
+		if strings.Contains(saved, leaked) {
+			t.Errorf("saved config contains %q", leaked)
+		}
+	}
+}
+
+func TestRedactionKey(t *testing.T) {
+	dir := isolateSecretEnv(t)
+	cfg := GetDefaultConfig()
+
+	key, err := cfg.RedactionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := loadKey(filepath.Join(dir, "secret.key"), false)
+	if err != nil {
+		t.Fatalf("key file not created: %v", err)
+	}
+	if len(key) != 32 || reflect.DeepEqual(key, master) {
+		t.Error("redaction key is not derived from the key file")
+	}
+	again, _ := cfg.RedactionKey()
+	if !reflect.DeepEqual(key, again) {
+		t.Error("redaction key changes between calls")
+	}
+
+	t.Setenv(keyFileEnv, filepath.Join(dir, "other.key"))
+	if other, _ := cfg.RedactionKey(); reflect.DeepEqual(key, other) {
+		t.Error("different key files derive the same redaction key")
+	}
+}
@@ -78,6 +78,16 @@ func NewBadRequestError(message string, err error) *AppError {
 	}
 }
 
+// NewUnprocessableError 创建请求格式正确但内容无法处理的错误，如配置文件校验失败
+func NewUnprocessableError(message string, err error) *AppError {
+	return &AppError{
+		Code:    ErrInvalidInput,
+		Message: message,
+		Err:     err,
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
 // NewUnauthorizedError 创建未授权错误
 func NewUnauthorizedError(message string) *AppError {
 	return &AppError{
@@ -87,6 +97,15 @@ func NewUnauthorizedError(message string) *AppError {
 	}
 }
 
+// NewNotFoundError 创建资源不存在错误
+func NewNotFoundError(message string) *AppError {
+	return &AppError{
+		Code:    ErrNotFound,
+		Message: message,
+		Status:  http.StatusNotFound,
+	}
+}
+
 // NewInvalidInputError 创建无效输入错误
 func NewInvalidInputError(message string, err error) *AppError {
 	return &AppError{
@@ -126,6 +145,15 @@ func NewRequestFailedError(message string, err error) *AppError {
 	}
 }
 
+// NewUpstreamStatusError 创建沿用上游状态码的错误，用于将上游的 4xx 透传给客户端
+func NewUpstreamStatusError(message string, status int) *AppError {
+	return &AppError{
+		Code:    ErrRequestFailed,
+		Message: message,
+		Status:  status,
+	}
+}
+
 // NewModelMappingError 创建模型映射错误
 func NewModelMappingError(model string) *AppError {
 	return &AppError{
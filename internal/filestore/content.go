@@ -0,0 +1,51 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ContentDir 本地副本所在目录
+func (s *Store) ContentDir() string {
+	return s.contentDir
+}
+
+// SaveContent 将文件内容保存为本地副本并返回其路径，权限为 0600
+func (s *Store) SaveContent(id string, content io.Reader) (string, error) {
+	if err := os.MkdirAll(s.contentDir, 0700); err != nil {
+		return "", fmt.Errorf("create content directory failed: %w", err)
+	}
+	// 文件ID来自 Monica，只取最后一段防止路径穿越
+	path := filepath.Join(s.contentDir, filepath.Base(id))
+
+	tmp, err := os.CreateTemp(s.contentDir, "."+filepath.Base(id)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// RemoveContent 删除本地副本，不存在时忽略
+func RemoveContent(path string) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package filestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"monica-proxy/internal/config"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	current atomic.Pointer[Store]
+	initMu  sync.Mutex
+)
+
+// Init 按配置打开全局存储；路径未变化时复用已打开的存储。新存储打开成功后才替换并关闭旧存储，
+// 打开失败时继续使用旧存储
+func Init(cfg *config.Config) error {
+	initMu.Lock()
+	defer initMu.Unlock()
+
+	old := current.Load()
+	if old != nil && old.Path() == cfg.Files.DBPath {
+		if old.ContentDir() != cfg.Files.ContentDir || old.uploadsDir != cfg.Files.UploadsDir {
+			// bbolt 文件独占锁，同一文件不能再次打开，只更新目录并共用数据库
+			current.Store(&Store{db: old.db, path: old.path, contentDir: cfg.Files.ContentDir, uploadsDir: cfg.Files.UploadsDir})
+		}
+		return nil
+	}
+
+	store, err := Open(cfg.Files)
+	if err != nil {
+		return err
+	}
+	current.Store(store)
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Current 返回当前存储，未初始化时为 nil
+func Current() *Store {
+	return current.Load()
+}
+
+// Close 关闭全局存储
+func Close() error {
+	initMu.Lock()
+	defer initMu.Unlock()
+	if old := current.Swap(nil); old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// OwnerKey 返回 API Key 的摘要，用于区分文件的上传者而不保存 Key 本身
+func OwnerKey(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+type ownerKey struct{}
+
+// WithOwner 在上下文中记录当前请求的 API Key
+func WithOwner(ctx context.Context, apiKey string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, OwnerKey(apiKey))
+}
+
+// OwnerFromContext 返回当前请求 API Key 的摘要
+func OwnerFromContext(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
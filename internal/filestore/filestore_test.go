@@ -0,0 +1,72 @@
+package filestore
+
+import (
+	"monica-proxy/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	t.Cleanup(func() { Close() })
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "not-a-dir")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	files := func(db, content string) config.FilesConfig {
+		return config.FilesConfig{
+			DBPath:     filepath.Join(dir, db),
+			ContentDir: filepath.Join(dir, content),
+			UploadsDir: filepath.Join(dir, "uploads"),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		files       config.FilesConfig
+		wantErr     bool
+		wantSame    bool // 仍是同一个 Store
+		wantOpen    bool // 原 Store 仍可用
+		wantPath    string
+		wantContent string
+	}{
+		{"unchanged", files("a.db", "files"), false, true, true, "a.db", "files"},
+		{"content dir changed", files("a.db", "other"), false, false, true, "a.db", "other"},
+		{"open failure keeps the old store", config.FilesConfig{DBPath: filepath.Join(blocker, "b.db")}, true, true, true, "a.db", "other"},
+		{"db path changed", files("b.db", "other"), false, false, false, "b.db", "other"},
+	}
+
+	cfg := config.GetDefaultConfig()
+	cfg.Files = files("a.db", "files")
+	if err := Init(cfg); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := Current()
+			cfg := config.GetDefaultConfig()
+			cfg.Files = tt.files
+			if err := Init(cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("Init = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			store := Current()
+			if store == nil {
+				t.Fatal("no current store")
+			}
+			if (store == old) != tt.wantSame {
+				t.Errorf("store replaced = %v, want %v", store != old, !tt.wantSame)
+			}
+			if store.Path() != filepath.Join(dir, tt.wantPath) || store.ContentDir() != filepath.Join(dir, tt.wantContent) {
+				t.Errorf("store = %s, %s", store.Path(), store.ContentDir())
+			}
+			if err := store.Put(Record{ID: "file-" + tt.name}); err != nil {
+				t.Errorf("current store unusable: %v", err)
+			}
+			if err := old.Put(Record{ID: "old-" + tt.name}); (err == nil) != tt.wantOpen {
+				t.Errorf("old store Put = %v, want open = %v", err, tt.wantOpen)
+			}
+		})
+	}
+}
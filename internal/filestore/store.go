@@ -0,0 +1,220 @@
+package filestore
+
+import (
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bytedance/sonic"
+	bolt "go.etcd.io/bbolt"
+)
+
+var filesBucket = []byte("files")
+
+// 文件状态，与 OpenAI Files API 一致
+const (
+	StatusUploaded  = "uploaded"  // 已上传，Monica 仍在解析
+	StatusProcessed = "processed" // 解析完成或不需要解析
+	StatusError     = "error"     // 解析失败
+)
+
+// Processing 文件是否仍在解析中
+func (r Record) Processing() bool {
+	return r.Status == StatusUploaded
+}
+
+// 列表排序方式
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// 列表数量限制，与 OpenAI Files API 一致
+const (
+	DefaultListLimit = 10000
+	MaxListLimit     = 10000
+)
+
+// Record 一个已上传文件的元数据
+type Record struct {
+	ID            string         `json:"id"`    // 对外的文件ID，即 Monica FileUID
+	Owner         string         `json:"owner"` // 上传者 API Key 的摘要，见 OwnerKey
+	Purpose       string         `json:"purpose"`
+	MimeType      string         `json:"mime_type"`
+	CreatedAt     int64          `json:"created_at"`
+	Status        string         `json:"status"`                 // StatusUploaded、StatusProcessed 或 StatusError
+	StatusError   string         `json:"status_error,omitempty"` // 解析失败的原因
+	IndexState    int            `json:"index_state"`            // Monica 解析状态，types.FileIndexStateDone 表示完成
+	IndexProgress int            `json:"index_progress"`         // Monica 解析进度，0-100
+	LocalPath     string         `json:"local_path,omitempty"`   // 本地副本，未保留时为空
+	File          types.FileInfo `json:"file"`                   // Monica 文件信息，含 CDN 地址、大小和 tokens/chunks
+}
+
+// ListOptions 列出文件的过滤与分页条件
+type ListOptions struct {
+	Owner   string // 只返回该上传者的文件
+	Purpose string // 为空时不过滤
+	After   string // 从该文件ID之后开始
+	Limit   int    // 0 时使用 DefaultListLimit
+	Order   string // OrderAsc 或 OrderDesc，按创建时间排序，默认 OrderDesc
+}
+
+// Store 基于 bbolt 的文件元数据存储，文件内容的本地副本和分片上传的暂存文件保存在配置的目录下
+type Store struct {
+	db         *bolt.DB
+	path       string
+	contentDir string
+	uploadsDir string
+}
+
+// Open 打开或创建存储文件
+func Open(cfg config.FilesConfig) (*Store, error) {
+	path := cfg.DBPath
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create file store directory failed: %w", err)
+		}
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open file store failed: %w", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{filesBucket, uploadsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init file store failed: %w", err)
+	}
+	return &Store{db: db, path: path, contentDir: cfg.ContentDir, uploadsDir: cfg.UploadsDir}, nil
+}
+
+// Path 存储文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Close 关闭存储
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put 写入或覆盖一条记录
+func (s *Store) Put(r Record) error {
+	value, err := sonic.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(filesBucket).Put([]byte(r.ID), value)
+	})
+}
+
+// Get 读取记录，不存在时返回 false
+func (s *Store) Get(id string) (Record, bool, error) {
+	var r Record
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(filesBucket).Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return sonic.Unmarshal(value, &r)
+	})
+	return r, found, err
+}
+
+// Update 在同一事务中读取、修改并写回记录，不存在时返回 false 且不调用 fn
+func (s *Store) Update(id string, fn func(*Record)) (Record, bool, error) {
+	var r Record
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(filesBucket)
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		found = true
+		if err := sonic.Unmarshal(value, &r); err != nil {
+			return err
+		}
+		fn(&r)
+		updated, err := sonic.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), updated)
+	})
+	return r, found, err
+}
+
+// Delete 删除记录，不存在时返回 false
+func (s *Store) Delete(id string) (bool, error) {
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(filesBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return nil
+		}
+		found = true
+		return bucket.Delete([]byte(id))
+	})
+	return found, err
+}
+
+// List 按条件列出记录，第二个返回值表示之后是否还有更多记录
+func (s *Store) List(opts ListOptions) ([]Record, bool, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(filesBucket).ForEach(func(_, value []byte) error {
+			var r Record
+			if err := sonic.Unmarshal(value, &r); err != nil {
+				return nil
+			}
+			if r.Owner != opts.Owner || (opts.Purpose != "" && r.Purpose != opts.Purpose) {
+				return nil
+			}
+			records = append(records, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	asc := opts.Order == OrderAsc
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.CreatedAt != b.CreatedAt {
+			return (a.CreatedAt < b.CreatedAt) == asc
+		}
+		return (a.ID < b.ID) == asc
+	})
+
+	if opts.After != "" {
+		for i, r := range records {
+			if r.ID == opts.After {
+				records = records[i+1:]
+				break
+			}
+		}
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if len(records) > limit {
+		return records[:limit], true, nil
+	}
+	return records, false, nil
+}
@@ -0,0 +1,138 @@
+package filestore
+
+import (
+	"monica-proxy/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	dir := t.TempDir()
+	s, err := Open(config.FilesConfig{
+		DBPath:     filepath.Join(dir, "files.db"),
+		ContentDir: filepath.Join(dir, "files"),
+		UploadsDir: filepath.Join(dir, "uploads"),
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreList(t *testing.T) {
+	s := openTestStore(t)
+	records := []Record{
+		{ID: "file-a", Owner: "alice", Purpose: "assistants", CreatedAt: 100},
+		{ID: "file-b", Owner: "alice", Purpose: "vision", CreatedAt: 200},
+		{ID: "file-c", Owner: "alice", Purpose: "assistants", CreatedAt: 200},
+		{ID: "file-d", Owner: "alice", Purpose: "assistants", CreatedAt: 300},
+		{ID: "file-e", Owner: "bob", Purpose: "assistants", CreatedAt: 150},
+	}
+	for _, r := range records {
+		if err := s.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		opts     ListOptions
+		want     string
+		wantMore bool
+	}{
+		{"newest first by default", ListOptions{Owner: "alice"}, "file-d,file-c,file-b,file-a", false},
+		{"ascending with id tie break", ListOptions{Owner: "alice", Order: OrderAsc}, "file-a,file-b,file-c,file-d", false},
+		{"other owner", ListOptions{Owner: "bob"}, "file-e", false},
+		{"no owner sees nothing", ListOptions{}, "", false},
+		{"purpose filter", ListOptions{Owner: "alice", Purpose: "assistants"}, "file-d,file-c,file-a", false},
+		{"first page", ListOptions{Owner: "alice", Limit: 2}, "file-d,file-c", true},
+		{"next page", ListOptions{Owner: "alice", Limit: 2, After: "file-c"}, "file-b,file-a", false},
+		{"ascending page", ListOptions{Owner: "alice", Limit: 2, After: "file-b", Order: OrderAsc}, "file-c,file-d", false},
+		{"after last", ListOptions{Owner: "alice", After: "file-a"}, "", false},
+		{"exact limit has no more", ListOptions{Owner: "alice", Limit: 4}, "file-d,file-c,file-b,file-a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, more, err := s.List(tt.opts)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var ids []string
+			for _, r := range got {
+				ids = append(ids, r.ID)
+			}
+			if strings.Join(ids, ",") != tt.want {
+				t.Errorf("ids = %v, want %s", ids, tt.want)
+			}
+			if more != tt.wantMore {
+				t.Errorf("more = %v, want %v", more, tt.wantMore)
+			}
+		})
+	}
+}
+
+func TestStoreUpdateAndDelete(t *testing.T) {
+	s := openTestStore(t)
+	s.Put(Record{ID: "file-a", Status: StatusUploaded})
+
+	r, found, err := s.Update("file-a", func(r *Record) {
+		r.Status = StatusProcessed
+		r.IndexProgress = 100
+	})
+	if err != nil || !found || r.Processing() {
+		t.Fatalf("Update = %+v, %v, %v", r, found, err)
+	}
+	if got, _, _ := s.Get("file-a"); got.Status != StatusProcessed || got.IndexProgress != 100 {
+		t.Errorf("stored record = %+v", got)
+	}
+
+	called := false
+	if _, found, _ := s.Update("missing", func(*Record) { called = true }); found || called {
+		t.Error("Update of missing record called fn")
+	}
+
+	if found, err := s.Delete("file-a"); !found || err != nil {
+		t.Fatalf("Delete = %v, %v", found, err)
+	}
+	if found, _ := s.Delete("file-a"); found {
+		t.Error("second Delete found record")
+	}
+	if _, found, _ := s.Get("file-a"); found {
+		t.Error("record still present after Delete")
+	}
+}
+
+func TestSaveContent(t *testing.T) {
+	s := openTestStore(t)
+	// 文件ID只取最后一段，不能写到目录之外
+	path, err := s.SaveContent("../../escape", strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("SaveContent: %v", err)
+	}
+	if filepath.Dir(path) != s.ContentDir() {
+		t.Errorf("content saved outside content dir: %s", path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Errorf("content = %q", data)
+	}
+	if err := RemoveContent(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveContent(path); err != nil {
+		t.Errorf("removing missing content: %v", err)
+	}
+}
+
+func TestOwnerKey(t *testing.T) {
+	if OwnerKey("") != "" {
+		t.Error("empty key should have empty owner")
+	}
+	a, b := OwnerKey("sk-a"), OwnerKey("sk-b")
+	if a == b || a != OwnerKey("sk-a") || len(a) != 16 || strings.Contains(a, "sk-a") {
+		t.Errorf("OwnerKey = %q, %q", a, b)
+	}
+}
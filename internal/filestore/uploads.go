@@ -0,0 +1,269 @@
+package filestore
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bytedance/sonic"
+	bolt "go.etcd.io/bbolt"
+)
+
+var uploadsBucket = []byte("uploads")
+
+// 分片上传状态，与 OpenAI Uploads API 一致
+const (
+	UploadPending   = "pending"   // 等待添加分片或完成
+	UploadCompleted = "completed" // 已组装并上传为文件
+	UploadCancelled = "cancelled" // 已取消
+	UploadExpired   = "expired"   // 超过有效期未完成
+)
+
+// Upload 一次分片上传，分片暂存在 uploadsDir/<ID>/ 下，服务重启后可以继续添加分片
+type Upload struct {
+	ID        string       `json:"id"`
+	Owner     string       `json:"owner"` // 上传者 API Key 的摘要，见 OwnerKey
+	Filename  string       `json:"filename"`
+	Purpose   string       `json:"purpose"`
+	MimeType  string       `json:"mime_type"`
+	Bytes     int64        `json:"bytes"` // 创建时声明的文件总大小
+	CreatedAt int64        `json:"created_at"`
+	ExpiresAt int64        `json:"expires_at"`
+	Status    string       `json:"status"` // Upload* 常量
+	Parts     []UploadPart `json:"parts,omitempty"`
+	FileID    string       `json:"file_id,omitempty"` // 完成后生成的文件ID
+}
+
+// UploadPart 已暂存的分片
+type UploadPart struct {
+	ID        string `json:"id"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"` // 写入时计算，组装前重新校验
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ReceivedBytes 已暂存分片的总大小
+func (u Upload) ReceivedBytes() int64 {
+	var total int64
+	for _, p := range u.Parts {
+		total += p.Size
+	}
+	return total
+}
+
+// Part 按ID查找分片
+func (u Upload) Part(id string) (UploadPart, bool) {
+	for _, p := range u.Parts {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return UploadPart{}, false
+}
+
+// NewUploadID 生成上传ID，格式与 OpenAI 一致
+func NewUploadID() string {
+	return "upload_" + randomHex(12)
+}
+
+// NewPartID 生成分片ID，格式与 OpenAI 一致
+func NewPartID() string {
+	return "part_" + randomHex(12)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// PutUpload 写入或覆盖一次上传
+func (s *Store) PutUpload(u Upload) error {
+	value, err := sonic.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadsBucket).Put([]byte(u.ID), value)
+	})
+}
+
+// GetUpload 读取一次上传，不存在时返回 false
+func (s *Store) GetUpload(id string) (Upload, bool, error) {
+	var u Upload
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(uploadsBucket).Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return sonic.Unmarshal(value, &u)
+	})
+	return u, found, err
+}
+
+// UpdateUpload 在同一事务中读取、修改并写回上传，fn 返回错误时不写回并返回该错误；不存在时返回 false 且不调用 fn
+func (s *Store) UpdateUpload(id string, fn func(*Upload) error) (Upload, bool, error) {
+	var u Upload
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(uploadsBucket)
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		found = true
+		if err := sonic.Unmarshal(value, &u); err != nil {
+			return err
+		}
+		if err := fn(&u); err != nil {
+			return err
+		}
+		updated, err := sonic.Marshal(u)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), updated)
+	})
+	return u, found, err
+}
+
+// ExpireUploads 将超过有效期仍未完成的上传标记为过期并删除其暂存分片，返回处理的数量
+func (s *Store) ExpireUploads(now time.Time) (int, error) {
+	var expired []string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(uploadsBucket)
+		return bucket.ForEach(func(key, value []byte) error {
+			var u Upload
+			if err := sonic.Unmarshal(value, &u); err != nil {
+				return nil
+			}
+			if u.Status != UploadPending || u.ExpiresAt > now.Unix() {
+				return nil
+			}
+			u.Status = UploadExpired
+			updated, err := sonic.Marshal(u)
+			if err != nil {
+				return err
+			}
+			expired = append(expired, u.ID)
+			// ForEach 中可以修改已存在键的值
+			return bucket.Put(key, updated)
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range expired {
+		s.RemoveUploadParts(id)
+	}
+	return len(expired), nil
+}
+
+// uploadDir 上传的暂存目录，ID 由服务生成，仍只取最后一段防止路径穿越
+func (s *Store) uploadDir(uploadID string) string {
+	return filepath.Join(s.uploadsDir, filepath.Base(uploadID))
+}
+
+// SavePart 将分片写入暂存目录，最多读取 limit 字节，返回分片大小和 SHA-256；超出 limit 时返回错误且不保留分片
+func (s *Store) SavePart(uploadID, partID string, content io.Reader, limit int64) (int64, string, error) {
+	dir := s.uploadDir(uploadID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, "", fmt.Errorf("create upload directory failed: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(partID)+".*")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	// 多读一个字节用于判断是否超出 limit
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(content, limit+1))
+	if err != nil {
+		tmp.Close()
+		return 0, "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, "", err
+	}
+	if size > limit {
+		return 0, "", ErrPartTooLarge
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, filepath.Base(partID))); err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// RemovePart 删除一个暂存分片，不存在时忽略
+func (s *Store) RemovePart(uploadID, partID string) error {
+	return RemoveContent(filepath.Join(s.uploadDir(uploadID), filepath.Base(partID)))
+}
+
+// RemoveUploadParts 删除上传的全部暂存分片
+func (s *Store) RemoveUploadParts(uploadID string) error {
+	return os.RemoveAll(s.uploadDir(uploadID))
+}
+
+// ErrPartTooLarge 分片超出上传剩余的大小
+var ErrPartTooLarge = fmt.Errorf("part exceeds the remaining upload size")
+
+// ErrPartChecksum 暂存分片的内容与写入时的校验和不一致
+var ErrPartChecksum = fmt.Errorf("part checksum mismatch")
+
+// AssembleUpload 按 partIDs 的顺序校验并拼接分片，返回组装后的文件（读写位置在开头）和内容的 MD5，
+// 文件位于暂存目录下，调用方关闭后由 RemoveUploadParts 一并删除
+func (s *Store) AssembleUpload(u Upload, partIDs []string) (*os.File, string, error) {
+	out, err := os.CreateTemp(s.uploadDir(u.ID), ".assembled.*")
+	if err != nil {
+		return nil, "", fmt.Errorf("create assembled file failed: %w", err)
+	}
+	fail := func(err error) (*os.File, string, error) {
+		out.Close()
+		os.Remove(out.Name())
+		return nil, "", err
+	}
+
+	sum := md5.New()
+	for _, id := range partIDs {
+		part, ok := u.Part(id)
+		if !ok {
+			return fail(fmt.Errorf("unknown part %s", id))
+		}
+		if err := appendPart(out, sum, filepath.Join(s.uploadDir(u.ID), filepath.Base(id)), part); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return out, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// appendPart 将分片追加到 out，同时校验其大小和 SHA-256
+func appendPart(out io.Writer, sum io.Writer, path string, part UploadPart) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open part %s failed: %w", part.ID, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, sum, hash), f)
+	if err != nil {
+		return err
+	}
+	if n != part.Size || hex.EncodeToString(hash.Sum(nil)) != part.SHA256 {
+		return fmt.Errorf("%w: %s", ErrPartChecksum, part.ID)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package filestore
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	stderrors "errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addTestPart 暂存分片并记录到上传中
+func addTestPart(t *testing.T, s *Store, u *Upload, data string) UploadPart {
+	t.Helper()
+	part := UploadPart{ID: NewPartID()}
+	var err error
+	part.Size, part.SHA256, err = s.SavePart(u.ID, part.ID, strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("SavePart: %v", err)
+	}
+	u.Parts = append(u.Parts, part)
+	return part
+}
+
+func TestSavePartLimit(t *testing.T) {
+	s := openTestStore(t)
+	tests := []struct {
+		name    string
+		data    string
+		limit   int64
+		wantErr error
+	}{
+		{"below limit", "abc", 10, nil},
+		{"exact limit", "abcd", 4, nil},
+		{"over limit", "abcde", 4, ErrPartTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, sum, err := s.SavePart("upload_x", "part_"+tt.name, strings.NewReader(tt.data), tt.limit)
+			if !stderrors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			path := filepath.Join(s.uploadDir("upload_x"), "part_"+tt.name)
+			if tt.wantErr != nil {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Error("rejected part kept on disk")
+				}
+				return
+			}
+			if size != int64(len(tt.data)) || len(sum) != 64 {
+				t.Errorf("size = %d, sha256 = %q", size, sum)
+			}
+		})
+	}
+}
+
+func TestAssembleUpload(t *testing.T) {
+	s := openTestStore(t)
+	u := Upload{ID: NewUploadID()}
+	first := addTestPart(t, s, &u, "hello ")
+	second := addTestPart(t, s, &u, "world")
+
+	tests := []struct {
+		name    string
+		parts   []string
+		corrupt string // 组装前改写的分片
+		want    string
+		wantErr string
+	}{
+		{"in order", []string{first.ID, second.ID}, "", "hello world", ""},
+		{"client order", []string{second.ID, first.ID}, "", "worldhello ", ""},
+		{"subset", []string{second.ID}, "", "world", ""},
+		{"unknown part", []string{first.ID, "part_missing"}, "", "", "unknown part part_missing"},
+		{"corrupted part", []string{first.ID, second.ID}, second.ID, "", ErrPartChecksum.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.corrupt != "" {
+				os.WriteFile(filepath.Join(s.uploadDir(u.ID), tt.corrupt), []byte("W0rld"), 0600)
+			}
+			f, sum, err := s.AssembleUpload(u, tt.parts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AssembleUpload: %v", err)
+			}
+			defer f.Close()
+			data, _ := io.ReadAll(f)
+			if string(data) != tt.want {
+				t.Errorf("assembled = %q, want %q", data, tt.want)
+			}
+			want := md5.Sum([]byte(tt.want))
+			if sum != hex.EncodeToString(want[:]) {
+				t.Errorf("md5 = %s", sum)
+			}
+		})
+	}
+
+	if err := s.RemoveUploadParts(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.uploadDir(u.ID)); !os.IsNotExist(err) {
+		t.Error("upload directory kept after RemoveUploadParts")
+	}
+}
+
+func TestExpireUploads(t *testing.T) {
+	s := openTestStore(t)
+	now := time.Now()
+	uploads := []Upload{
+		{ID: "upload_expired", Status: UploadPending, ExpiresAt: now.Add(-time.Minute).Unix()},
+		{ID: "upload_active", Status: UploadPending, ExpiresAt: now.Add(time.Hour).Unix()},
+		{ID: "upload_done", Status: UploadCompleted, ExpiresAt: now.Add(-time.Hour).Unix()},
+	}
+	for i := range uploads {
+		addTestPart(t, s, &uploads[i], "data")
+		s.PutUpload(uploads[i])
+	}
+
+	n, err := s.ExpireUploads(now)
+	if err != nil || n != 1 {
+		t.Fatalf("ExpireUploads = %d, %v", n, err)
+	}
+
+	tests := []struct {
+		id         string
+		wantStatus string
+		wantParts  bool
+	}{
+		{"upload_expired", UploadExpired, false},
+		{"upload_active", UploadPending, true},
+		{"upload_done", UploadCompleted, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			u, found, err := s.GetUpload(tt.id)
+			if err != nil || !found {
+				t.Fatalf("GetUpload = %v, %v", found, err)
+			}
+			if u.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", u.Status, tt.wantStatus)
+			}
+			_, err = os.Stat(s.uploadDir(tt.id))
+			if hasParts := err == nil; hasParts != tt.wantParts {
+				t.Errorf("parts on disk = %v, want %v", hasParts, tt.wantParts)
+			}
+		})
+	}
+}
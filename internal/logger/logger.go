@@ -2,7 +2,6 @@ package logger
 
 import (
 	"os"
-	"path/filepath"
 	"sync"
 
 	"go.uber.org/zap"
@@ -23,6 +22,7 @@ type LogConfig struct {
 	Format    string
 	Output    string
 	MaskSensitive bool
+	Rotate    RotateConfig
 }
 
 // 初始化日志
@@ -80,7 +80,7 @@ func newLogger(config *LogConfig) *zap.Logger {
 		writeSyncer = zapcore.AddSync(os.Stderr)
 	} else {
 		// 文件输出
-		writeSyncer = createFileWriter(config.Output)
+		writeSyncer = createFileWriter(config.Output, config.Rotate)
 	}
 
 	// 根据格式选择编码器
@@ -138,23 +138,19 @@ func With(fields ...zap.Field) *zap.Logger {
 	return logger.With(fields...)
 }
 
-// createFileWriter 创建文件写入器
-func createFileWriter(filePath string) zapcore.WriteSyncer {
-	// 确保目录存在
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		// 如果创建目录失败，回退到标准输出
-		return zapcore.AddSync(os.Stdout)
-	}
-
-	// 打开文件，如果不存在则创建，追加写入
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+// createFileWriter 创建支持轮转的文件写入器
+func createFileWriter(filePath string, rotate RotateConfig) zapcore.WriteSyncer {
+	// 目录不存在时自动创建，追加写入
+	writer, err := newRotatingWriter(filePath, rotate)
 	if err != nil {
 		// 如果打开文件失败，回退到标准输出
 		return zapcore.AddSync(os.Stdout)
 	}
 
-	return zapcore.AddSync(file)
+	if old := fileWriter.Swap(writer); old != nil {
+		old.Close()
+	}
+	return writer
 }
 
 // SetLevel 设置日志级别
@@ -176,12 +172,13 @@ func SetLevel(level string) {
 }
 
 // UpdateConfig 更新日志配置
-func UpdateConfig(level, format, output string, maskSensitive bool) {
+func UpdateConfig(level, format, output string, maskSensitive bool, rotate RotateConfig) {
 	currentConfig = &LogConfig{
 		Level:  level,
 		Format: format,
 		Output: output,
 		MaskSensitive: maskSensitive,
+		Rotate: rotate,
 	}
 	
 	// 重新创建日志实例
@@ -0,0 +1,362 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backupTimeFormat 归档文件名中的时间格式，避免使用冒号以兼容 Windows
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// fileWriter 当前日志文件写入器，重新配置时替换并关闭旧的写入器
+var fileWriter atomic.Pointer[rotatingWriter]
+
+// RotateConfig 日志文件轮转配置，零值表示不限制
+type RotateConfig struct {
+	MaxSizeMB  int           // 单个文件最大大小，超过后轮转
+	Interval   time.Duration // 当前文件开始写入超过该时长后轮转
+	MaxAgeDays int           // 归档文件保留天数
+	MaxBackups int           // 最多保留的归档文件数
+	Compress   bool          // 是否使用 gzip 压缩归档文件
+}
+
+// rotatingWriter 按大小和时间轮转的日志文件写入器，轮转后在后台清理和压缩归档
+type rotatingWriter struct {
+	path   string
+	config RotateConfig
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time // 当前文件开始写入的时间
+	closed  bool      // 已被新的写入器替换，不再写入
+
+	millMu sync.Mutex
+}
+
+func newRotatingWriter(path string, config RotateConfig) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, config: config}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	// 启动时按当前配置清理一次历史归档
+	go w.mill()
+	return w, nil
+}
+
+// open 打开或创建当前日志文件，调用方需持有锁
+func (w *rotatingWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	// 已有内容的文件无法得知首次写入时间，以最后修改时间近似，只会比实际晚轮转
+	w.started = time.Now()
+	if w.size > 0 {
+		w.started = info.ModTime()
+	}
+	return nil
+}
+
+func (w *rotatingWriter) maxSize() int64 {
+	return int64(w.config.MaxSizeMB) * 1024 * 1024
+}
+
+// shouldRotate 写入 n 字节前是否需要轮转：写入后超过大小限制，或当前文件已写入超过轮转间隔
+func (w *rotatingWriter) shouldRotate(n int, now time.Time) bool {
+	if w.size == 0 {
+		return false
+	}
+	if max := w.maxSize(); max > 0 && w.size+int64(n) > max {
+		return true
+	}
+	return w.config.Interval > 0 && now.Sub(w.started) >= w.config.Interval
+}
+
+// Write 写入日志，需要时先轮转
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 替换前创建的 logger 仍持有旧写入器，丢弃其写入，避免重新打开文件后与新写入器同时写入
+	if w.closed {
+		return len(p), nil
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(len(p), time.Now()) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Sync 刷新文件缓冲
+func (w *rotatingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close 关闭当前文件；之后的写入会被丢弃，不会重新打开文件
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Truncate 清空当前日志文件并删除所有归档
+func (w *rotatingWriter) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		if err := w.file.Truncate(0); err != nil {
+			return err
+		}
+		w.size = 0
+		w.started = time.Now()
+	}
+	backups, err := listBackups(w.path)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		os.Remove(b.path)
+	}
+	return nil
+}
+
+// rotate 将当前文件重命名为带时间戳的归档并打开新文件，调用方需持有锁
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	if err := os.Rename(w.path, freeBackupName(w.path, time.Now())); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	go w.mill()
+	return nil
+}
+
+// mill 压缩未压缩的归档，并删除超出数量或保留天数的归档
+func (w *rotatingWriter) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	backups, err := listBackups(w.path)
+	if err != nil {
+		return
+	}
+
+	var remove []logBackup
+	if w.config.MaxBackups > 0 && len(backups) > w.config.MaxBackups {
+		remove = append(remove, backups[w.config.MaxBackups:]...)
+		backups = backups[:w.config.MaxBackups]
+	}
+	if w.config.MaxAgeDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -w.config.MaxAgeDays)
+		kept := backups[:0]
+		for _, b := range backups {
+			if b.time.Before(cutoff) {
+				remove = append(remove, b)
+			} else {
+				kept = append(kept, b)
+			}
+		}
+		backups = kept
+	}
+	for _, b := range remove {
+		os.Remove(b.path)
+	}
+
+	if !w.config.Compress {
+		return
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b.path, ".gz") {
+			compressFile(b.path)
+		}
+	}
+}
+
+// compressFile 将文件压缩为 .gz 并删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+// backupName 返回归档文件名，如 monica-proxy-2006-01-02T15-04-05.000.log；
+// seq 大于 0 时加上序号，如 monica-proxy-2006-01-02T15-04-05.000_1.log
+func backupName(path string, t time.Time, seq int) string {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext)
+	stamp := t.Format(backupTimeFormat)
+	if seq > 0 {
+		stamp += "_" + strconv.Itoa(seq)
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, stamp, ext))
+}
+
+// freeBackupName 返回尚未被占用的归档文件名（包括已压缩的归档），同一毫秒内多次轮转时递增序号
+func freeBackupName(path string, t time.Time) string {
+	for seq := 0; ; seq++ {
+		name := backupName(path, t, seq)
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(name + ".gz"); !os.IsNotExist(err) {
+			continue
+		}
+		return name
+	}
+}
+
+type logBackup struct {
+	path string
+	time time.Time
+	seq  int
+}
+
+// listBackups 列出日志文件的全部归档，按时间从新到旧排序
+func listBackups(path string) ([]logBackup, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []logBackup
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp, seqText, hasSeq := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext), "_")
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		seq := 0
+		if hasSeq {
+			if seq, err = strconv.Atoi(seqText); err != nil || seq <= 0 {
+				continue
+			}
+		}
+		backups = append(backups, logBackup{path: filepath.Join(dir, e.Name()), time: t, seq: seq})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].time.Equal(backups[j].time) {
+			return backups[i].time.After(backups[j].time)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+	return backups, nil
+}
+
+// LogSegments 返回日志文件及其所有归档的路径，当前文件在前，归档按时间从新到旧
+func LogSegments(path string) ([]string, error) {
+	var segments []string
+	if _, err := os.Stat(path); err == nil {
+		segments = append(segments, path)
+	}
+	backups, err := listBackups(path)
+	if err != nil && !os.IsNotExist(err) {
+		return segments, err
+	}
+	for _, b := range backups {
+		segments = append(segments, b.path)
+	}
+	return segments, nil
+}
+
+// ClearLogFiles 清空日志文件并删除其所有归档
+func ClearLogFiles(path string) error {
+	if w := fileWriter.Load(); w != nil && w.path == path {
+		return w.Truncate()
+	}
+	if err := os.Truncate(path, 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	backups, err := listBackups(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, b := range backups {
+		os.Remove(b.path)
+	}
+	return nil
+}
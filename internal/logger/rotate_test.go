@@ -0,0 +1,204 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterShouldRotate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		config  RotateConfig
+		size    int64
+		started time.Time
+		write   int
+		want    bool
+	}{
+		{"empty file never rotates", RotateConfig{MaxSizeMB: 1, Interval: time.Hour}, 0, now.Add(-2 * time.Hour), 2 << 20, false},
+		{"below size limit", RotateConfig{MaxSizeMB: 1}, 100, now, 100, false},
+		{"exceeds size limit", RotateConfig{MaxSizeMB: 1}, 1 << 20, now, 1, true},
+		{"size unlimited", RotateConfig{}, 1 << 30, now, 1, false},
+		{"interval not reached", RotateConfig{Interval: time.Hour}, 100, now.Add(-30 * time.Minute), 1, false},
+		{"interval reached", RotateConfig{Interval: time.Hour}, 100, now.Add(-time.Hour), 1, true},
+		{"interval disabled", RotateConfig{}, 100, now.Add(-1000 * time.Hour), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &rotatingWriter{config: tt.config, size: tt.size, started: tt.started}
+			if got := w.shouldRotate(tt.write, now); got != tt.want {
+				t.Errorf("shouldRotate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingWriterRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := newRotatingWriter(path, RotateConfig{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("old\n"))
+	w.mu.Lock()
+	w.started = time.Now().Add(-2 * time.Hour)
+	w.mu.Unlock()
+	w.Write([]byte("new\n"))
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "new\n" {
+		t.Errorf("active file = %q, want only the new line", data)
+	}
+	backups, _ := listBackups(path)
+	if len(backups) != 1 {
+		t.Fatalf("backups = %d, want 1", len(backups))
+	}
+	if data, _ := os.ReadFile(backups[0].path); string(data) != "old\n" {
+		t.Errorf("backup = %q", data)
+	}
+}
+
+func TestRotatingWriterResumesAgeOfExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("yesterday\n"), 0644)
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(path, old, old)
+
+	// 重启后首次写入即轮转前一天的文件
+	w, err := newRotatingWriter(path, RotateConfig{Interval: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("today\n"))
+
+	if data, _ := os.ReadFile(path); string(data) != "today\n" {
+		t.Errorf("active file = %q", data)
+	}
+}
+
+func TestFreeBackupNameSameMillisecond(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	at := time.Date(2025, 1, 2, 3, 4, 5, 6e6, time.Local)
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		name := freeBackupName(path, at)
+		names = append(names, filepath.Base(name))
+		os.WriteFile(name, []byte{byte(i)}, 0644)
+	}
+	// 已压缩的归档同样占用名称
+	gz := backupName(path, at, 3) + ".gz"
+	os.WriteFile(gz, nil, 0644)
+	names = append(names, filepath.Base(freeBackupName(path, at)))
+
+	want := []string{
+		"app-2025-01-02T03-04-05.006.log",
+		"app-2025-01-02T03-04-05.006_1.log",
+		"app-2025-01-02T03-04-05.006_2.log",
+		"app-2025-01-02T03-04-05.006_4.log",
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("name %d = %s, want %s", i, names[i], want[i])
+		}
+	}
+}
+
+func TestListBackupsOrder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	files := []string{
+		"app-2025-01-01T00-00-00.000.log",
+		"app-2025-01-02T00-00-00.000.log.gz",
+		"app-2025-01-02T00-00-00.000_1.log",
+		"app-2025-01-02T00-00-00.000_2.log.gz",
+		"app-2025-01-02T00-00-00.000_x.log", // 序号无效
+		"app-notatime.log",
+		"other-2025-01-03T00-00-00.000.log",
+	}
+	for _, f := range files {
+		os.WriteFile(filepath.Join(dir, f), nil, 0644)
+	}
+
+	backups, err := listBackups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range backups {
+		got = append(got, filepath.Base(b.path))
+	}
+	want := []string{
+		"app-2025-01-02T00-00-00.000_2.log.gz",
+		"app-2025-01-02T00-00-00.000_1.log",
+		"app-2025-01-02T00-00-00.000.log.gz",
+		"app-2025-01-01T00-00-00.000.log",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("backups = %v, want %v", got, want)
+	}
+}
+
+func TestMillPrunesBackups(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RotateConfig
+		want   int
+	}{
+		{"unlimited", RotateConfig{}, 4},
+		{"max backups", RotateConfig{MaxBackups: 2}, 2},
+		{"max age", RotateConfig{MaxAgeDays: 2}, 2},
+		{"both", RotateConfig{MaxBackups: 1, MaxAgeDays: 2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			for _, days := range []int{0, 1, 3, 5} {
+				at := time.Now().AddDate(0, 0, -days)
+				os.WriteFile(backupName(path, at, 0), nil, 0644)
+			}
+			w := &rotatingWriter{path: path, config: tt.config}
+			w.mill()
+			backups, _ := listBackups(path)
+			if len(backups) != tt.want {
+				t.Errorf("backups = %d, want %d", len(backups), tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingWriterClosedDropsWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	old, err := newRotatingWriter(path, RotateConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := newRotatingWriter(path, RotateConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer current.Close()
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := old.Write([]byte("stale\n")); err != nil || n != 6 {
+		t.Errorf("Write after Close = %d, %v", n, err)
+	}
+	if old.file != nil {
+		t.Error("closed writer reopened the file")
+	}
+	current.Write([]byte("current\n"))
+
+	data, _ := os.ReadFile(path)
+	if got := string(data); got != "current\n" {
+		t.Errorf("log file = %q, want only the current writer's output", got)
+	}
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "monica_proxy"
+
+// ModelContextKey handler 通过 echo.Context.Set 写入请求模型，供指标中间件打标签
+const ModelContextKey = "metrics_model"
+
+// registry 独立的指标注册表，避免混入第三方库注册到默认注册表的指标
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+var (
+	// HTTPRequests HTTP请求总数
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total HTTP requests by route, model and status.",
+	}, []string{"route", "model", "status"})
+
+	// HTTPDuration HTTP请求耗时
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, model and status.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"route", "model", "status"})
+
+	// TimeToFirstToken 从发起上游请求到收到首个内容块的耗时（包含重试与降级）
+	TimeToFirstToken = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "time_to_first_token_seconds",
+		Help:      "Time from the first upstream attempt to the first content chunk.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 3, 5, 8, 13, 20, 30, 60},
+	}, []string{"model"})
+
+	// StreamChunks 每个SSE流的chunk数量
+	StreamChunks = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stream_chunks",
+		Help:      "Number of upstream SSE chunks per stream.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"model"})
+
+	// UpstreamRequests Monica上游请求数，按端点与结果统计
+	UpstreamRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Upstream requests by endpoint and outcome (HTTP status or \"error\").",
+	}, []string{"endpoint", "outcome"})
+
+	// FileUploadBytes 上传文件大小
+	FileUploadBytes = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "file_upload_bytes",
+		Help:      "Size of files uploaded to Monica.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"outcome"})
+
+	// FileUploadDuration 文件上传耗时
+	FileUploadDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "file_upload_duration_seconds",
+		Help:      "Duration of file uploads to Monica, including LLM processing.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"outcome"})
+
+	// CacheLookups 附件缓存查询次数
+	CacheLookups = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Attachment cache lookups by cache and result (hit/miss).",
+	}, []string{"cache", "result"})
+
+	// RateLimitRejections 被限流拒绝的请求数
+	RateLimitRejections = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter.",
+	})
+
+	// InFlightStreams 进行中的流式响应数
+	InFlightStreams = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "in_flight_streams",
+		Help:      "Streaming responses currently being relayed.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler 返回 Prometheus 指标的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// knownModels 允许作为标签值的模型集合，RegisterRoutes 每次调用时替换，记录指标的请求并发读取
+var knownModels atomic.Pointer[map[string]struct{}]
+
+// SetModels 设置允许作为标签值的模型列表，其余模型统一记为 "other"，避免客户端传入任意模型名导致标签基数膨胀
+func SetModels(models []string) {
+	known := make(map[string]struct{}, len(models))
+	for _, m := range models {
+		known[m] = struct{}{}
+	}
+	knownModels.Store(&known)
+}
+
+// ModelLabel 返回模型对应的标签值
+func ModelLabel(model string) string {
+	known := knownModels.Load()
+	if known == nil || model == "" {
+		return model
+	}
+	if _, ok := (*known)[model]; ok {
+		return model
+	}
+	return "other"
+}
+
+// ObserveCache 记录一次缓存查询
+func ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveUpload 记录一次文件上传
+func ObserveUpload(size int64, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	FileUploadBytes.WithLabelValues(outcome).Observe(float64(size))
+	FileUploadDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+// ObserveUpstream 记录一次上游请求，status 为0表示连接错误
+func ObserveUpstream(rawURL string, status int) {
+	outcome := "error"
+	if status > 0 {
+		outcome = strconv.Itoa(status)
+	}
+	UpstreamRequests.WithLabelValues(UpstreamEndpoint(rawURL), outcome).Inc()
+}
+
+// UpstreamEndpoint 将上游URL归一为低基数的端点标签：
+// Monica API 使用路径，其他主机（如预签名上传地址）只保留主机名
+func UpstreamEndpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "unknown"
+	}
+	if u.Host == "api.monica.im" {
+		return u.Path
+	}
+	return u.Host
+}
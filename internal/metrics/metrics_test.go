@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestModelLabel(t *testing.T) {
+	SetModels([]string{"gpt-4o", "claude-3-5-sonnet"})
+	defer knownModels.Store(nil)
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"claude-3-5-sonnet", "claude-3-5-sonnet"},
+		{"random-model", "other"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := ModelLabel(tt.model); got != tt.want {
+				t.Errorf("ModelLabel(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelLabelWithoutModels(t *testing.T) {
+	knownModels.Store(nil)
+	if got := ModelLabel("anything"); got != "anything" {
+		t.Errorf("ModelLabel = %q, want model unchanged", got)
+	}
+}
+
+func TestSetModelsConcurrent(t *testing.T) {
+	defer knownModels.Store(nil)
+	// 重新注册路由时替换模型列表，与正在记录指标的请求并发
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetModels([]string{"gpt-4o"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ModelLabel("gpt-4o")
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
 	"net/http"
@@ -10,10 +11,25 @@ import (
 	"go.uber.org/zap"
 )
 
+// publicPaths 跳过 BearerAuth 的路由，由路由自身负责认证
+var publicPaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// adminPrefix 管理接口的路由前缀，使用 AdminAuth 单独认证
+const adminPrefix = "/admin/"
+
 // BearerAuth 创建一个Bearer Token认证中间件
-func BearerAuth(cfg *config.Config) echo.MiddlewareFunc {
+func BearerAuth(holder *config.Holder) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if publicPaths[c.Path()] || strings.HasPrefix(c.Path(), adminPrefix) {
+				return next(c)
+			}
+			cfg := holder.Get()
+
 			// 获取Authorization header
 			auth := c.Request().Header.Get("Authorization")
 
@@ -62,3 +78,51 @@ func BearerAuth(cfg *config.Config) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// TokenAuth 创建令牌认证中间件，每个请求通过 token 读取当前令牌以支持热重载，令牌为空时不做认证
+func TokenAuth(token func() string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := token()
+			if token == "" {
+				return next(c)
+			}
+			if err := checkToken(c, token); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// AdminAuth 创建管理接口认证中间件，与 TokenAuth 相同但令牌为空时返回 404，即默认不开放管理接口
+func AdminAuth(token func() string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := token()
+			if token == "" {
+				return echo.ErrNotFound
+			}
+			if err := checkToken(c, token); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// checkToken 校验请求的 Bearer 令牌
+func checkToken(c echo.Context, token string) error {
+	auth := c.Request().Header.Get("Authorization")
+	given, ok := strings.CutPrefix(auth, "Bearer ")
+	// 使用常量时间比较，避免通过响应时间逐字节猜测令牌
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		logger.Warn("无效的Token",
+			zap.String("method", c.Request().Method),
+			zap.String("uri", c.Request().RequestURI),
+			zap.String("remote_addr", c.RealIP()),
+		)
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"monica-proxy/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTokenAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer secreT", http.StatusUnauthorized},
+		{"token prefix", "secret", "Bearer secre", http.StatusUnauthorized},
+		{"missing scheme", "secret", "secret", http.StatusUnauthorized},
+		{"empty bearer", "secret", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/metrics", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			}, TokenAuth(func() string { return tt.token }))
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenAuthRotation(t *testing.T) {
+	token := "old"
+	e := echo.New()
+	e.GET("/metrics", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, TokenAuth(func() string { return token }))
+
+	// 令牌热重载后立即生效，旧令牌不再可用
+	token = "new"
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"Bearer old", http.StatusUnauthorized},
+		{"Bearer new", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		want       int
+	}{
+		{"admin routes off by default", "", "Bearer api", http.StatusNotFound},
+		{"admin token", "admin", "Bearer admin", http.StatusOK},
+		{"api token rejected", "admin", "Bearer api", http.StatusUnauthorized},
+		{"missing header", "admin", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.GetDefaultConfig()
+			cfg.Security.BearerToken = "api"
+			cfg.Security.AdminToken = tt.adminToken
+			holder := config.NewHolder(cfg, nil)
+
+			e := echo.New()
+			e.Use(BearerAuth(holder))
+			admin := e.Group("/admin", AdminAuth(func() string { return holder.Get().Security.AdminToken }))
+			admin.GET("/usage", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
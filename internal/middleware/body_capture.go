@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"monica-proxy/internal/redact"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// isTextContent 判断内容类型是否为可记录的文本；缺省时按文本处理
+func isTextContent(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/javascript",
+		mediaType == "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+// cappedBuffer 最多保留 limit 字节，并记录实际写入的总字节数
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	total int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += int64(len(p))
+	if remain := b.limit - b.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			b.buf.Write(p[:remain])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) truncated() bool {
+	return b.total > int64(b.buf.Len())
+}
+
+// String 返回截断后的内容，超出上限时附加截断说明
+func (b *cappedBuffer) String() string {
+	if b.truncated() {
+		return fmt.Sprintf("%s...(已截断，共 %d 字节)", strings.ToValidUTF8(b.buf.String(), ""), b.total)
+	}
+	return b.buf.String()
+}
+
+// bodyCapture 在处理器读取请求体的同时记录前 limit 字节，不额外缓冲完整请求体
+type bodyCapture struct {
+	io.ReadCloser
+	captured cappedBuffer
+}
+
+func newBodyCapture(body io.ReadCloser, limit int) *bodyCapture {
+	return &bodyCapture{ReadCloser: body, captured: cappedBuffer{limit: limit}}
+}
+
+func (r *bodyCapture) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.captured.Write(p[:n])
+	return n, err
+}
+
+// sseSummary 流式响应摘要：统计数据块数量，拼接文本预览并记录结束原因
+type sseSummary struct {
+	Chunks       int    `json:"chunks"`
+	Text         string `json:"text_preview"`
+	Truncated    bool   `json:"text_truncated,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	Done         bool   `json:"done"`
+
+	limit   int
+	text    strings.Builder
+	partial []byte
+}
+
+func (s *sseSummary) Write(p []byte) (int, error) {
+	data := append(s.partial, p...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		s.parseLine(data[:idx])
+		data = data[idx+1:]
+	}
+	s.partial = append(s.partial[:0], data...)
+	return len(p), nil
+}
+
+func (s *sseSummary) parseLine(line []byte) {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	payload = bytes.TrimSpace(payload)
+	if string(payload) == "[DONE]" {
+		s.Done = true
+		return
+	}
+	s.Chunks++
+
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(payload, &chunk) != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != "" {
+			s.FinishReason = choice.FinishReason
+		}
+		if choice.Delta.Content == "" {
+			continue
+		}
+		if remain := s.limit - s.text.Len(); remain <= 0 {
+			s.Truncated = true
+		} else if len(choice.Delta.Content) > remain {
+			s.text.WriteString(choice.Delta.Content[:remain])
+			s.Truncated = true
+		} else {
+			s.text.WriteString(choice.Delta.Content)
+		}
+	}
+}
+
+func (s *sseSummary) summary(maskSensitive bool) *sseSummary {
+	s.Text = strings.ToValidUTF8(s.text.String(), "")
+	if maskSensitive {
+		s.Text = redact.String(s.Text)
+	}
+	return s
+}
+
+// responseWriter 包装 http.ResponseWriter 以捕获响应体：
+// SSE 响应只记录摘要，文本响应按上限截断，二进制响应不记录
+type responseWriter struct {
+	http.ResponseWriter
+	limit int
+
+	mode     captureMode
+	body     cappedBuffer
+	sse      sseSummary
+	skipType string
+}
+
+type captureMode int
+
+const (
+	captureUndecided captureMode = iota
+	captureText
+	captureSSE
+	captureSkip
+)
+
+func newResponseWriter(w http.ResponseWriter, limit int) *responseWriter {
+	return &responseWriter{
+		ResponseWriter: w,
+		limit:          limit,
+		body:           cappedBuffer{limit: limit},
+		sse:            sseSummary{limit: limit},
+	}
+}
+
+// decide 在首次写入时根据响应的 Content-Type 决定捕获方式
+func (rw *responseWriter) decide() {
+	if rw.mode != captureUndecided {
+		return
+	}
+	contentType := rw.Header().Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		rw.mode = captureSSE
+	case isTextContent(contentType):
+		rw.mode = captureText
+	default:
+		rw.mode = captureSkip
+		rw.skipType = contentType
+	}
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.decide()
+	switch rw.mode {
+	case captureSSE:
+		rw.sse.Write(b)
+	case captureText:
+		rw.body.Write(b)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.ResponseWriter.Header()
+}
+
+// Flush 透传给底层 Writer，保证流式响应能及时推送
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层 Writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response writer cannot hijack")
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsTextContent(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"", true},
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"application/vnd.api+json", true},
+		{"text/plain", true},
+		{"application/xml", true},
+		{"application/x-www-form-urlencoded", true},
+		{"multipart/form-data; boundary=x", false},
+		{"application/octet-stream", false},
+		{"image/png", false},
+		{"invalid;;", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := isTextContent(tt.contentType); got != tt.want {
+				t.Errorf("isTextContent(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		writes []string
+		want   string
+	}{
+		{"below limit", 10, []string{"abc", "de"}, "abcde"},
+		{"exact limit", 5, []string{"abcde"}, "abcde"},
+		{"truncated", 4, []string{"ab", "cdef"}, "abcd...(已截断，共 6 字节)"},
+		{"drops split utf8", 4, []string{"ab你好"}, "ab...(已截断，共 8 字节)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := cappedBuffer{limit: tt.limit}
+			for _, w := range tt.writes {
+				if n, _ := b.Write([]byte(w)); n != len(w) {
+					t.Fatalf("Write = %d, want %d", n, len(w))
+				}
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("String = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyCapture(t *testing.T) {
+	body := newBodyCapture(io.NopCloser(strings.NewReader("hello world")), 5)
+	// 处理器读到完整请求体，日志只保留前 limit 字节
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if body.captured.buf.String() != "hello" || body.captured.total != 11 {
+		t.Errorf("captured = %q of %d bytes", body.captured.buf.String(), body.captured.total)
+	}
+}
+
+func TestSSESummary(t *testing.T) {
+	chunk := func(content, finish string) string {
+		return `data: {"choices":[{"delta":{"content":"` + content + `"},"finish_reason":"` + finish + `"}]}` + "\n\n"
+	}
+	tests := []struct {
+		name   string
+		writes []string
+		limit  int
+		want   sseSummary
+	}{
+		{
+			name:   "complete stream",
+			writes: []string{chunk("Hel", ""), chunk("lo", ""), chunk("", "stop"), "data: [DONE]\n\n"},
+			limit:  100,
+			want:   sseSummary{Chunks: 3, Text: "Hello", FinishReason: "stop", Done: true},
+		},
+		{
+			name:   "lines split across writes",
+			writes: []string{`data: {"choices":[{"delta":{"con`, `tent":"Hi"}}]}` + "\n", "\ndata: [DO", "NE]\n"},
+			limit:  100,
+			want:   sseSummary{Chunks: 1, Text: "Hi", Done: true},
+		},
+		{
+			name:   "text preview truncated",
+			writes: []string{chunk("Hello", ""), chunk("World", "length")},
+			limit:  7,
+			want:   sseSummary{Chunks: 2, Text: "HelloWo", Truncated: true, FinishReason: "length"},
+		},
+		{
+			name:   "unterminated and non data lines",
+			writes: []string{": keep-alive\n", "event: ping\n", "data: not json\n", chunk("x", "")[:20]},
+			limit:  100,
+			want:   sseSummary{Chunks: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sseSummary{limit: tt.limit}
+			for _, w := range tt.writes {
+				s.Write([]byte(w))
+			}
+			got := s.summary(false)
+			if got.Chunks != tt.want.Chunks || got.Text != tt.want.Text || got.Truncated != tt.want.Truncated ||
+				got.FinishReason != tt.want.FinishReason || got.Done != tt.want.Done {
+				t.Errorf("summary = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseWriterMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		want        captureMode
+	}{
+		{"sse", "text/event-stream; charset=utf-8", captureSSE},
+		{"json", "application/json", captureText},
+		{"no content type", "", captureText},
+		{"binary", "image/png", captureSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rw := newResponseWriter(rec, 4)
+			if tt.contentType != "" {
+				rw.Header().Set("Content-Type", tt.contentType)
+			}
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("data"))
+			rw.Write([]byte("more"))
+
+			if rw.mode != tt.want {
+				t.Errorf("mode = %v, want %v", rw.mode, tt.want)
+			}
+			// 捕获不影响写给客户端的内容
+			if rec.Body.String() != "datamore" {
+				t.Errorf("client body = %q", rec.Body.String())
+			}
+			if tt.want == captureText && rw.body.String() != "data...(已截断，共 8 字节)" {
+				t.Errorf("captured = %q", rw.body.String())
+			}
+			if tt.want == captureSkip && rw.skipType != tt.contentType {
+				t.Errorf("skipType = %q", rw.skipType)
+			}
+		})
+	}
+}
@@ -1,16 +1,11 @@
 package middleware
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
-	"net"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/tracing"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -18,9 +13,11 @@ import (
 )
 
 // RequestLogger 创建一个请求日志记录中间件
-func RequestLogger(cfg *config.Config) echo.MiddlewareFunc {
+func RequestLogger(holder *config.Holder) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			cfg := holder.Get()
+
 			// 如果禁用了请求日志，直接处理请求
 			if !cfg.Logging.EnableRequestLog {
 				return next(c)
@@ -36,22 +33,21 @@ func RequestLogger(cfg *config.Config) echo.MiddlewareFunc {
 				requestID = res.Header().Get(echo.HeaderXRequestID)
 			}
 
-			// 记录请求详情
-			var requestBody []byte
-			if req.Body != nil {
-				// 读取请求体
-				requestBody, _ = io.ReadAll(req.Body)
-				// 恢复请求体以便后续处理
-				req.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+			// 在处理器读取请求体时同步记录前 MaxBodyBytes 字节，文件上传等非文本请求体不记录
+			var requestBody *bodyCapture
+			if cfg.Logging.MaxBodyBytes > 0 && req.Body != nil && req.Body != http.NoBody && isTextContent(req.Header.Get("Content-Type")) {
+				requestBody = newBodyCapture(req.Body, cfg.Logging.MaxBodyBytes)
+				req.Body = requestBody
 			}
 
 			// 记录请求头（脱敏处理）
 			headers := logHeaders(req.Header, cfg.Logging.MaskSensitive)
 
 			// 创建响应体捕获器
-			responseBody := &bytes.Buffer{}
+			var responseBody *responseWriter
 			if res.Writer != nil {
-				res.Writer = &responseWriter{ResponseWriter: res.Writer, body: responseBody}
+				responseBody = newResponseWriter(res.Writer, cfg.Logging.MaxBodyBytes)
+				res.Writer = responseBody
 			}
 
 			// 记录外部请求开始日志 - 环节1: 外部工具调用本软件
@@ -61,6 +57,7 @@ func RequestLogger(cfg *config.Config) echo.MiddlewareFunc {
 				zap.String("request_id", requestID),
 				zap.Int64("content_length", req.ContentLength),
 				zap.String("content_type", req.Header.Get("Content-Type")),
+				tracing.LogField(req.Context()),
 			)
 
 			// 处理请求
@@ -80,23 +77,25 @@ func RequestLogger(cfg *config.Config) echo.MiddlewareFunc {
 				zap.String("request_id", requestID),
 				zap.String("user_agent", req.UserAgent()),
 				zap.Any("headers", headers),
+				tracing.LogField(req.Context()),
 			}
 
-			// 添加请求体（如果有且不是文件上传）
-			if len(requestBody) > 0 && !isFileUpload(req) {
-				if cfg.Logging.MaskSensitive {
-					fields = append(fields, zap.String("request_body", maskSensitiveData(string(requestBody))))
-				} else {
-					fields = append(fields, zap.String("request_body", string(requestBody)))
-				}
+			// 添加请求体（如果有且为文本）
+			if requestBody != nil && requestBody.captured.total > 0 {
+				fields = append(fields, bodyField("request_body", &requestBody.captured, cfg.Logging.MaskSensitive))
 			}
 
-			// 添加响应体（如果有）
-			if responseBody.Len() > 0 {
-				if cfg.Logging.MaskSensitive {
-					fields = append(fields, zap.String("response_body", maskSensitiveData(responseBody.String())))
-				} else {
-					fields = append(fields, zap.String("response_body", responseBody.String()))
+			// 添加响应体：SSE 只记录摘要，二进制只记录类型
+			if responseBody != nil {
+				switch responseBody.mode {
+				case captureSSE:
+					fields = append(fields, zap.Any("response_stream", responseBody.sse.summary(cfg.Logging.MaskSensitive)))
+				case captureText:
+					if cfg.Logging.MaxBodyBytes > 0 && responseBody.body.total > 0 {
+						fields = append(fields, bodyField("response_body", &responseBody.body, cfg.Logging.MaskSensitive))
+					}
+				case captureSkip:
+					fields = append(fields, zap.String("response_body_skipped", responseBody.skipType))
 				}
 			}
 
@@ -126,109 +125,18 @@ func RequestLogger(cfg *config.Config) echo.MiddlewareFunc {
 	}
 }
 
-// responseWriter 包装 http.ResponseWriter 以捕获响应体
-type responseWriter struct {
-	http.ResponseWriter
-	body *bytes.Buffer
-}
-
-func (rw *responseWriter) Write(b []byte) (int, error) {
-	rw.body.Write(b)
-	return rw.ResponseWriter.Write(b)
-}
-
-func (rw *responseWriter) WriteHeader(statusCode int) {
-	rw.ResponseWriter.WriteHeader(statusCode)
-}
-
-func (rw *responseWriter) Header() http.Header {
-	return rw.ResponseWriter.Header()
-}
-
-func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	if hj, ok := rw.ResponseWriter.(http.Hijacker); ok {
-		return hj.Hijack()
+// bodyField 生成请求/响应体日志字段
+func bodyField(key string, body *cappedBuffer, maskSensitive bool) zap.Field {
+	if maskSensitive {
+		return zap.String(key, redact.String(body.String()))
 	}
-	return nil, nil, fmt.Errorf("response writer cannot hijack")
-}
-
-// isFileUpload 检查是否为文件上传请求
-func isFileUpload(req *http.Request) bool {
-	contentType := req.Header.Get("Content-Type")
-	return req.Method == "POST" && 
-		contentType != "" && 
-		(strings.HasPrefix(contentType, "multipart/form-data") || 
-			strings.HasPrefix(contentType, "application/x-www-form-urlencoded"))
+	return zap.String(key, body.String())
 }
 
 // logHeaders 记录请求头并脱敏敏感信息
 func logHeaders(headers map[string][]string, maskSensitive bool) map[string][]string {
-	result := make(map[string][]string)
-	
-	for key, values := range headers {
-		if maskSensitive {
-			switch key {
-			case "Authorization", "Cookie", "Token", "apikey", "Api-Key":
-				result[key] = []string{"***"}
-			default:
-				result[key] = values
-			}
-		} else {
-			result[key] = values
-		}
-	}
-	
-	return result
-}
-
-// maskSensitiveData 脱敏敏感数据
-func maskSensitiveData(data string) string {
-	// 尝试解析为JSON
-	var jsonMap map[string]interface{}
-	if err := json.Unmarshal([]byte(data), &jsonMap); err == nil {
-		return maskJSONSensitiveFields(jsonMap)
-	}
-	
-	// 如果不是JSON，简单处理包含敏感信息的字符串
-	lowerData := strings.ToLower(data)
-	sensitivePatterns := []string{
-		"authorization", "bearer", "api_key", "apikey", 
-		"token", "password", "secret", "credential",
-	}
-	
-	for _, pattern := range sensitivePatterns {
-		if strings.Contains(lowerData, pattern) {
-			return "*** 敏感数据已脱敏 ***"
-		}
-	}
-	
-	return data
-}
-
-// maskJSONSensitiveFields 脱敏JSON中的敏感字段
-func maskJSONSensitiveFields(data map[string]interface{}) string {
-	masked := make(map[string]interface{})
-	
-	for key, value := range data {
-		lowerKey := strings.ToLower(key)
-		switch {
-		case strings.Contains(lowerKey, "authorization") ||
-			strings.Contains(lowerKey, "bearer") ||
-			strings.Contains(lowerKey, "api_key") ||
-			strings.Contains(lowerKey, "apikey") ||
-			strings.Contains(lowerKey, "token") ||
-			strings.Contains(lowerKey, "password") ||
-			strings.Contains(lowerKey, "secret") ||
-			strings.Contains(lowerKey, "credential") ||
-			strings.Contains(lowerKey, "cookie"):
-			masked[key] = "***"
-		default:
-			masked[key] = value
-		}
-	}
-	
-	if result, err := json.Marshal(masked); err == nil {
-		return string(result)
+	if maskSensitive {
+		return redact.Headers(headers)
 	}
-	return "*** 敏感数据已脱敏 ***"
+	return headers
 }
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	stderrors "errors"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics 创建请求指标采集中间件，按路由、模型和状态码统计请求数与耗时
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			model, _ := c.Get(metrics.ModelContextKey).(string)
+			model = metrics.ModelLabel(model)
+			status := strconv.Itoa(responseStatus(c, err))
+
+			metrics.HTTPRequests.WithLabelValues(route, model, status).Inc()
+			metrics.HTTPDuration.WithLabelValues(route, model, status).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// responseStatus 获取最终的响应状态码；错误会在中间件之后由 ErrorHandler 写出，需要从错误中推断
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) {
+		return appErr.Status
+	}
+	var echoErr *echo.HTTPError
+	if stderrors.As(err, &echoErr) {
+		return echoErr.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"monica-proxy/internal/config"
+	"monica-proxy/internal/metrics"
 	"net"
 	"net/http"
 	"sync"
@@ -148,34 +149,44 @@ func getFirstIP(ips string) string {
 	return ips
 }
 
-// 全局限流器实例，避免重复创建
-var globalRateLimiter *RateLimiter
-var rateLimiterOnce sync.Once
-
-// RateLimit 创建限流中间件
-func RateLimit(cfg *config.Config) echo.MiddlewareFunc {
-	// 如果禁用限流，返回空中间件
-	if !cfg.Security.RateLimitEnabled {
-		return func(next echo.HandlerFunc) echo.HandlerFunc {
-			return next
+// RateLimit 创建限流中间件；每个请求读取当前配置，RPS 变化时重建限流器
+func RateLimit(holder *config.Holder) echo.MiddlewareFunc {
+	var (
+		mu      sync.Mutex
+		limiter *RateLimiter
+		rps     int
+	)
+	// current 返回与配置匹配的限流器，未启用时返回 nil
+	current := func(cfg *config.Config) *RateLimiter {
+		mu.Lock()
+		defer mu.Unlock()
+		enabled := cfg.Security.RateLimitEnabled && cfg.Security.RateLimitRPS > 0
+		if limiter != nil && (!enabled || rps != cfg.Security.RateLimitRPS) {
+			limiter.Close()
+			limiter = nil
+		}
+		if enabled && limiter == nil {
+			limiter = NewRateLimiter(cfg.Security.RateLimitRPS)
+			rps = cfg.Security.RateLimitRPS
 		}
+		return limiter
 	}
 
-	// 确保只创建一次限流器
-	rateLimiterOnce.Do(func() {
-		globalRateLimiter = NewRateLimiter(cfg.Security.RateLimitRPS)
-	})
-
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// 安全地获取客户端IP
-			clientIP := getClientIP(c)
+			cfg := holder.Get()
+			rl := current(cfg)
+			if rl == nil {
+				return next(c)
+			}
 
-			// 获取该客户端的限流器
-			limiter := globalRateLimiter.GetLimiter(clientIP)
+			// 安全地获取客户端IP，并获取该客户端的限流器
+			clientIP := getClientIP(c)
+			limiter := rl.GetLimiter(clientIP)
 
 			// 检查是否允许请求
 			if !limiter.Allow() {
+				metrics.RateLimitRejections.Inc()
 				return echo.NewHTTPError(http.StatusTooManyRequests, map[string]any{
 					"error": map[string]any{
 						"code":        "rate_limit_exceeded",
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/recorder"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Recorder 创建流量录制中间件，为对话请求开启录制会话，请求结束后写入录制文件
+func Recorder() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx, session := recorder.Start(req.Context(), c.Response().Header().Get(echo.HeaderXRequestID), c.Path())
+			if session == nil {
+				return next(c)
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if recErr := session.Finish(responseStatus(c, err), err); recErr != nil {
+				logger.Warn("写入流量录制失败", zap.Error(recErr))
+			}
+			return err
+		}
+	}
+}
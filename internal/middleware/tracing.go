@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"monica-proxy/internal/metrics"
+	"monica-proxy/internal/tracing"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Tracing 创建链路追踪中间件，接受客户端传入的 W3C traceparent，为每个请求创建服务端 span
+func Tracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			ctx, span := tracing.StartServer(req.Context(), propagation.HeaderCarrier(req.Header),
+				req.Method+" "+route,
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(req.URL.Path),
+				attribute.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+
+			status := responseStatus(c, err)
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if model, ok := c.Get(metrics.ModelContextKey).(string); ok && model != "" {
+				span.SetAttributes(attribute.String("gen_ai.request.model", model))
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
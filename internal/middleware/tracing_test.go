@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"monica-proxy/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name       string
+		path       string
+		handler    echo.HandlerFunc
+		wantName   string
+		wantStatus int
+		wantCode   codes.Code
+		wantModel  string
+	}{
+		{
+			name: "success with model",
+			path: "/v1/chat/completions",
+			handler: func(c echo.Context) error {
+				c.Set(metrics.ModelContextKey, "gpt-4o")
+				return c.NoContent(http.StatusOK)
+			},
+			wantName:   "GET /v1/chat/completions",
+			wantStatus: http.StatusOK,
+			wantCode:   codes.Unset,
+			wantModel:  "gpt-4o",
+		},
+		{
+			name: "client error keeps status unset",
+			path: "/v1/chat/completions",
+			handler: func(c echo.Context) error {
+				return echo.NewHTTPError(http.StatusBadRequest)
+			},
+			wantName:   "GET /v1/chat/completions",
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codes.Unset,
+		},
+		{
+			name: "server error",
+			path: "/v1/chat/completions",
+			handler: func(c echo.Context) error {
+				return echo.NewHTTPError(http.StatusBadGateway)
+			},
+			wantName:   "GET /v1/chat/completions",
+			wantStatus: http.StatusBadGateway,
+			wantCode:   codes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec.Reset()
+			e := echo.New()
+			e.Use(Tracing())
+			e.GET(tt.path, tt.handler)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := rec.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("ended spans = %d, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantName {
+				t.Errorf("name = %q, want %q", span.Name(), tt.wantName)
+			}
+			if got := span.SpanContext().TraceID().String(); got != traceID {
+				t.Errorf("trace id = %s, want client trace %s", got, traceID)
+			}
+			if span.Status().Code != tt.wantCode {
+				t.Errorf("status code = %v, want %v", span.Status().Code, tt.wantCode)
+			}
+			attrs := make(map[attribute.Key]attribute.Value)
+			for _, kv := range span.Attributes() {
+				attrs[kv.Key] = kv.Value
+			}
+			if got := attrs["http.response.status_code"].AsInt64(); got != int64(tt.wantStatus) {
+				t.Errorf("status attribute = %d, want %d", got, tt.wantStatus)
+			}
+			if got := attrs["gen_ai.request.model"].AsString(); got != tt.wantModel {
+				t.Errorf("model attribute = %q, want %q", got, tt.wantModel)
+			}
+		})
+	}
+}
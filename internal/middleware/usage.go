@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/usage"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Usage 创建用量记录中间件，请求结束后将用量写入账本
+func Usage(holder *config.Holder) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			apiKey := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			ctx, tracker := usage.Start(req.Context(), c.Response().Header().Get(echo.HeaderXRequestID), c.Path(), apiKey)
+			if tracker == nil {
+				return next(c)
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			tracker.Finish(responseStatus(c, err), holder.Get().Usage.CreditCosts)
+			return err
+		}
+	}
+}
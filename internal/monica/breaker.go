@@ -0,0 +1,129 @@
+package monica
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	// breakerThreshold 连续失败多少次后熔断
+	breakerThreshold = 5
+	// breakerCooldown 熔断后多久允许一次探测请求
+	breakerCooldown = 30 * time.Second
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// errBreakerOpen 账号处于熔断状态
+var errBreakerOpen = fmt.Errorf("upstream account circuit breaker is open")
+
+// breaker 单个上游账号的熔断器：连续失败达到阈值后在冷却期内跳过该账号，
+// 冷却结束后放行一次探测请求，成功则恢复
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// BreakerStatus 熔断器状态快照
+type BreakerStatus struct {
+	State     string    `json:"state"`
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"open_until,omitempty"`
+}
+
+var breakers sync.Map // cookie 哈希 -> *breaker
+
+func breakerFor(cookie string) *breaker {
+	key := xxhash.Sum64String(cookie)
+	if b, ok := breakers.Load(key); ok {
+		return b.(*breaker)
+	}
+	b, _ := breakers.LoadOrStore(key, &breaker{})
+	return b.(*breaker)
+}
+
+// allow 是否允许向该账号发起请求
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// release 放弃探测但不记录结果，让后续请求可以重新探测
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// failure 记录一次失败，返回熔断器是否因此打开
+func (b *breaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= breakerThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+		return true
+	}
+	return false
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStatus{State: BreakerClosed, Failures: b.failures}
+	if b.failures >= breakerThreshold {
+		s.State = BreakerHalfOpen
+		if time.Now().Before(b.openUntil) {
+			s.State = BreakerOpen
+			s.OpenUntil = b.openUntil
+		}
+	}
+	return s
+}
+
+// probeSuccess 账号探测（如额度查询）成功时关闭半开的熔断器，冷却期内和未熔断时不受影响。
+// 实例不就绪时没有对话请求可以探测，由健康检查负责恢复
+func (b *breaker) probeSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerThreshold || time.Now().Before(b.openUntil) {
+		return
+	}
+	b.failures = 0
+}
+
+// AccountProbeSucceeded 记录指定账号Cookie的一次成功探测，见 probeSuccess
+func AccountProbeSucceeded(cookie string) {
+	breakerFor(cookie).probeSuccess()
+}
+
+// AccountBreaker 返回指定账号Cookie的熔断器状态
+func AccountBreaker(cookie string) BreakerStatus {
+	return breakerFor(cookie).status()
+}
@@ -0,0 +1,57 @@
+package monica
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerRecovery(t *testing.T) {
+	b := &breaker{}
+	for i := 0; i < breakerThreshold; i++ {
+		b.failure()
+	}
+	if got := b.status().State; got != BreakerOpen {
+		t.Fatalf("state after %d failures = %s, want open", breakerThreshold, got)
+	}
+
+	// 冷却期内探测成功不关闭熔断器
+	b.probeSuccess()
+	if got := b.status().State; got != BreakerOpen {
+		t.Fatalf("state after probe during cooldown = %s, want open", got)
+	}
+
+	b.mu.Lock()
+	b.openUntil = time.Now().Add(-time.Second)
+	b.mu.Unlock()
+	if got := b.status().State; got != BreakerHalfOpen {
+		t.Fatalf("state after cooldown = %s, want half_open", got)
+	}
+
+	// 没有对话请求时由健康检查的探测恢复
+	b.probeSuccess()
+	if got := b.status(); got.State != BreakerClosed || got.Failures != 0 {
+		t.Fatalf("status after probe = %+v, want closed", got)
+	}
+}
+
+func TestBreakerProbeSuccessKeepsFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		openUntil time.Time
+		want      int
+	}{
+		{"closed keeps failure count", breakerThreshold - 1, time.Time{}, breakerThreshold - 1},
+		{"open keeps failure count", breakerThreshold, time.Now().Add(time.Minute), breakerThreshold},
+		{"half open resets", breakerThreshold + 2, time.Now().Add(-time.Second), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &breaker{failures: tt.failures, openUntil: tt.openUntil}
+			b.probeSuccess()
+			if b.failures != tt.want {
+				t.Errorf("failures = %d, want %d", b.failures, tt.want)
+			}
+		})
+	}
+}
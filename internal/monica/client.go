@@ -7,9 +7,10 @@ import (
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/types"
 	"monica-proxy/internal/utils"
-	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -26,13 +27,14 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 		requestBody, _ := json.Marshal(mReq)
 		fields := []zap.Field{
 			zap.String("request_id", requestID),
+			tracing.LogField(ctx),
 			zap.String("api_type", "monica_chat"),
 			zap.String("url", types.BotChatURL),
 			zap.String("method", "POST"),
 		}
 
 		if cfg.Logging.MaskSensitive {
-			fields = append(fields, zap.String("request_body", maskMonicaRequestData(string(requestBody))))
+			fields = append(fields, zap.String("request_body", redact.String(string(requestBody))))
 		} else {
 			fields = append(fields, zap.String("request_body", string(requestBody)))
 		}
@@ -41,7 +43,7 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 	}
 
 	// 发起请求
-	resp, err := utils.RestySSEClient.R().
+	resp, err := utils.RestySSEClient().R().
 		SetContext(ctx).
 		SetHeader("cookie", cfg.Monica.Cookie).
 		SetBody(mReq).
@@ -53,6 +55,7 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 	if cfg.Logging.EnableRequestLog {
 		fields := []zap.Field{
 			zap.String("request_id", requestID),
+			tracing.LogField(ctx),
 			zap.String("api_type", "monica_chat"),
 			zap.Duration("duration", duration),
 		}
@@ -69,7 +72,7 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 			// 对于非流式响应，记录响应体
 			if resp.StatusCode() < 400 && resp.RawResponse != nil && resp.Body() != nil {
 				if cfg.Logging.MaskSensitive {
-					fields = append(fields, zap.String("response_body", maskMonicaResponseData(string(resp.Body()))))
+					fields = append(fields, zap.String("response_body", redact.String(string(resp.Body()))))
 				} else {
 					fields = append(fields, zap.String("response_body", string(resp.Body())))
 				}
@@ -88,7 +91,8 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 	}
 
 	if err != nil {
-		return nil, errors.NewRequestFailedError("Monica API调用失败", err)
+		// 保留响应以便调用方根据状态码决定是否重试
+		return resp, errors.NewRequestFailedError("Monica API调用失败", err)
 	}
 
 	return resp, nil
@@ -104,6 +108,7 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 		requestBody, _ := json.Marshal(customBotReq)
 		fields := []zap.Field{
 			zap.String("request_id", requestID),
+			tracing.LogField(ctx),
 			zap.String("api_type", "custom_bot"),
 			zap.String("url", types.CustomBotChatURL),
 			zap.String("method", "POST"),
@@ -111,7 +116,7 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 		}
 
 		if cfg.Logging.MaskSensitive {
-			fields = append(fields, zap.String("request_body", maskMonicaRequestData(string(requestBody))))
+			fields = append(fields, zap.String("request_body", redact.String(string(requestBody))))
 		} else {
 			fields = append(fields, zap.String("request_body", string(requestBody)))
 		}
@@ -120,7 +125,7 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 	}
 
 	// 发起请求
-	resp, err := utils.RestySSEClient.R().
+	resp, err := utils.RestySSEClient().R().
 		SetContext(ctx).
 		SetHeader("cookie", cfg.Monica.Cookie).
 		SetBody(customBotReq).
@@ -132,6 +137,7 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 	if cfg.Logging.EnableRequestLog {
 		fields := []zap.Field{
 			zap.String("request_id", requestID),
+			tracing.LogField(ctx),
 			zap.String("api_type", "custom_bot"),
 			zap.Duration("duration", duration),
 			zap.String("bot_uid", customBotReq.BotUID),
@@ -149,7 +155,7 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 			// 对于非流式响应，记录响应体
 			if resp.StatusCode() < 400 && resp.RawResponse != nil && resp.Body() != nil {
 				if cfg.Logging.MaskSensitive {
-					fields = append(fields, zap.String("response_body", maskMonicaResponseData(string(resp.Body()))))
+					fields = append(fields, zap.String("response_body", redact.String(string(resp.Body()))))
 				} else {
 					fields = append(fields, zap.String("response_body", string(resp.Body())))
 				}
@@ -168,84 +174,9 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 	}
 
 	if err != nil {
-		return nil, errors.NewRequestFailedError("Custom Bot API调用失败", err)
+		// 保留响应以便调用方根据状态码决定是否重试
+		return resp, errors.NewRequestFailedError("Custom Bot API调用失败", err)
 	}
 
 	return resp, nil
 }
-
-// maskMonicaRequestData 脱敏Monica请求中的敏感数据
-func maskMonicaRequestData(data string) string {
-	var request map[string]interface{}
-	if err := json.Unmarshal([]byte(data), &request); err == nil {
-		return maskMonicaJSONFields(request)
-	}
-	return data
-}
-
-// maskMonicaResponseData 脱敏Monica响应中的敏感数据
-func maskMonicaResponseData(data string) string {
-	// 对于SSE流数据，按行处理
-	lines := strings.Split(data, "\n")
-	for i, line := range lines {
-		if strings.HasPrefix(line, "data: ") {
-			jsonData := strings.TrimPrefix(line, "data: ")
-			var response map[string]interface{}
-			if err := json.Unmarshal([]byte(jsonData), &response); err == nil {
-				masked := maskMonicaJSONFields(response)
-				lines[i] = "data: " + masked
-			}
-		}
-	}
-	return strings.Join(lines, "\n")
-}
-
-// maskMonicaJSONFields 脱敏Monica JSON中的敏感字段
-func maskMonicaJSONFields(data map[string]interface{}) string {
-	masked := make(map[string]interface{})
-	
-	for key, value := range data {
-		lowerKey := strings.ToLower(key)
-		switch {
-		case strings.Contains(lowerKey, "cookie") ||
-			strings.Contains(lowerKey, "token") ||
-			strings.Contains(lowerKey, "secret") ||
-			strings.Contains(lowerKey, "key") ||
-			strings.Contains(lowerKey, "password"):
-			masked[key] = "***"
-		case strings.Contains(lowerKey, "data"):
-			// 对data字段进行递归处理
-			if dataMap, ok := value.(map[string]interface{}); ok {
-				masked[key] = maskMonicaDataFields(dataMap)
-			} else {
-				masked[key] = value
-			}
-		default:
-			masked[key] = value
-		}
-	}
-	
-	if result, err := json.Marshal(masked); err == nil {
-		return string(result)
-	}
-	return "*** 数据已脱敏 ***"
-}
-
-// maskMonicaDataFields 脱敏Monica数据字段中的敏感信息
-func maskMonicaDataFields(data map[string]interface{}) map[string]interface{} {
-	masked := make(map[string]interface{})
-	
-	for key, value := range data {
-		lowerKey := strings.ToLower(key)
-		switch {
-		case strings.Contains(lowerKey, "cookie") ||
-			strings.Contains(lowerKey, "token") ||
-			strings.Contains(lowerKey, "secret"):
-			masked[key] = "***"
-		default:
-			masked[key] = value
-		}
-	}
-	
-	return masked
-}
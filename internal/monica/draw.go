@@ -39,7 +39,7 @@ func GenerateImage(ctx context.Context, cfg *config.Config, req *types.ImageGene
 	}
 
 	// 4. 发送请求生成图片
-	resp, err := utils.RestyDefaultClient.R().
+	resp, err := utils.RestyDefaultClient().R().
 		SetContext(ctx).
 		SetBody(monicaReq).
 		SetHeader("cookie", cfg.Monica.Cookie).
@@ -94,7 +94,7 @@ func GenerateImage(ctx context.Context, cfg *config.Config, req *types.ImageGene
 			}
 
 			// 查询生成结果
-			_, err := utils.RestyDefaultClient.R().
+			_, err := utils.RestyDefaultClient().R().
 				SetContext(ctx).
 				SetBody(map[string]any{
 					"image_tools_id": imageToolsID,
@@ -0,0 +1,316 @@
+package monica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
+	"monica-proxy/internal/tracing"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/zap"
+)
+
+// ChatAttempt 描述一次上游尝试所使用的账号和模型
+type ChatAttempt struct {
+	Number  int            // 第几次尝试，从1开始
+	Account int            // 账号序号，0为主账号
+	Model   string         // 本次尝试使用的模型
+	Config  *config.Config // 替换为当前账号Cookie后的配置
+}
+
+// ChatSender 按给定的尝试参数发起一次上游请求
+type ChatSender func(ctx context.Context, attempt ChatAttempt) (*resty.Response, error)
+
+// ChatStream 已确认收到首个内容块的上游SSE流
+type ChatStream struct {
+	io.Reader
+	body io.Closer
+
+	Model    string // 实际提供服务的模型
+	Account  int    // 实际使用的账号序号
+	Attempts int    // 总尝试次数
+}
+
+// Close 关闭上游响应体
+func (s *ChatStream) Close() error {
+	return s.body.Close()
+}
+
+// upstreamError 单次尝试失败的原因
+type upstreamError struct {
+	err       error
+	status    int
+	retryable bool // 是否可以在同一账号和模型上重试
+	quota     bool // 是否为额度或鉴权问题，需要切换账号或模型
+}
+
+func (e *upstreamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *upstreamError) Unwrap() error {
+	return e.err
+}
+
+// sseErrorFrame Monica 在SSE中返回的错误帧
+type sseErrorFrame struct {
+	Code  int    `json:"code"`
+	Msg   string `json:"msg"`
+	Error any    `json:"error"`
+}
+
+// OpenChatStream 发起上游聊天请求，在首个内容块转发给客户端之前对连接错误、5xx 和
+// Monica 错误帧进行透明重试；开启故障转移时依次切换备用账号，仍失败则按
+// Config.ModelChain 的顺序尝试降级模型。
+// allowAccountFailover 为 false 时只使用主账号（例如附件已经上传在主账号下）
+func OpenChatStream(ctx context.Context, cfg *config.Config, model string, allowAccountFailover bool, send ChatSender) (_ *ChatStream, err error) {
+	ctx, span := tracing.Start(ctx, "monica.chat", attribute.String("gen_ai.request.model", model))
+	var served *ChatStream
+	defer func() {
+		if served != nil {
+			span.SetAttributes(
+				attribute.String("gen_ai.response.model", served.Model),
+				attribute.Int("monica.account", served.Account),
+				attribute.Int("monica.attempts", served.Attempts),
+			)
+		}
+		tracing.End(span, err)
+	}()
+
+	cookies := []string{cfg.Monica.Cookie}
+	if cfg.Monica.FailoverEnabled && allowAccountFailover {
+		if all := cfg.MonicaCookies(); len(all) > 0 {
+			cookies = all
+		}
+	}
+
+	models := cfg.ModelChain(model)
+
+	maxRetries := max(cfg.HTTPClient.RetryCount, 0)
+	attempt := 0
+	start := time.Now()
+	var lastErr error
+
+nextModel:
+	for _, m := range models {
+		for account, cookie := range cookies {
+			// 熔断中的账号直接跳过，避免把请求浪费在已知故障的账号上
+			accountBreaker := breakerFor(cookie)
+			if !accountBreaker.allow() {
+				lastErr = errBreakerOpen
+				logger.Warn("上游账号熔断中，跳过",
+					zap.String("model", m),
+					zap.Int("account", account),
+				)
+				continue
+			}
+
+			accountCfg := *cfg
+			accountCfg.Monica.Cookie = cookie
+			wait := cfg.HTTPClient.RetryWaitTime
+
+			for retry := 0; retry <= maxRetries; retry++ {
+				attempt++
+				stream, err := openAttempt(ctx, send, ChatAttempt{
+					Number:  attempt,
+					Account: account,
+					Model:   m,
+					Config:  &accountCfg,
+				})
+				if err == nil {
+					accountBreaker.success()
+					stream.Attempts = attempt
+					served = stream
+					metrics.TimeToFirstToken.WithLabelValues(metrics.ModelLabel(m)).Observe(time.Since(start).Seconds())
+					if m != model {
+						logger.Warn("已降级到备用模型",
+							zap.String("requested_model", model),
+							zap.String("served_model", m),
+							zap.Int("account", account),
+							zap.Int("attempts", attempt),
+						)
+					} else if attempt > 1 {
+						logger.Info("上游请求重试成功",
+							zap.String("model", m),
+							zap.Int("account", account),
+							zap.Int("attempts", attempt),
+						)
+					}
+					return stream, nil
+				}
+				lastErr = err
+
+				if ctx.Err() != nil {
+					// 客户端取消不代表账号故障
+					accountBreaker.release()
+					return nil, errors.NewRequestFailedError("Monica API调用失败", ctx.Err())
+				}
+
+				upErr, _ := err.(*upstreamError)
+				logger.Warn("上游请求在首个内容块前失败",
+					zap.String("model", m),
+					zap.Int("account", account),
+					zap.Int("attempt", attempt),
+					zap.Bool("retryable", upErr != nil && upErr.retryable),
+					zap.Bool("quota", upErr != nil && upErr.quota),
+					zap.Error(err),
+				)
+
+				// 额度或鉴权问题：同一账号重试无意义，切换到下一个账号或模型
+				if upErr != nil && upErr.quota {
+					break
+				}
+				// 明确的客户端错误：账号本身正常，不计入熔断；换账号不会成功，直接尝试降级链中的下一个模型
+				if upErr == nil || !upErr.retryable {
+					accountBreaker.release()
+					continue nextModel
+				}
+				if retry == maxRetries {
+					break
+				}
+
+				select {
+				case <-ctx.Done():
+					accountBreaker.release()
+					return nil, errors.NewRequestFailedError("Monica API调用失败", ctx.Err())
+				case <-time.After(wait):
+				}
+				wait = min(wait*2, cfg.HTTPClient.RetryMaxWaitTime)
+			}
+
+			// 重试用尽或额度问题，每个请求在一个账号上只记一次失败，重试次数不影响熔断阈值
+			if accountBreaker.failure() {
+				logger.Warn("上游账号连续失败，已熔断",
+					zap.Int("account", account),
+					zap.Duration("cooldown", breakerCooldown),
+				)
+			}
+		}
+	}
+
+	return nil, errors.NewRequestFailedError("Monica API调用失败", lastErr)
+}
+
+// openAttempt 执行一次上游请求，并读取到首个内容块为止
+func openAttempt(ctx context.Context, send ChatSender, attempt ChatAttempt) (_ *ChatStream, err error) {
+	ctx, span := tracing.Start(ctx, "monica.attempt",
+		attribute.Int("monica.attempt", attempt.Number),
+		attribute.Int("monica.account", attempt.Account),
+		attribute.String("gen_ai.request.model", attempt.Model),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	resp, err := send(ctx, attempt)
+	if resp != nil && resp.RawResponse != nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode()))
+	}
+	if err != nil {
+		status := 0
+		if resp != nil && resp.RawResponse != nil {
+			status = resp.StatusCode()
+			resp.RawBody().Close()
+		}
+		return nil, classifyStatus(status, err)
+	}
+
+	body := resp.RawBody()
+	reader := bufio.NewReaderSize(body, bufferSize)
+	peeked, err := peekFirstChunk(reader)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	return &ChatStream{
+		Reader:  io.MultiReader(bytes.NewReader(peeked), reader),
+		body:    body,
+		Model:   attempt.Model,
+		Account: attempt.Account,
+	}, nil
+}
+
+// classifyStatus 根据HTTP状态码判断失败类型
+func classifyStatus(status int, err error) *upstreamError {
+	upErr := &upstreamError{err: err, status: status}
+	switch {
+	case status == 0, status >= 500:
+		// 连接错误或服务端错误
+		upErr.retryable = true
+	case status == http.StatusUnauthorized, status == http.StatusForbidden,
+		status == http.StatusPaymentRequired, status == http.StatusTooManyRequests:
+		upErr.quota = true
+	}
+	return upErr
+}
+
+// peekFirstChunk 读取SSE行直到遇到首个内容块，返回已读取的原始数据。
+// 在此之前出现的错误帧、连接错误或流提前结束都视为可重试的失败
+func peekFirstChunk(reader *bufio.Reader) ([]byte, error) {
+	var peeked bytes.Buffer
+	for {
+		line, err := reader.ReadBytes('\n')
+		peeked.Write(line)
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("upstream stream closed before first chunk")
+			}
+			return nil, &upstreamError{err: err, retryable: true}
+		}
+
+		if !bytes.HasPrefix(line, []byte(dataPrefix)) {
+			continue
+		}
+		jsonStr := bytes.TrimSpace(line[dataPrefixLen:])
+		if len(jsonStr) == 0 {
+			continue
+		}
+		if bytes.Equal(jsonStr, []byte(sseFinish)) {
+			return peeked.Bytes(), nil
+		}
+
+		var frame sseErrorFrame
+		if err := sonic.Unmarshal(jsonStr, &frame); err == nil && (frame.Code != 0 || frame.Error != nil) {
+			msg := frame.Msg
+			if msg == "" {
+				msg = fmt.Sprint(frame.Error)
+			}
+			return nil, &upstreamError{
+				err:       fmt.Errorf("monica error frame: code=%d msg=%s", frame.Code, msg),
+				retryable: true,
+				quota:     isQuotaMessage(msg),
+			}
+		}
+
+		var data SSEData
+		if err := sonic.Unmarshal(jsonStr, &data); err != nil {
+			// 无法解析的数据交给后续的流处理逻辑报告
+			return peeked.Bytes(), nil
+		}
+		if data.Text != "" || data.Finished || data.AgentStatus.Type != "" {
+			return peeked.Bytes(), nil
+		}
+	}
+}
+
+// isQuotaMessage 判断错误信息是否表示额度耗尽或账号受限
+func isQuotaMessage(msg string) bool {
+	lower := strings.ToLower(msg)
+	for _, keyword := range []string{"quota", "limit", "credit", "额度", "次数", "上限"} {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,379 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"monica-proxy/internal/config"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-resty/resty/v2"
+)
+
+// fakeResponse 构造 openAttempt 能读取的上游响应
+func fakeResponse(status int, body string) *resty.Response {
+	return &resty.Response{RawResponse: &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}}
+}
+
+func okSender(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+	return fakeResponse(http.StatusOK, "data: {\"text\":\"hi\"}\n\n"), nil
+}
+
+func statusSender(status int) ChatSender {
+	return func(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+		return fakeResponse(status, ""), fmt.Errorf("status %d", status)
+	}
+}
+
+func connErrorSender(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func errorFrameSender(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+	return fakeResponse(http.StatusOK, "data: {\"code\":500,\"msg\":\"internal\"}\n\n"), nil
+}
+
+// testRetryConfig 每个用例使用独立的 Cookie，避免共享全局熔断器；用例结束后移除其熔断器，重复运行时从初始状态开始
+func testRetryConfig(t *testing.T, retries int) *config.Config {
+	cfg := config.GetDefaultConfig()
+	cfg.Monica.Cookie = "cookie-" + t.Name()
+	t.Cleanup(func() { breakers.Delete(xxhash.Sum64String(cfg.Monica.Cookie)) })
+	cfg.HTTPClient.RetryCount = retries
+	cfg.HTTPClient.RetryWaitTime = time.Millisecond
+	cfg.HTTPClient.RetryMaxWaitTime = time.Millisecond
+	return cfg
+}
+
+// halfOpen 让熔断器进入冷却已结束、等待探测的状态
+func halfOpen(b *breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = breakerThreshold
+	b.openUntil = time.Now().Add(-time.Second)
+}
+
+func TestOpenChatStreamBreaker(t *testing.T) {
+	tests := []struct {
+		name         string
+		halfOpen     bool
+		retries      int
+		send         ChatSender
+		wantErr      bool
+		wantAttempts int
+		wantFailures int
+		wantState    string
+	}{
+		{"success resets failures", true, 2, okSender, false, 1, 0, BreakerClosed},
+		{"client error releases probe", true, 2, statusSender(http.StatusBadRequest), true, 1, breakerThreshold, BreakerHalfOpen},
+		{"client error does not count", false, 2, statusSender(http.StatusBadRequest), true, 1, 0, BreakerClosed},
+		{"retries count once per request", false, 3, connErrorSender, true, 4, 1, BreakerClosed},
+		{"error frames count once per request", false, 2, errorFrameSender, true, 3, 1, BreakerClosed},
+		{"quota error counts once without retry", false, 3, statusSender(http.StatusTooManyRequests), true, 1, 1, BreakerClosed},
+		{"failed probe reopens", true, 1, statusSender(http.StatusBadGateway), true, 2, breakerThreshold + 1, BreakerOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testRetryConfig(t, tt.retries)
+			b := breakerFor(cfg.Monica.Cookie)
+			if tt.halfOpen {
+				halfOpen(b)
+			}
+
+			var attempts atomic.Int32
+			send := func(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+				attempts.Add(1)
+				return tt.send(ctx, attempt)
+			}
+			stream, err := OpenChatStream(context.Background(), cfg, "gpt-4o", false, send)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if stream != nil {
+				stream.Close()
+			}
+			if got := int(attempts.Load()); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+
+			status := b.status()
+			if status.Failures != tt.wantFailures {
+				t.Errorf("failures = %d, want %d", status.Failures, tt.wantFailures)
+			}
+			if status.State != tt.wantState {
+				t.Errorf("state = %s, want %s", status.State, tt.wantState)
+			}
+			// 探测结束后熔断器不能停留在探测中，半开状态下下一个请求应能再次探测
+			if status.State != BreakerOpen && !b.allow() {
+				t.Error("breaker still blocked after request")
+			}
+		})
+	}
+}
+
+func TestOpenChatStreamCancelledReleasesProbe(t *testing.T) {
+	cfg := testRetryConfig(t, 3)
+	cfg.HTTPClient.RetryWaitTime = time.Hour
+	cfg.HTTPClient.RetryMaxWaitTime = time.Hour
+	b := breakerFor(cfg.Monica.Cookie)
+	halfOpen(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	send := func(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+		// 首次失败后在等待重试期间取消
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return nil, fmt.Errorf("connection reset")
+	}
+	if _, err := OpenChatStream(ctx, cfg, "gpt-4o", false, send); err == nil {
+		t.Fatal("expected error")
+	}
+	if !b.allow() {
+		t.Error("probe not released after client cancellation")
+	}
+	if got := b.status().Failures; got != breakerThreshold {
+		t.Errorf("failures = %d, want %d", got, breakerThreshold)
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	b := &breaker{}
+	for i := 0; i < breakerThreshold-1; i++ {
+		if b.failure() {
+			t.Fatalf("opened after %d failures", i+1)
+		}
+	}
+	if !b.failure() {
+		t.Fatal("not opened at threshold")
+	}
+	if b.allow() {
+		t.Fatal("allowed during cooldown")
+	}
+
+	halfOpen(b)
+	if !b.allow() {
+		t.Fatal("probe not allowed after cooldown")
+	}
+	if b.allow() {
+		t.Fatal("second concurrent probe allowed")
+	}
+	b.release()
+	if !b.allow() {
+		t.Fatal("probe not allowed after release")
+	}
+	b.success()
+	if s := b.status(); s.State != BreakerClosed || s.Failures != 0 {
+		t.Fatalf("status after success = %+v", s)
+	}
+}
+
+func TestOpenChatStreamAccountFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		failover     bool
+		allow        bool
+		failing      map[int]ChatSender // 按账号序号失败，其余账号成功
+		wantErr      bool
+		wantAccount  int
+		wantAttempts int
+	}{
+		{"primary succeeds", true, true, nil, false, 0, 1},
+		{"quota switches account", true, true, map[int]ChatSender{0: statusSender(http.StatusTooManyRequests)}, false, 1, 2},
+		{"retries exhausted switch account", true, true, map[int]ChatSender{0: connErrorSender}, false, 1, 3},
+		{"quota frame switches account", true, true, map[int]ChatSender{0: quotaFrameSender}, false, 1, 2},
+		{"skips to last account", true, true, map[int]ChatSender{0: statusSender(http.StatusForbidden), 1: statusSender(http.StatusForbidden)}, false, 2, 3},
+		{"client error does not switch", true, true, map[int]ChatSender{0: statusSender(http.StatusBadRequest)}, true, 0, 1},
+		{"failover disabled", false, true, map[int]ChatSender{0: statusSender(http.StatusTooManyRequests)}, true, 0, 1},
+		{"failover not allowed for request", true, false, map[int]ChatSender{0: statusSender(http.StatusTooManyRequests)}, true, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testRetryConfig(t, 1)
+			cfg.Monica.FailoverEnabled = tt.failover
+			cfg.Monica.BackupCookies = []string{cfg.Monica.Cookie + "-1", cfg.Monica.Cookie + "-2", cfg.Monica.Cookie}
+
+			accounts := map[string]int{cfg.Monica.Cookie: 0}
+			for i, c := range cfg.Monica.BackupCookies[:2] {
+				accounts[c] = i + 1
+			}
+			var attempts atomic.Int32
+			send := func(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+				attempts.Add(1)
+				account := accounts[attempt.Config.Monica.Cookie]
+				if account != attempt.Account {
+					t.Errorf("attempt account = %d, cookie belongs to %d", attempt.Account, account)
+				}
+				if s, ok := tt.failing[account]; ok {
+					return s(ctx, attempt)
+				}
+				return okSender(ctx, attempt)
+			}
+
+			stream, err := OpenChatStream(context.Background(), cfg, "gpt-4o", tt.allow, send)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := int(attempts.Load()); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if stream == nil {
+				return
+			}
+			defer stream.Close()
+			if stream.Account != tt.wantAccount || stream.Attempts != tt.wantAttempts {
+				t.Errorf("served account %d after %d attempts, want %d after %d", stream.Account, stream.Attempts, tt.wantAccount, tt.wantAttempts)
+			}
+			// 已读取的首个内容块仍然转发给客户端
+			data, _ := io.ReadAll(stream)
+			if !strings.Contains(string(data), `"text":"hi"`) {
+				t.Errorf("stream = %q", data)
+			}
+		})
+	}
+}
+
+func TestOpenChatStreamSkipsOpenBreaker(t *testing.T) {
+	cfg := testRetryConfig(t, 0)
+	cfg.Monica.FailoverEnabled = true
+	cfg.Monica.BackupCookies = []string{cfg.Monica.Cookie + "-backup"}
+	primary := breakerFor(cfg.Monica.Cookie)
+	for i := 0; i < breakerThreshold; i++ {
+		primary.failure()
+	}
+
+	var used []int
+	send := func(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+		used = append(used, attempt.Account)
+		return okSender(ctx, attempt)
+	}
+	stream, err := OpenChatStream(context.Background(), cfg, "gpt-4o", true, send)
+	if err != nil {
+		t.Fatalf("OpenChatStream: %v", err)
+	}
+	stream.Close()
+	if len(used) != 1 || used[0] != 1 {
+		t.Errorf("accounts used = %v, want only the backup", used)
+	}
+}
+
+func quotaFrameSender(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+	return fakeResponse(http.StatusOK, "data: {\"code\":429,\"msg\":\"daily quota exceeded\"}\n\n"), nil
+}
+
+func TestPeekFirstChunk(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantErr   bool
+		retryable bool
+		quota     bool
+	}{
+		{"text chunk", "data: {\"text\":\"hi\"}\n\n", false, false, false},
+		{"skips empty frames", ": ping\n\ndata: {}\n\ndata: {\"text\":\"hi\"}\n", false, false, false},
+		{"agent status", "data: {\"agent_status\":{\"type\":\"thinking\"}}\n", false, false, false},
+		{"finish", "data: [DONE]\n", false, false, false},
+		{"unparseable passed on", "data: not json\n", false, false, false},
+		{"error frame", "data: {\"code\":500,\"msg\":\"internal\"}\n", true, true, false},
+		{"quota frame", "data: {\"code\":403,\"msg\":\"额度不足\"}\n", true, true, true},
+		{"error object", "data: {\"error\":\"rate limit\"}\n", true, true, true},
+		{"closed early", "data: {}\n", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peeked, err := peekFirstChunk(bufio.NewReader(strings.NewReader(tt.body)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if !strings.HasPrefix(tt.body, string(peeked)) || len(peeked) == 0 {
+					t.Errorf("peeked = %q", peeked)
+				}
+				return
+			}
+			upErr, ok := err.(*upstreamError)
+			if !ok {
+				t.Fatalf("err = %T, want *upstreamError", err)
+			}
+			if upErr.retryable != tt.retryable || upErr.quota != tt.quota {
+				t.Errorf("retryable = %v, quota = %v", upErr.retryable, upErr.quota)
+			}
+		})
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		retryable bool
+		quota     bool
+	}{
+		{0, true, false},
+		{http.StatusBadGateway, true, false},
+		{http.StatusServiceUnavailable, true, false},
+		{http.StatusUnauthorized, false, true},
+		{http.StatusPaymentRequired, false, true},
+		{http.StatusForbidden, false, true},
+		{http.StatusTooManyRequests, false, true},
+		{http.StatusBadRequest, false, false},
+		{http.StatusNotFound, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			upErr := classifyStatus(tt.status, fmt.Errorf("status %d", tt.status))
+			if upErr.retryable != tt.retryable || upErr.quota != tt.quota {
+				t.Errorf("classifyStatus(%d) = retryable %v quota %v", tt.status, upErr.retryable, upErr.quota)
+			}
+		})
+	}
+}
+
+func TestOpenChatStreamModelFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		failing   map[string]ChatSender // 按模型失败，其余模型成功
+		wantErr   bool
+		wantModel string
+		wantTried []string
+	}{
+		{"requested model", nil, false, "claude-4-opus", []string{"claude-4-opus"}},
+		{"client error falls back", map[string]ChatSender{"claude-4-opus": statusSender(http.StatusBadRequest)}, false, "claude-4-sonnet", []string{"claude-4-opus", "claude-4-sonnet"}},
+		{"quota falls back", map[string]ChatSender{"claude-4-opus": statusSender(http.StatusTooManyRequests)}, false, "claude-4-sonnet", []string{"claude-4-opus", "claude-4-sonnet"}},
+		{"server errors retried then fall back", map[string]ChatSender{"claude-4-opus": statusSender(http.StatusBadGateway)}, false, "claude-4-sonnet", []string{"claude-4-opus", "claude-4-opus", "claude-4-sonnet"}},
+		{"chain exhausted", map[string]ChatSender{"claude-4-opus": statusSender(http.StatusBadRequest), "claude-4-sonnet": statusSender(http.StatusBadRequest)}, true, "", []string{"claude-4-opus", "claude-4-sonnet"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testRetryConfig(t, 1)
+			cfg.Fallbacks = map[string][]string{"claude-4-opus": {"claude-4-sonnet"}}
+
+			var tried []string
+			send := func(ctx context.Context, attempt ChatAttempt) (*resty.Response, error) {
+				tried = append(tried, attempt.Model)
+				if s, ok := tt.failing[attempt.Model]; ok {
+					return s(ctx, attempt)
+				}
+				return okSender(ctx, attempt)
+			}
+			stream, err := OpenChatStream(context.Background(), cfg, "claude-4-opus", false, send)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(tried, ",") != strings.Join(tt.wantTried, ",") {
+				t.Errorf("tried = %v, want %v", tried, tt.wantTried)
+			}
+			if stream != nil {
+				defer stream.Close()
+				if stream.Model != tt.wantModel {
+					t.Errorf("served model = %s, want %s", stream.Model, tt.wantModel)
+				}
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
 	"monica-proxy/internal/types"
 	"monica-proxy/internal/utils"
 	"net/http"
@@ -90,6 +91,9 @@ func (p *processMonicaSSE) processSSEStream(handler handleSSEData) error {
 	var err error
 	var chunkCount int64
 	var startTime = time.Now()
+	defer func() {
+		metrics.StreamChunks.WithLabelValues(metrics.ModelLabel(p.model)).Observe(float64(atomic.LoadInt64(&chunkCount)))
+	}()
 	
 	for {
 		// 检查上下文是否已取消
@@ -0,0 +1,267 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/redact"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// maxCaptureSize 单个方向最多录制的 SSE 字节数，超出部分丢弃并标记截断
+const maxCaptureSize = 8 << 20
+
+// Exchange 一次完整对话的录制记录，对应 JSONL 文件中的一行
+type Exchange struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Route      string    `json:"route"`
+	Model      string    `json:"model,omitempty"`
+	Stream     bool      `json:"stream"`
+	Status     int       `json:"status,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+
+	Request         any      `json:"request,omitempty"`          // 客户端的 OpenAI 请求
+	UpstreamKind    string   `json:"upstream_kind,omitempty"`    // monica 或 custom_bot
+	UpstreamRequest any      `json:"upstream_request,omitempty"` // 发送给 Monica 的请求
+	UpstreamSSE     []string `json:"upstream_sse,omitempty"`     // Monica 返回的原始 SSE 行
+	ClientSSE       []string `json:"client_sse,omitempty"`       // 转发给客户端的 SSE 行
+	Response        any      `json:"response,omitempty"`         // 非流式响应
+	Truncated       bool     `json:"truncated,omitempty"`
+}
+
+// Recorder 将录制记录追加写入 JSONL 文件
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var current atomic.Pointer[Recorder]
+
+// Init 按配置启用录制，替换并关闭之前的录制器；未启用时关闭录制
+func Init(cfg *config.Config) error {
+	var rec *Recorder
+	if cfg.Recorder.Enabled {
+		if dir := filepath.Dir(cfg.Recorder.FilePath); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("create recorder directory failed: %w", err)
+			}
+		}
+		// 录制内容包含完整对话，只允许当前用户读取
+		file, err := os.OpenFile(cfg.Recorder.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("open recorder file failed: %w", err)
+		}
+		rec = &Recorder{file: file}
+	}
+
+	if old := current.Swap(rec); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// Close 关闭录制
+func Close() {
+	if old := current.Swap(nil); old != nil {
+		old.close()
+	}
+}
+
+func (r *Recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file.Close()
+}
+
+func (r *Recorder) write(line []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.file.Write(append(line, '\n'))
+	return err
+}
+
+// Session 单次对话的录制会话，所有方法对 nil 安全，未启用录制时直接忽略
+type Session struct {
+	rec   *Recorder
+	start time.Time
+
+	mu       sync.Mutex
+	exchange Exchange
+	upstream captureBuffer
+	client   captureBuffer
+}
+
+type sessionKey struct{}
+
+// Start 开始录制一次对话，未启用录制时返回原 ctx 和 nil
+func Start(ctx context.Context, id, route string) (context.Context, *Session) {
+	rec := current.Load()
+	if rec == nil {
+		return ctx, nil
+	}
+	s := &Session{
+		rec:   rec,
+		start: time.Now(),
+		exchange: Exchange{
+			ID:    id,
+			Time:  time.Now(),
+			Route: route,
+		},
+	}
+	return context.WithValue(ctx, sessionKey{}, s), s
+}
+
+// FromContext 获取当前请求的录制会话
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// SetRequest 记录客户端请求
+func (s *Session) SetRequest(model string, stream bool, req any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exchange.Model = model
+	s.exchange.Stream = stream
+	s.exchange.Request = req
+}
+
+// SetUpstreamRequest 记录发送给 Monica 的请求，重试时以最后一次为准
+func (s *Session) SetUpstreamRequest(kind string, req any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exchange.UpstreamKind = kind
+	s.exchange.UpstreamRequest = req
+}
+
+// SetResponse 记录非流式响应
+func (s *Session) SetResponse(resp any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exchange.Response = resp
+}
+
+// TeeUpstream 返回同时录制上游 SSE 原文的 Reader
+func (s *Session) TeeUpstream(r io.Reader) io.Reader {
+	if s == nil {
+		return r
+	}
+	return io.TeeReader(r, &s.upstream)
+}
+
+// TeeClient 返回同时录制客户端 SSE 输出的 Writer，保留 http.Flusher 能力
+func (s *Session) TeeClient(w io.Writer) io.Writer {
+	if s == nil {
+		return w
+	}
+	return &teeWriter{w: w, capture: &s.client}
+}
+
+// Finish 结束录制并写入文件
+func (s *Session) Finish(status int, err error) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	ex := s.exchange
+	s.mu.Unlock()
+
+	ex.Status = status
+	ex.DurationMs = time.Since(s.start).Milliseconds()
+	if err != nil {
+		ex.Error = err.Error()
+	}
+	ex.UpstreamSSE = redactLines(s.upstream.lines())
+	ex.ClientSSE = redactLines(s.client.lines())
+	ex.Truncated = s.upstream.truncated() || s.client.truncated()
+	ex.Request = redact.Value(ex.Request)
+	ex.UpstreamRequest = redact.Value(ex.UpstreamRequest)
+	ex.Response = redact.Value(ex.Response)
+
+	line, err := sonic.Marshal(ex)
+	if err != nil {
+		return err
+	}
+	return s.rec.write(line)
+}
+
+// captureBuffer 有上限的并发安全缓冲区
+type captureBuffer struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	over bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if remain := maxCaptureSize - b.buf.Len(); len(p) > remain {
+		b.buf.Write(p[:max(remain, 0)])
+		b.over = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *captureBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(b.buf.String(), "\n"), "\n")
+}
+
+func (b *captureBuffer) truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.over
+}
+
+// teeWriter 写入客户端的同时录制输出
+type teeWriter struct {
+	w       io.Writer
+	capture *captureBuffer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.capture.Write(p[:n])
+	return n, err
+}
+
+func (t *teeWriter) Flush() {
+	if f, ok := t.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// redactLines 逐行脱敏SSE数据
+func redactLines(lines []string) []string {
+	for i, line := range lines {
+		lines[i] = redact.String(line)
+	}
+	return lines
+}
@@ -0,0 +1,166 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"monica-proxy/internal/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+// initTestRecorder 启用写入临时文件的录制器，返回录制文件路径
+func initTestRecorder(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "records", "exchanges.jsonl")
+	cfg := config.GetDefaultConfig()
+	cfg.Recorder = config.RecorderConfig{Enabled: true, FilePath: path}
+	if err := Init(cfg); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(Close)
+	return path
+}
+
+// readExchanges 读取录制文件中的全部记录
+func readExchanges(t *testing.T, path string) []Exchange {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []Exchange
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var ex Exchange
+		if err := sonic.UnmarshalString(line, &ex); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		result = append(result, ex)
+	}
+	return result
+}
+
+func TestSessionDisabled(t *testing.T) {
+	Close()
+	ctx, s := Start(context.Background(), "req-1", "/v1/chat/completions")
+	if s != nil || FromContext(ctx) != nil {
+		t.Fatal("session started while recorder disabled")
+	}
+
+	// 未启用录制时所有方法对 nil 会话安全，并原样返回读写器
+	s.SetRequest("gpt-4o", true, nil)
+	s.SetUpstreamRequest("monica", nil)
+	s.SetResponse(nil)
+	r := strings.NewReader("data")
+	if s.TeeUpstream(r) != r {
+		t.Error("TeeUpstream wrapped reader of nil session")
+	}
+	var w bytes.Buffer
+	if s.TeeClient(&w) != &w {
+		t.Error("TeeClient wrapped writer of nil session")
+	}
+	if err := s.Finish(200, nil); err != nil {
+		t.Errorf("Finish: %v", err)
+	}
+}
+
+func TestSessionFinish(t *testing.T) {
+	path := initTestRecorder(t)
+
+	tests := []struct {
+		name     string
+		id       string
+		status   int
+		err      error
+		upstream string
+		client   string
+	}{
+		{"stream", "req-1", 200, nil, "data: {\"text\":\"hi\"}\n", "data: {\"choices\":[]}\n\ndata: [DONE]\n"},
+		{"failed", "req-2", 502, errors.New("upstream failed"), "", ""},
+	}
+	for _, tt := range tests {
+		ctx, s := Start(context.Background(), tt.id, "/v1/chat/completions")
+		if FromContext(ctx) != s {
+			t.Fatal("session not stored in context")
+		}
+		s.SetRequest("gpt-4o", true, map[string]any{"model": "gpt-4o", "api_key": "sk-secret"})
+		s.SetUpstreamRequest("monica", map[string]any{"token": "t0ken"})
+		if tt.upstream != "" {
+			if _, err := bytes.NewBuffer(nil).ReadFrom(s.TeeUpstream(strings.NewReader(tt.upstream))); err != nil {
+				t.Fatal(err)
+			}
+			s.TeeClient(&bytes.Buffer{}).Write([]byte(tt.client))
+		}
+		if err := s.Finish(tt.status, tt.err); err != nil {
+			t.Fatalf("Finish: %v", err)
+		}
+	}
+
+	got := readExchanges(t, path)
+	if len(got) != len(tests) {
+		t.Fatalf("records = %d, want %d", len(got), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := got[i]
+			if ex.ID != tt.id || ex.Status != tt.status || ex.Model != "gpt-4o" || !ex.Stream || ex.UpstreamKind != "monica" {
+				t.Errorf("exchange = %+v", ex)
+			}
+			if tt.err != nil && ex.Error != tt.err.Error() {
+				t.Errorf("error = %q, want %q", ex.Error, tt.err)
+			}
+			if want := splitTestLines(tt.upstream); !slices.Equal(ex.UpstreamSSE, want) {
+				t.Errorf("upstream sse = %q, want %q", ex.UpstreamSSE, want)
+			}
+			if want := splitTestLines(tt.client); !slices.Equal(ex.ClientSSE, want) {
+				t.Errorf("client sse = %q, want %q", ex.ClientSSE, want)
+			}
+			// 录制内容按全局规则脱敏
+			req, _ := sonic.MarshalString(ex.Request)
+			upstreamReq, _ := sonic.MarshalString(ex.UpstreamRequest)
+			if strings.Contains(req, "sk-secret") || strings.Contains(upstreamReq, "t0ken") {
+				t.Errorf("secrets recorded: %s %s", req, upstreamReq)
+			}
+		})
+	}
+}
+
+func TestCaptureBufferLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		writes    []int
+		wantLen   int
+		truncated bool
+	}{
+		{"below limit", []int{10, 20}, 30, false},
+		{"exact limit", []int{maxCaptureSize}, maxCaptureSize, false},
+		{"over limit", []int{maxCaptureSize - 5, 10}, maxCaptureSize, true},
+		{"after limit", []int{maxCaptureSize, 1, 1}, maxCaptureSize, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b captureBuffer
+			for _, n := range tt.writes {
+				// 写入始终报告成功，不影响被录制的流
+				if written, err := b.Write(bytes.Repeat([]byte("x"), n)); written != n || err != nil {
+					t.Fatalf("Write = %d, %v", written, err)
+				}
+			}
+			if b.buf.Len() != tt.wantLen || b.truncated() != tt.truncated {
+				t.Errorf("len = %d, truncated = %v", b.buf.Len(), b.truncated())
+			}
+		})
+	}
+}
+
+func splitTestLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
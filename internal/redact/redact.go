@@ -0,0 +1,299 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"monica-proxy/internal/config"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bytedance/sonic"
+)
+
+// 脱敏方式
+const (
+	ModeMask = "mask" // 替换为 ***
+	ModeHash = "hash" // 替换为值的 HMAC-SHA256 前缀，便于关联同一值又不泄露原文
+)
+
+// masked 掩码模式下的替换文本
+const masked = "***"
+
+// valueGroup 正则中只替换该命名分组，未定义时替换整个匹配
+const valueGroup = "v"
+
+// Redactor 按 JSON 路径规则和正则模式脱敏日志与录制内容
+type Redactor struct {
+	mode     string
+	paths    [][]string
+	keys     []string // 各路径规则的最后一段，用于无法解析为 JSON 的文本
+	patterns []*regexp.Regexp
+	key      []byte // hash 模式的 HMAC 密钥
+}
+
+var current atomic.Pointer[Redactor]
+
+// New 根据配置创建脱敏器
+func New(cfg config.RedactionConfig) (*Redactor, error) {
+	r := &Redactor{mode: cfg.Mode}
+	if r.mode == "" {
+		r.mode = ModeMask
+	}
+	if r.mode != ModeMask && r.mode != ModeHash {
+		return nil, fmt.Errorf("unknown redaction mode %q", cfg.Mode)
+	}
+
+	for _, p := range cfg.Paths {
+		segments := strings.Split(strings.ToLower(strings.TrimSpace(p)), ".")
+		for _, s := range segments {
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("invalid redaction path %q: %w", p, err)
+			}
+		}
+		r.paths = append(r.paths, segments)
+		if last := segments[len(segments)-1]; last != "**" {
+			r.keys = append(r.keys, last)
+		}
+	}
+
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	// 未指定密钥时使用进程内随机密钥，哈希只在本进程内可关联
+	if r.mode == ModeHash {
+		r.key = make([]byte, sha256.Size)
+		if _, err := rand.Read(r.key); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Init 按配置设置全局脱敏器，hash 模式使用由密钥文件派生的密钥，重启后同一值的哈希保持不变
+func Init(cfg *config.Config) error {
+	r, err := New(cfg.Redaction)
+	if err != nil {
+		return err
+	}
+	if r.mode == ModeHash {
+		if r.key, err = cfg.RedactionKey(); err != nil {
+			return fmt.Errorf("load redaction key: %w", err)
+		}
+	}
+	current.Store(r)
+	return nil
+}
+
+// Default 返回全局脱敏器，未初始化时使用默认配置
+func Default() *Redactor {
+	if r := current.Load(); r != nil {
+		return r
+	}
+	r, err := New(config.GetDefaultConfig().Redaction)
+	if err != nil {
+		// 默认规则由代码保证合法
+		panic(err)
+	}
+	current.CompareAndSwap(nil, r)
+	return current.Load()
+}
+
+// Value 脱敏任意可序列化的值，返回脱敏后的通用结构（map/slice/基本类型）
+func Value(v any) any { return Default().Value(v) }
+
+// String 脱敏文本：JSON 按路径规则处理，SSE 按行处理，其余文本只应用正则模式
+func String(s string) string { return Default().String(s) }
+
+// Headers 脱敏 HTTP 头
+func Headers(h map[string][]string) map[string][]string { return Default().Headers(h) }
+
+// Secret 按当前模式替换整个敏感值
+func Secret(s string) string { return Default().Secret(s) }
+
+// Value 脱敏任意可序列化的值
+func (r *Redactor) Value(v any) any {
+	if v == nil {
+		return nil
+	}
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var generic any
+	if err := sonic.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+	return r.walk(generic, nil)
+}
+
+// String 脱敏文本
+func (r *Redactor) String(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var generic any
+		if err := sonic.UnmarshalString(trimmed, &generic); err == nil {
+			if out, err := sonic.MarshalString(r.walk(generic, nil)); err == nil {
+				return out
+			}
+		}
+	}
+
+	if strings.Contains(s, "data:") {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if payload, ok := strings.CutPrefix(line, "data:"); ok {
+				lines[i] = "data: " + r.String(strings.TrimSpace(payload))
+			} else {
+				lines[i] = r.text(line)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return r.text(s)
+}
+
+// Headers 脱敏 HTTP 头，头名称按顶层字段匹配路径规则
+func (r *Redactor) Headers(h map[string][]string) map[string][]string {
+	result := make(map[string][]string, len(h))
+	for key, values := range h {
+		if r.matchPath([]string{strings.ToLower(key)}) {
+			redacted := make([]string, len(values))
+			for i, v := range values {
+				redacted[i] = r.Secret(v)
+			}
+			result[key] = redacted
+			continue
+		}
+		result[key] = values
+	}
+	return result
+}
+
+// Secret 按当前模式替换整个敏感值
+func (r *Redactor) Secret(s string) string {
+	if r.mode == ModeHash {
+		if s == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, r.key)
+		mac.Write([]byte(s))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:6])
+	}
+	return masked
+}
+
+func (r *Redactor) walk(v any, keyPath []string) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			childPath := append(keyPath, strings.ToLower(k))
+			if r.matchPath(childPath) {
+				val[k] = r.secretValue(item)
+				continue
+			}
+			val[k] = r.walk(item, childPath)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = r.walk(item, append(keyPath, fmt.Sprint(i)))
+		}
+		return val
+	case string:
+		return r.text(val)
+	}
+	return v
+}
+
+// secretValue 替换命中规则的字段值；非字符串值先序列化再处理
+func (r *Redactor) secretValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		s, _ = sonic.MarshalString(v)
+	}
+	return r.Secret(s)
+}
+
+// text 对文本应用正则模式，并处理截断 JSON 中形如 "key": "value" 的敏感字段
+func (r *Redactor) text(s string) string {
+	for _, re := range r.patterns {
+		group := re.SubexpIndex(valueGroup)
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			if group < 0 {
+				return r.Secret(match)
+			}
+			sub := re.FindStringSubmatchIndex(match)
+			if sub == nil || sub[2*group] < 0 {
+				return r.Secret(match)
+			}
+			start, end := sub[2*group], sub[2*group+1]
+			return match[:start] + r.Secret(match[start:end]) + match[end:]
+		})
+	}
+	if len(r.keys) == 0 || !strings.Contains(s, `":`) {
+		return s
+	}
+	return jsonField.ReplaceAllStringFunc(s, func(match string) string {
+		sub := jsonField.FindStringSubmatch(match)
+		if !r.matchKey(strings.ToLower(sub[1])) {
+			return match
+		}
+		return fmt.Sprintf(`"%s":"%s"`, sub[1], r.Secret(sub[2]))
+	})
+}
+
+// jsonField 匹配 JSON 文本中的字符串字段
+var jsonField = regexp.MustCompile(`"([^"\\]+)"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+
+func (r *Redactor) matchKey(key string) bool {
+	for _, k := range r.keys {
+		if ok, _ := path.Match(k, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) matchPath(keyPath []string) bool {
+	for _, rule := range r.paths {
+		if matchSegments(rule, keyPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments 逐段匹配路径，"*" 等通配符匹配单段，"**" 匹配任意多段
+func matchSegments(rule, keyPath []string) bool {
+	if len(rule) == 0 {
+		return len(keyPath) == 0
+	}
+	if rule[0] == "**" {
+		for i := 0; i <= len(keyPath); i++ {
+			if matchSegments(rule[1:], keyPath[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(keyPath) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(rule[0], keyPath[0]); !ok {
+		return false
+	}
+	return matchSegments(rule[1:], keyPath[1:])
+}
@@ -0,0 +1,197 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"monica-proxy/internal/config"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestRedactor(t *testing.T, cfg config.RedactionConfig) *Redactor {
+	t.Helper()
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		rule string
+		path string
+		want bool
+	}{
+		{"token", "token", true},
+		{"token", "data.token", false},
+		{"**.token", "token", true},
+		{"**.token", "data.auth.token", true},
+		{"**.token", "data.token.value", false},
+		{"**.*_token", "data.access_token", true},
+		{"data.*.key", "data.0.key", true},
+		{"data.*.key", "data.0.1.key", false},
+		{"data.**", "data.a.b", true},
+		{"data.**", "data", true},
+		{"**.*authorization*", "headers.proxy-authorization", true},
+		{"a.**.b", "a.b", true},
+		{"a.**.b", "a.x.y.b", true},
+		{"a.**.b", "a.x.y.c", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+"~"+tt.path, func(t *testing.T) {
+			if got := matchSegments(strings.Split(tt.rule, "."), strings.Split(tt.path, ".")); got != tt.want {
+				t.Errorf("matchSegments(%s, %s) = %v, want %v", tt.rule, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorValue(t *testing.T) {
+	r := newTestRedactor(t, config.GetDefaultConfig().Redaction)
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{
+			"nested token",
+			map[string]any{"data": map[string]any{"Access_Token": "abc", "name": "x"}},
+			map[string]any{"data": map[string]any{"Access_Token": "***", "name": "x"}},
+		},
+		{
+			"array elements",
+			map[string]any{"items": []any{map[string]any{"api_key": "k"}, "plain"}},
+			map[string]any{"items": []any{map[string]any{"api_key": "***"}, "plain"}},
+		},
+		{
+			"non string secret",
+			map[string]any{"password": map[string]any{"a": 1}},
+			map[string]any{"password": "***"},
+		},
+		{
+			"patterns in values",
+			map[string]any{"text": "mail me at a.b@example.com"},
+			map[string]any{"text": "mail me at ***"},
+		},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Value(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorString(t *testing.T) {
+	r := newTestRedactor(t, config.GetDefaultConfig().Redaction)
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"json", `{"cookie":"c","model":"gpt-4o"}`, `{"cookie":"***","model":"gpt-4o"}`},
+		{"sse lines", "data: {\"token\":\"t\"}\n\ndata: [DONE]", "data: {\"token\":\"***\"}\n\ndata: [DONE]"},
+		{"truncated json", `{"secret": "s", "text": "hel`, `{"secret":"***", "text": "hel`},
+		{"bearer group only", "Authorization: Bearer abcdefgh12345", "Authorization: Bearer ***"},
+		{"api key", "key sk-abcdefghijklmnop1234 used", "key *** used"},
+		{"plain", "nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.String(tt.in); got != tt.want {
+				t.Errorf("String = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorHeaders(t *testing.T) {
+	r := newTestRedactor(t, config.RedactionConfig{Paths: []string{"*authorization*", "cookie"}})
+	got := r.Headers(map[string][]string{
+		"Authorization": {"Bearer x"},
+		"Cookie":        {"a=1", "b=2"},
+		"Content-Type":  {"application/json"},
+	})
+	want := map[string][]string{
+		"Authorization": {"***"},
+		"Cookie":        {"***", "***"},
+		"Content-Type":  {"application/json"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Headers = %v, want %v", got, want)
+	}
+}
+
+func TestRedactorHashMode(t *testing.T) {
+	r := newTestRedactor(t, config.RedactionConfig{Mode: ModeHash})
+	a, b := r.Secret("value"), r.Secret("value")
+	if a != b || !strings.HasPrefix(a, "hmac:") || len(a) != len("hmac:")+12 {
+		t.Errorf("Secret = %q, %q", a, b)
+	}
+	if r.Secret("other") == a {
+		t.Error("different values hash to the same result")
+	}
+	if r.Secret("") != "" {
+		t.Error("empty value should stay empty")
+	}
+}
+
+func TestInitHashKey(t *testing.T) {
+	t.Cleanup(func() { current.Store(nil) })
+	dir := t.TempDir()
+	secret := func(keyFile string) string {
+		t.Helper()
+		t.Setenv("MONICA_PROXY_KEY_FILE", filepath.Join(dir, keyFile))
+		cfg := config.GetDefaultConfig()
+		cfg.Redaction.Mode = ModeHash
+		if err := Init(cfg); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+		return Secret("value")
+	}
+
+	first := secret("a.key")
+	tests := []struct {
+		name    string
+		keyFile string
+		same    bool
+	}{
+		{"same key file after restart", "a.key", true},
+		{"other installation", "b.key", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := secret(tt.keyFile); (got == first) != tt.same {
+				t.Errorf("Secret = %q, first = %q, want same = %v", got, first, tt.same)
+			}
+		})
+	}
+
+	sum := sha256.Sum256([]byte("value"))
+	if strings.TrimPrefix(first, "hmac:") == hex.EncodeToString(sum[:6]) {
+		t.Error("hash mode uses an unkeyed hash")
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RedactionConfig
+	}{
+		{"unknown mode", config.RedactionConfig{Mode: "drop"}},
+		{"bad path glob", config.RedactionConfig{Paths: []string{"data.[token"}}},
+		{"bad pattern", config.RedactionConfig{Patterns: []string{"(unclosed"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -6,9 +6,14 @@ import (
 	"monica-proxy/internal/errors"
 	"monica-proxy/internal/logger"
 	"monica-proxy/internal/monica"
+	"monica-proxy/internal/recorder"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -20,11 +25,11 @@ type ChatService interface {
 
 // chatService 聊天服务实现
 type chatService struct {
-	config *config.Config
+	config *config.Holder
 }
 
 // NewChatService 创建聊天服务实例
-func NewChatService(cfg *config.Config) ChatService {
+func NewChatService(cfg *config.Holder) ChatService {
 	return &chatService{
 		config: cfg,
 	}
@@ -32,6 +37,9 @@ func NewChatService(cfg *config.Config) ChatService {
 
 // HandleChatCompletion 处理聊天完成请求
 func (s *chatService) HandleChatCompletion(ctx context.Context, req *openai.ChatCompletionRequest) (interface{}, error) {
+	// 每个请求读取一次配置，热重载不影响进行中的请求
+	cfg := s.config.Get()
+
 	// 验证请求
 	if len(req.Messages) == 0 {
 		return nil, errors.NewEmptyMessageError()
@@ -44,15 +52,26 @@ func (s *chatService) HandleChatCompletion(ctx context.Context, req *openai.Chat
 	// 	zap.Bool("stream", req.Stream),
 	// )
 
+	// 引用的已上传文件直接作为附件
+	if err := resolveFileParts(ctx, cfg); err != nil {
+		return nil, err
+	}
+
 	// 转换请求格式
-	monicaReq, err := types.ChatGPTToMonica(s.config, *req)
+	monicaReq, err := types.ChatGPTToMonica(ctx, cfg, *req)
 	if err != nil {
 		logger.Error("转换请求失败", zap.Error(err))
 		return nil, errors.NewInternalError(err)
 	}
 
-	// 调用Monica API
-	stream, err := monica.SendMonicaRequest(ctx, s.config, monicaReq)
+	// 调用Monica API，首个内容块之前失败时自动重试/故障转移
+	// 附件上传在主账号下，带附件的请求不切换账号
+	stream, err := monica.OpenChatStream(ctx, cfg, req.Model, !monicaReq.HasAttachments(),
+		func(ctx context.Context, attempt monica.ChatAttempt) (*resty.Response, error) {
+			attemptReq := monicaReq.ForAttempt(attempt.Model)
+			recorder.FromContext(ctx).SetUpstreamRequest("monica", attemptReq)
+			return monica.SendMonicaRequest(ctx, attempt.Config, attemptReq)
+		})
 	if err != nil {
 		logger.Error("调用Monica API失败", zap.Error(err))
 		// 如果已经是AppError，直接返回，否则包装为内部错误
@@ -61,18 +80,29 @@ func (s *chatService) HandleChatCompletion(ctx context.Context, req *openai.Chat
 		}
 		return nil, errors.NewInternalError(err)
 	}
+	// 录制上游SSE原文并统计用量，未启用时原样返回
+	stream.Reader = recorder.FromContext(ctx).TeeUpstream(stream.Reader)
+	tracker := usage.FromContext(ctx)
+	tracker.SetServed(stream.Model, stream.Account)
+	stream.Reader = tracker.TeeUpstream(stream.Reader)
+
 	// 根据是否使用流式响应处理结果
 	if req.Stream {
 		// 这里只返回stream，实际的流处理在handler层
 		// 流式响应时不关闭响应体，让handler层负责关闭
-		return stream.RawBody(), nil
+		return stream, nil
 	}
 
 	// 非流式响应，确保在此函数结束时关闭响应体
-	defer stream.RawBody().Close()
+	defer stream.Close()
 
 	// 处理非流式响应
-	response, err := monica.CollectMonicaSSEToCompletion(req.Model, stream.RawBody())
+	_, span := tracing.Start(ctx, "sse.relay",
+		attribute.String("gen_ai.response.model", stream.Model),
+		attribute.Bool("stream", false),
+	)
+	response, err := monica.CollectMonicaSSEToCompletion(stream.Model, stream)
+	tracing.End(span, err)
 	if err != nil {
 		logger.Error("处理Monica响应失败", zap.Error(err))
 		return nil, errors.NewInternalError(err)
@@ -6,9 +6,14 @@ import (
 	"monica-proxy/internal/errors"
 	"monica-proxy/internal/logger"
 	"monica-proxy/internal/monica"
+	"monica-proxy/internal/recorder"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -18,11 +23,11 @@ type CustomBotService interface {
 }
 
 type customBotService struct {
-	config *config.Config
+	config *config.Holder
 }
 
 // NewCustomBotService 创建自定义Bot服务实例
-func NewCustomBotService(cfg *config.Config) CustomBotService {
+func NewCustomBotService(cfg *config.Holder) CustomBotService {
 	return &customBotService{
 		config: cfg,
 	}
@@ -30,6 +35,9 @@ func NewCustomBotService(cfg *config.Config) CustomBotService {
 
 // HandleCustomBotChat 处理自定义Bot对话请求
 func (s *customBotService) HandleCustomBotChat(ctx context.Context, req *openai.ChatCompletionRequest, botUID string) (interface{}, error) {
+	// 每个请求读取一次配置，热重载不影响进行中的请求
+	cfg := s.config.Get()
+
 	// 验证请求
 	if len(req.Messages) == 0 {
 		return nil, errors.NewEmptyMessageError()
@@ -43,15 +51,26 @@ func (s *customBotService) HandleCustomBotChat(ctx context.Context, req *openai.
 		zap.Bool("stream", req.Stream),
 	)
 
+	// 引用的已上传文件直接作为附件
+	if err := resolveFileParts(ctx, cfg); err != nil {
+		return nil, err
+	}
+
 	// 转换请求格式
-	customBotReq, err := types.ChatGPTToCustomBot(s.config, *req, botUID)
+	customBotReq, err := types.ChatGPTToCustomBot(ctx, cfg, *req, botUID)
 	if err != nil {
 		logger.Error("转换Custom Bot请求失败", zap.Error(err))
 		return nil, errors.NewInternalError(err)
 	}
 
-	// 调用Monica Custom Bot API
-	stream, err := monica.SendCustomBotRequest(ctx, s.config, customBotReq)
+	// 调用Monica Custom Bot API，首个内容块之前失败时自动重试/故障转移
+	// Custom Bot 属于主账号，因此不切换账号，只在同一账号上重试或降级模型
+	stream, err := monica.OpenChatStream(ctx, cfg, req.Model, false,
+		func(ctx context.Context, attempt monica.ChatAttempt) (*resty.Response, error) {
+			attemptReq := customBotReq.ForAttempt(attempt.Model)
+			recorder.FromContext(ctx).SetUpstreamRequest("custom_bot", attemptReq)
+			return monica.SendCustomBotRequest(ctx, attempt.Config, attemptReq)
+		})
 	if err != nil {
 		logger.Error("调用Custom Bot API失败", zap.Error(err))
 		// 如果已经是AppError，直接返回，否则包装为内部错误
@@ -61,17 +80,28 @@ func (s *customBotService) HandleCustomBotChat(ctx context.Context, req *openai.
 		return nil, errors.NewInternalError(err)
 	}
 
+	// 录制上游SSE原文并统计用量，未启用时原样返回
+	stream.Reader = recorder.FromContext(ctx).TeeUpstream(stream.Reader)
+	tracker := usage.FromContext(ctx)
+	tracker.SetServed(stream.Model, stream.Account)
+	stream.Reader = tracker.TeeUpstream(stream.Reader)
+
 	// 根据是否使用流式响应处理结果
 	if req.Stream {
 		// 流式响应时不关闭响应体，让handler层负责关闭
-		return stream.RawBody(), nil
+		return stream, nil
 	}
 
 	// 非流式响应，确保在此函数结束时关闭响应体
-	defer stream.RawBody().Close()
+	defer stream.Close()
 
 	// 处理非流式响应
-	response, err := monica.CollectMonicaSSEToCompletion(req.Model, stream.RawBody())
+	_, span := tracing.Start(ctx, "sse.relay",
+		attribute.String("gen_ai.response.model", stream.Model),
+		attribute.Bool("stream", false),
+	)
+	response, err := monica.CollectMonicaSSEToCompletion(stream.Model, stream)
+	tracing.End(span, err)
 	if err != nil {
 		logger.Error("处理Custom Bot响应失败", zap.Error(err))
 		return nil, errors.NewInternalError(err)
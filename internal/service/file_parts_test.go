@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/filestore"
+	"monica-proxy/internal/types"
+	"net/http"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestResolveFileParts(t *testing.T) {
+	s := newTestUploadService(t)
+	cfg := s.config.Get()
+	store := filestore.Current()
+	owner := filestore.OwnerKey("sk-owner")
+	records := []filestore.Record{
+		{ID: "file-ok", Owner: owner, Status: filestore.StatusProcessed, File: types.FileInfo{FileUID: "file-ok", FileName: "a.pdf"}},
+		{ID: "file-other", Owner: filestore.OwnerKey("sk-other"), Status: filestore.StatusProcessed},
+		{ID: "file-failed", Owner: owner, Status: filestore.StatusError, StatusError: "parse failed"},
+	}
+	for _, r := range records {
+		if err := store.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		part       types.ExtendedChatMessagePart
+		wantStatus int // 0 表示成功
+		wantFile   string
+	}{
+		{"file part", types.ExtendedChatMessagePart{Type: "file", File: &types.FilePart{FileID: "file-ok"}}, 0, "a.pdf"},
+		{"image file id", types.ExtendedChatMessagePart{Type: "image_url", ImageURL: &openai.ChatMessageImageURL{URL: "file-ok"}}, 0, "a.pdf"},
+		{"no reference", types.ExtendedChatMessagePart{Type: "text", Text: "hi"}, 0, ""},
+		{"missing file", types.ExtendedChatMessagePart{Type: "file", File: &types.FilePart{FileID: "file-missing"}}, http.StatusBadRequest, ""},
+		{"other owner", types.ExtendedChatMessagePart{Type: "file", File: &types.FilePart{FileID: "file-other"}}, http.StatusBadRequest, ""},
+		{"processing failed", types.ExtendedChatMessagePart{Type: "file", File: &types.FilePart{FileID: "file-failed"}}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := [][]types.ExtendedChatMessagePart{nil, {tt.part}}
+			ctx := types.WithMessageParts(filestore.WithOwner(context.Background(), "sk-owner"), parts)
+			err := resolveFileParts(ctx, cfg)
+			if tt.wantStatus != 0 {
+				wantStatus(t, err, tt.wantStatus)
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveFileParts: %v", err)
+			}
+			resolved := parts[1][0].Resolved
+			if tt.wantFile == "" && resolved != nil || tt.wantFile != "" && (resolved == nil || resolved.FileName != tt.wantFile) {
+				t.Errorf("resolved = %+v, want %q", resolved, tt.wantFile)
+			}
+		})
+	}
+
+	// 文件存储未初始化时引用文件返回 500
+	filestore.Close()
+	parts := [][]types.ExtendedChatMessagePart{{{Type: "file", File: &types.FilePart{FileID: "file-ok"}}}}
+	err := resolveFileParts(types.WithMessageParts(context.Background(), parts), config.GetDefaultConfig())
+	wantStatus(t, err, http.StatusInternalServerError)
+}
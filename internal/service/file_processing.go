@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/filestore"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/types"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fileStatusPollInterval 查询 Monica 解析状态的间隔
+const fileStatusPollInterval = 2 * time.Second
+
+// refreshFileStatus 查询 Monica 解析状态并写回文件存储，文件已被删除时返回 false
+func refreshFileStatus(ctx context.Context, cfg *config.Config, fileID string) (filestore.Record, bool, error) {
+	store := filestore.Current()
+	if store == nil {
+		return filestore.Record{}, false, errFileStoreUnavailable
+	}
+	// 文件ID即 Monica FileUID
+	info, err := types.GetProcessedFileInfo(ctx, cfg, fileID)
+	if err != nil {
+		return filestore.Record{}, true, err
+	}
+
+	return store.Update(fileID, func(record *filestore.Record) {
+		record.IndexState = info.IndexState
+		record.IndexProgress = info.IndexProgress
+		switch {
+		case info.ErrorMessage != "":
+			record.Status = filestore.StatusError
+			record.StatusError = info.ErrorMessage
+		case info.IndexState == types.FileIndexStateDone && info.FileChunks > 0:
+			record.Status = filestore.StatusProcessed
+			record.IndexProgress = 100
+			record.File.FileTokens = info.FileTokens
+			record.File.FileChunks = info.FileChunks
+		}
+	})
+}
+
+// Background 运行服务级的后台任务，停机时取消任务的上下文并等待任务退出
+type Background interface {
+	Go(task func(ctx context.Context))
+}
+
+// trackFileProcessing 在后台跟踪文件解析状态，直到完成、失败、文件被删除、超过 ProcessingTimeout 或服务停止
+func trackFileProcessing(ctx context.Context, cfg *config.Config, fileID string) {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, cfg.Files.ProcessingTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(fileStatusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				logger.Info("服务停止，停止跟踪文件解析", zap.String("file_id", fileID))
+				return
+			}
+			logger.Warn("文件解析超时，停止跟踪",
+				zap.String("file_id", fileID),
+				zap.Duration("timeout", cfg.Files.ProcessingTimeout),
+			)
+			return
+		case <-ticker.C:
+		}
+
+		record, found, err := refreshFileStatus(ctx, cfg, fileID)
+		if err != nil {
+			logger.Debug("查询文件解析状态失败", zap.String("file_id", fileID), zap.Error(err))
+			continue
+		}
+		if !found {
+			return
+		}
+		if !record.Processing() {
+			logger.Info("文件解析结束",
+				zap.String("file_id", fileID),
+				zap.String("status", record.Status),
+				zap.Int("index_state", record.IndexState),
+				zap.Int64("file_tokens", record.File.FileTokens),
+				zap.Int64("file_chunks", record.File.FileChunks),
+				zap.String("error", record.StatusError),
+			)
+			return
+		}
+	}
+}
+
+// waitFileProcessed 等待仍在解析的文件，最多等待 ChatWaitTimeout，调用方取消时立即返回
+func waitFileProcessed(ctx context.Context, cfg *config.Config, record filestore.Record) (filestore.Record, error) {
+	if !record.Processing() {
+		return record, nil
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, cfg.Files.ChatWaitTimeout)
+	defer cancel()
+
+	for {
+		updated, found, err := refreshFileStatus(waitCtx, cfg, record.ID)
+		switch {
+		case err == nil && !found:
+			return record, errors.NewBadRequestError(fmt.Sprintf("引用的文件不存在: %s", record.ID), nil)
+		case err == nil:
+			record = updated
+			if !record.Processing() {
+				return record, nil
+			}
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return record, ctx.Err()
+			}
+			return record, errors.NewBadRequestError(
+				fmt.Sprintf("文件仍在处理中，请稍后重试: %s (进度 %d%%)", record.ID, record.IndexProgress), nil)
+		case <-time.After(fileStatusPollInterval):
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"monica-proxy/internal/filestore"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRecordToFileObject(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     filestore.Record
+		wantStatus string
+		wantError  string
+	}{
+		{"processing", filestore.Record{Status: filestore.StatusUploaded, IndexProgress: 40}, filestore.StatusUploaded, ""},
+		{"processed", filestore.Record{Status: filestore.StatusProcessed}, filestore.StatusProcessed, ""},
+		{"failed", filestore.Record{Status: filestore.StatusError, StatusError: "parse failed"}, filestore.StatusError, "parse failed"},
+		{"legacy record without status", filestore.Record{}, filestore.StatusProcessed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recordToFileObject(tt.record)
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got.Status, tt.wantStatus)
+			}
+			if got.StatusDetails["index_progress"] != tt.record.IndexProgress {
+				t.Errorf("index_progress = %v", got.StatusDetails["index_progress"])
+			}
+			if errDetail, _ := got.StatusDetails["error"].(string); errDetail != tt.wantError {
+				t.Errorf("error detail = %q, want %q", errDetail, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestShouldParseFile(t *testing.T) {
+	tests := []struct {
+		purpose  string
+		mimeType string
+		want     bool
+	}{
+		{"assistants", "image/png", true},
+		{"vision", "image/png", true},
+		{"fine-tune", "application/pdf", false},
+		{"user_data", "application/pdf", true},
+		{"user_data", "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.purpose+" "+tt.mimeType, func(t *testing.T) {
+			if got := shouldParseFile(tt.purpose, tt.mimeType); got != tt.want {
+				t.Errorf("shouldParseFile = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitFileProcessed(t *testing.T) {
+	s := newTestUploadService(t)
+	cfg := *s.config.Get()
+	utils.InitHTTPClients(&cfg)
+	processing := filestore.Record{ID: "file-pending", Status: filestore.StatusUploaded, IndexProgress: 30}
+	filestore.Current().Put(processing)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		record      filestore.Record
+		waitTimeout time.Duration
+		wantStatus  int   // 0 表示成功
+		wantErr     error // 非 AppError 的错误
+	}{
+		{"processed returns immediately", context.Background(), filestore.Record{ID: "file-done", Status: filestore.StatusProcessed}, time.Minute, 0, nil},
+		{"failed returns immediately", context.Background(), filestore.Record{ID: "file-failed", Status: filestore.StatusError}, time.Minute, 0, nil},
+		{"wait timeout", context.Background(), processing, 0, http.StatusBadRequest, nil},
+		{"caller cancelled", cancelled, processing, time.Minute, 0, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Files.ChatWaitTimeout = tt.waitTimeout
+			start := time.Now()
+			got, err := waitFileProcessed(tt.ctx, &cfg, tt.record)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("waited %v", elapsed)
+			}
+			switch {
+			case tt.wantErr != nil:
+				if !stderrors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantStatus != 0:
+				wantStatus(t, err, tt.wantStatus)
+			case err != nil:
+				t.Fatalf("waitFileProcessed: %v", err)
+			}
+			if got.ID != tt.record.ID || got.Status != tt.record.Status {
+				t.Errorf("record = %+v", got)
+			}
+		})
+	}
+}
+
+func TestTrackFileProcessingStops(t *testing.T) {
+	s := newTestUploadService(t)
+	cfg := *s.config.Get()
+
+	tests := []struct {
+		name    string
+		stopped bool          // 服务停止，后台任务的上下文已取消
+		timeout time.Duration // ProcessingTimeout
+	}{
+		{"server shutdown", true, time.Hour},
+		{"processing timeout", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.stopped {
+				cancel()
+			}
+			cfg.Files.ProcessingTimeout = tt.timeout
+
+			done := make(chan struct{})
+			go func() {
+				trackFileProcessing(ctx, &cfg, "file-pending")
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("tracking did not stop")
+			}
+		})
+	}
+}
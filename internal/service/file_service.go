@@ -2,16 +2,17 @@ package service
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
+	"monica-proxy/internal/filestore"
 	"monica-proxy/internal/logger"
 	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
 	"net/http"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -25,31 +26,71 @@ type FileService interface {
 	// GetFile 获取文件信息
 	GetFile(ctx context.Context, fileID string) (*types.FileObject, error)
 	// ListFiles 列出文件
-	ListFiles(ctx context.Context) ([]*types.FileObject, error)
+	ListFiles(ctx context.Context, query FileListQuery) (*types.FileListResponse, error)
 	// DeleteFile 删除文件
 	DeleteFile(ctx context.Context, fileID string) error
+	// GetFileContent 获取文件内容，rangeHeader 为客户端请求的 Range 头
+	GetFileContent(ctx context.Context, fileID string, rangeHeader string) (*FileContent, error)
+}
+
+// FileContent 文件内容，本地副本与 CDN 响应二选一，使用后需要 Close
+type FileContent struct {
+	Filename    string
+	ContentType string
+	ModTime     time.Time
+
+	// Local 本地副本，由调用方按 Range 读取
+	Local *os.File
+
+	// Body CDN 响应体，Range 已转发给 CDN，StatusCode/ContentLength/ContentRange 为其响应
+	Body          io.ReadCloser
+	StatusCode    int
+	ContentLength string
+	ContentRange  string
+}
+
+// Close 关闭文件内容
+func (c *FileContent) Close() error {
+	if c.Local != nil {
+		return c.Local.Close()
+	}
+	if c.Body != nil {
+		return c.Body.Close()
+	}
+	return nil
+}
+
+// FileListQuery 列出文件的查询参数，与 OpenAI Files API 一致
+type FileListQuery struct {
+	Purpose string
+	Limit   int    // 0 时使用默认值
+	After   string // 分页游标，上一页最后一个文件的ID
+	Order   string // asc 或 desc，按创建时间排序
 }
 
 // fileService 文件服务实现
 type fileService struct {
-	config *config.Config
+	config     *config.Holder
+	background Background // 跟踪文件解析的后台任务
 }
 
-// NewFileService 创建文件服务实例
-func NewFileService(cfg *config.Config) FileService {
+// NewFileService 创建文件服务实例，文件解析状态的跟踪任务通过 background 运行
+func NewFileService(cfg *config.Holder, background Background) FileService {
 	return &fileService{
-		config: cfg,
+		config:     cfg,
+		background: background,
 	}
 }
 
 // UploadFile 上传文件
 func (s *fileService) UploadFile(ctx context.Context, fileHeader *multipart.FileHeader, purpose string) (*types.FileObject, error) {
+	cfg := s.config.Get()
 	startTime := time.Now()
 	requestID := fmt.Sprintf("upload-%d", startTime.UnixNano())
 
 	// 验证文件大小
 	if fileHeader.Size > types.MaxFileSize {
-		if s.config.Logging.EnableRequestLog {
+		if cfg.Logging.EnableRequestLog {
 			logger.Error("文件大小验证失败",
 				zap.String("request_id", requestID),
 				zap.String("operation", "file_upload"),
@@ -68,7 +109,7 @@ func (s *fileService) UploadFile(ctx context.Context, fileHeader *multipart.File
 	// 打开文件
 	file, err := fileHeader.Open()
 	if err != nil {
-		if s.config.Logging.EnableRequestLog {
+		if cfg.Logging.EnableRequestLog {
 			logger.Error("无法打开上传的文件",
 				zap.String("request_id", requestID),
 				zap.String("operation", "file_upload"),
@@ -81,61 +122,77 @@ func (s *fileService) UploadFile(ctx context.Context, fileHeader *multipart.File
 	}
 	defer file.Close()
 
-	// 读取文件内容
-	fileData, err := io.ReadAll(file)
-	if err != nil {
-		if s.config.Logging.EnableRequestLog {
-			logger.Error("无法读取文件内容",
-				zap.String("request_id", requestID),
-				zap.String("operation", "file_upload"),
-				zap.String("filename", fileHeader.Filename),
-				zap.Error(err),
-				zap.Duration("duration", time.Since(startTime)),
-			)
-		}
-		return nil, errors.NewInternalError(err)
-	}
+	return s.uploadContent(ctx, cfg, requestID, startTime, file, fileHeader.Filename, fileHeader.Size, "", purpose)
+}
+
+// uploadSource 可随机读取的上传内容，multipart 文件和组装完成的本地文件都满足
+type uploadSource interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
 
-	// 检测MIME类型
-	mimeType := http.DetectContentType(fileData)
+// uploadContent 将内容流式上传到 Monica 并记录到文件存储，mimeType 为空时根据内容开头检测
+func (s *fileService) uploadContent(ctx context.Context, cfg *config.Config, requestID string, startTime time.Time,
+	file uploadSource, filename string, size int64, mimeType, purpose string) (*types.FileObject, error) {
+	// 只读取开头用于检测MIME类型，文件内容之后流式上传
 	if mimeType == "" {
-		// 尝试从文件扩展名推断
-		ext := filepath.Ext(fileHeader.Filename)
-		mimeType = getMimeTypeFromExtension(ext)
+		head := make([]byte, 512)
+		n, err := file.ReadAt(head, 0)
+		if err != nil && err != io.EOF {
+			if cfg.Logging.EnableRequestLog {
+				logger.Error("无法读取文件内容",
+					zap.String("request_id", requestID),
+					zap.String("operation", "file_upload"),
+					zap.String("filename", filename),
+					zap.Error(err),
+					zap.Duration("duration", time.Since(startTime)),
+				)
+			}
+			return nil, errors.NewInternalError(err)
+		}
+
+		// 检测MIME类型
+		mimeType = http.DetectContentType(head[:n])
+		if mimeType == "" {
+			// 尝试从文件扩展名推断
+			ext := filepath.Ext(filename)
+			mimeType = getMimeTypeFromExtension(ext)
+		}
 	}
 
-	if s.config.Logging.EnableRequestLog {
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("开始上传文件",
 			zap.String("request_id", requestID),
 			zap.String("operation", "file_upload"),
-			zap.String("filename", fileHeader.Filename),
+			zap.String("filename", filename),
 			zap.String("mime_type", mimeType),
-			zap.Int64("size", fileHeader.Size),
+			zap.Int64("size", size),
 			zap.String("purpose", purpose),
-			zap.String("file_hash", hashFileData(fileData)),
 		)
 	}
 
 	// 创建上传请求
 	uploadReq := &types.UniversalFileUploadRequest{
-		Data:      fileData,
-		Source:    types.SourceBytes,
-		FileName:  fileHeader.Filename,
+		Data:      file,
+		Source:    types.SourceReader,
+		Size:      size,
+		FileName:  filename,
 		MimeType:  mimeType,
 		ParseFile: shouldParseFile(purpose, mimeType),
+		Async:     true, // 立即返回，解析状态在后台跟踪
 	}
 
 	// 上传文件到Monica
-	fileInfo, err := types.UploadUniversalFile(ctx, s.config, uploadReq)
+	fileInfo, err := types.UploadUniversalFile(ctx, cfg, uploadReq)
 	
 	duration := time.Since(startTime)
 	
 	if err != nil {
-		if s.config.Logging.EnableRequestLog {
+		if cfg.Logging.EnableRequestLog {
 			logger.Error("上传文件到Monica失败",
 				zap.String("request_id", requestID),
 				zap.String("operation", "file_upload"),
-				zap.String("filename", fileHeader.Filename),
+				zap.String("filename", filename),
 				zap.String("file_uid", uploadReq.FileName),
 				zap.Error(err),
 				zap.Duration("duration", duration),
@@ -144,23 +201,41 @@ func (s *fileService) UploadFile(ctx context.Context, fileHeader *multipart.File
 		return nil, errors.NewInternalError(err)
 	}
 
-	// 转换为OpenAI兼容的文件对象
-	fileObject := &types.FileObject{
+	// 记录文件元数据，之后可以按ID查询、列出和删除
+	record := filestore.Record{
 		ID:        fileInfo.FileUID,
-		Object:    "file",
-		Bytes:     int(fileInfo.FileSize),
-		CreatedAt: time.Now().Unix(),
-		Filename:  fileInfo.FileName,
+		Owner:     filestore.OwnerFromContext(ctx),
 		Purpose:   purpose,
-		Status:    "processed",
-		StatusDetails: map[string]interface{}{
-			"tokens":        fileInfo.FileTokens,
-			"chunks":        fileInfo.FileChunks,
-			"upload_duration": duration.String(),
-		},
+		MimeType:  mimeType,
+		CreatedAt: time.Now().Unix(),
+		Status:    filestore.StatusProcessed,
+		File:      *fileInfo,
+	}
+	if uploadReq.ParseFile {
+		record.Status = filestore.StatusUploaded
+	}
+	if store := filestore.Current(); store == nil {
+		logger.Warn("文件存储未初始化，文件不会被记录", zap.String("file_id", record.ID))
+	} else {
+		if cfg.Files.RetainContent {
+			// 保留副本失败不影响上传结果，下载时回退到 CDN
+			if record.LocalPath, err = store.SaveContent(record.ID, io.NewSectionReader(file, 0, size)); err != nil {
+				logger.Warn("保存文件本地副本失败", zap.String("file_id", record.ID), zap.Error(err))
+			}
+		}
+		if err := store.Put(record); err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("保存文件记录失败: %w", err))
+		}
+		if record.Processing() {
+			s.background.Go(func(ctx context.Context) { trackFileProcessing(ctx, cfg, record.ID) })
+		}
 	}
 
-	if s.config.Logging.EnableRequestLog {
+	// 转换为OpenAI兼容的文件对象
+	fileObject := recordToFileObject(record)
+	fileObject.StatusDetails["upload_duration"] = duration.String()
+
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("文件上传成功",
 			zap.String("request_id", requestID),
 			zap.String("operation", "file_upload"),
@@ -179,10 +254,11 @@ func (s *fileService) UploadFile(ctx context.Context, fileHeader *multipart.File
 
 // GetFile 获取文件信息
 func (s *fileService) GetFile(ctx context.Context, fileID string) (*types.FileObject, error) {
+	cfg := s.config.Get()
 	startTime := time.Now()
 	requestID := fmt.Sprintf("getfile-%d", startTime.UnixNano())
 
-	if s.config.Logging.EnableRequestLog {
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("获取文件信息请求",
 			zap.String("request_id", requestID),
 			zap.String("operation", "get_file"),
@@ -190,22 +266,26 @@ func (s *fileService) GetFile(ctx context.Context, fileID string) (*types.FileOb
 		)
 	}
 
-	// TODO: 实现从Monica获取文件信息的逻辑
-	// 目前返回一个基本的文件对象
-	fileObject := &types.FileObject{
-		ID:     fileID,
-		Object: "file",
-		Status: "processed",
+	record, err := s.lookup(ctx, fileID)
+	if err != nil {
+		return nil, err
 	}
+	// 仍在解析时主动查询一次，服务重启后后台跟踪已经停止也能得到最新状态
+	if record.Processing() {
+		if updated, found, err := refreshFileStatus(ctx, cfg, fileID); err != nil {
+			logger.Warn("查询文件解析状态失败", zap.String("file_id", fileID), zap.Error(err))
+		} else if found {
+			record = updated
+		}
+	}
+	fileObject := recordToFileObject(record)
 
-	duration := time.Since(startTime)
-
-	if s.config.Logging.EnableRequestLog {
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("获取文件信息完成",
 			zap.String("request_id", requestID),
 			zap.String("operation", "get_file"),
 			zap.String("file_id", fileID),
-			zap.Duration("duration", duration),
+			zap.Duration("duration", time.Since(startTime)),
 			zap.Any("file_object", fileObject),
 		)
 	}
@@ -213,42 +293,81 @@ func (s *fileService) GetFile(ctx context.Context, fileID string) (*types.FileOb
 	return fileObject, nil
 }
 
-// ListFiles 列出文件
-func (s *fileService) ListFiles(ctx context.Context) ([]*types.FileObject, error) {
+// ListFiles 列出当前 API Key 上传的文件
+func (s *fileService) ListFiles(ctx context.Context, query FileListQuery) (*types.FileListResponse, error) {
+	cfg := s.config.Get()
 	startTime := time.Now()
 	requestID := fmt.Sprintf("listfiles-%d", startTime.UnixNano())
 
-	if s.config.Logging.EnableRequestLog {
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("列出文件请求",
 			zap.String("request_id", requestID),
 			zap.String("operation", "list_files"),
+			zap.String("purpose", query.Purpose),
+			zap.Int("limit", query.Limit),
+			zap.String("after", query.After),
+			zap.String("order", query.Order),
 		)
 	}
 
-	// TODO: 实现从Monica获取文件列表的逻辑
-	// 目前返回空列表
-	files := []*types.FileObject{}
+	if query.Limit < 0 || query.Limit > filestore.MaxListLimit {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("limit 必须在 1 到 %d 之间", filestore.MaxListLimit), nil)
+	}
+	if query.Order == "" {
+		query.Order = filestore.OrderDesc
+	}
+	if query.Order != filestore.OrderAsc && query.Order != filestore.OrderDesc {
+		return nil, errors.NewBadRequestError("order 必须是 asc 或 desc", nil)
+	}
 
-	duration := time.Since(startTime)
+	store := filestore.Current()
+	if store == nil {
+		return nil, errors.NewInternalError(errFileStoreUnavailable)
+	}
+	records, hasMore, err := store.List(filestore.ListOptions{
+		Owner:   filestore.OwnerFromContext(ctx),
+		Purpose: query.Purpose,
+		After:   query.After,
+		Limit:   query.Limit,
+		Order:   query.Order,
+	})
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	response := &types.FileListResponse{
+		Object:  "list",
+		Data:    make([]types.FileObject, len(records)),
+		HasMore: hasMore,
+	}
+	for i, record := range records {
+		response.Data[i] = *recordToFileObject(record)
+	}
+	if len(records) > 0 {
+		response.FirstID = records[0].ID
+		response.LastID = records[len(records)-1].ID
+	}
 
-	if s.config.Logging.EnableRequestLog {
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("列出文件完成",
 			zap.String("request_id", requestID),
 			zap.String("operation", "list_files"),
-			zap.Duration("duration", duration),
-			zap.Int("file_count", len(files)),
+			zap.Duration("duration", time.Since(startTime)),
+			zap.Int("file_count", len(records)),
+			zap.Bool("has_more", hasMore),
 		)
 	}
 
-	return files, nil
+	return response, nil
 }
 
-// DeleteFile 删除文件
+// DeleteFile 删除文件记录，并清除上传缓存中对应的条目
 func (s *fileService) DeleteFile(ctx context.Context, fileID string) error {
+	cfg := s.config.Get()
 	startTime := time.Now()
 	requestID := fmt.Sprintf("deletefile-%d", startTime.UnixNano())
 
-	if s.config.Logging.EnableRequestLog {
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("文件删除请求",
 			zap.String("request_id", requestID),
 			zap.String("operation", "delete_file"),
@@ -256,23 +375,213 @@ func (s *fileService) DeleteFile(ctx context.Context, fileID string) error {
 		)
 	}
 
-	// TODO: 实现从Monica删除文件的逻辑
-	// 目前返回成功
-	
-	duration := time.Since(startTime)
+	record, err := s.lookup(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if _, err := filestore.Current().Delete(record.ID); err != nil {
+		return errors.NewInternalError(err)
+	}
+	if err := filestore.RemoveContent(record.LocalPath); err != nil {
+		logger.Warn("删除文件本地副本失败", zap.String("file_id", fileID), zap.Error(err))
+	}
+	// Monica 没有删除文件的接口，清除缓存后相同内容再次出现时会重新上传
+	types.ForgetFile(record.File.FileUID)
 
-	if s.config.Logging.EnableRequestLog {
+	if cfg.Logging.EnableRequestLog {
 		logger.Info("文件删除完成",
 			zap.String("request_id", requestID),
 			zap.String("operation", "delete_file"),
 			zap.String("file_id", fileID),
-			zap.Duration("duration", duration),
+			zap.Duration("duration", time.Since(startTime)),
 		)
 	}
 
 	return nil
 }
 
+// GetFileContent 获取文件内容，优先读取本地副本，否则从上传时记录的 CDN 地址流式获取
+func (s *fileService) GetFileContent(ctx context.Context, fileID string, rangeHeader string) (*FileContent, error) {
+	cfg := s.config.Get()
+	startTime := time.Now()
+	requestID := fmt.Sprintf("filecontent-%d", startTime.UnixNano())
+
+	record, err := s.lookup(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &FileContent{
+		Filename:    record.File.FileName,
+		ContentType: record.MimeType,
+		ModTime:     time.Unix(record.CreatedAt, 0),
+	}
+	if content.ContentType == "" {
+		content.ContentType = "application/octet-stream"
+	}
+
+	if record.LocalPath != "" {
+		file, err := os.Open(record.LocalPath)
+		if err == nil {
+			content.Local = file
+			if cfg.Logging.EnableRequestLog {
+				logger.Info("读取文件本地副本",
+					zap.String("request_id", requestID),
+					zap.String("operation", "file_content"),
+					zap.String("file_id", fileID),
+					zap.String("range", rangeHeader),
+				)
+			}
+			return content, nil
+		}
+		logger.Warn("文件本地副本不可用，改为从CDN获取", zap.String("file_id", fileID), zap.Error(err))
+	}
+
+	if record.File.FileURL == "" {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("文件内容不可用: %s", fileID))
+	}
+	// CDN 地址是预签名的对象存储地址，不经过 resty 客户端：其请求头是发给 Monica API 的，
+	// 且会把 4xx 转换为错误，客户端无法区分 Range 无效和链接过期
+	if err := openCDNContent(ctx, utils.RestySSEClient().GetClient(), record.File.FileURL, rangeHeader, content); err != nil {
+		if cfg.Logging.EnableRequestLog {
+			logger.Error("从CDN获取文件内容失败",
+				zap.String("request_id", requestID),
+				zap.String("operation", "file_content"),
+				zap.String("file_id", fileID),
+				zap.Error(err),
+				zap.Duration("duration", time.Since(startTime)),
+			)
+		}
+		return nil, err
+	}
+
+	if cfg.Logging.EnableRequestLog {
+		logger.Info("从CDN获取文件内容",
+			zap.String("request_id", requestID),
+			zap.String("operation", "file_content"),
+			zap.String("file_id", fileID),
+			zap.String("range", rangeHeader),
+			zap.Int("status", content.StatusCode),
+			zap.Duration("duration", time.Since(startTime)),
+		)
+	}
+
+	return content, nil
+}
+
+// openCDNContent 从 CDN 流式获取文件内容，Range 原样转发。200/206 与 416 的响应写入 content
+// 由调用方转发，其余 4xx 按 CDN 的状态码返回错误（预签名地址过期时通常为 403/404）
+func openCDNContent(ctx context.Context, client *http.Client, url, rangeHeader string, content *FileContent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.NewRequestFailedError("获取文件内容失败", err)
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.NewRequestFailedError("获取文件内容失败", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		content.Body = http.NoBody
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		resp.Body.Close()
+		return errors.NewUpstreamStatusError(fmt.Sprintf("文件内容不可用，CDN 返回 %d", resp.StatusCode), resp.StatusCode)
+	case resp.StatusCode >= 500:
+		resp.Body.Close()
+		return errors.NewRequestFailedError("获取文件内容失败", fmt.Errorf("cdn status %d", resp.StatusCode))
+	default:
+		content.Body = resp.Body
+		content.ContentLength = resp.Header.Get("Content-Length")
+	}
+	content.StatusCode = resp.StatusCode
+	content.ContentRange = resp.Header.Get("Content-Range")
+	return nil
+}
+
+// resolveFileParts 将消息中引用的文件ID解析为文件存储中的文件信息，仍在解析的文件会等待其完成；
+// 文件不存在、属于其他 API Key、解析失败或等待超时时返回 400
+func resolveFileParts(ctx context.Context, cfg *config.Config) error {
+	for _, parts := range types.MessagePartsFromContext(ctx) {
+		for i := range parts {
+			fileID := parts[i].FileID()
+			if fileID == "" {
+				continue
+			}
+			store := filestore.Current()
+			if store == nil {
+				return errors.NewInternalError(errFileStoreUnavailable)
+			}
+			record, found, err := store.Get(fileID)
+			if err != nil {
+				return errors.NewInternalError(err)
+			}
+			if !found || record.Owner != filestore.OwnerFromContext(ctx) {
+				return errors.NewBadRequestError(fmt.Sprintf("引用的文件不存在: %s", fileID), nil)
+			}
+			if record, err = waitFileProcessed(ctx, cfg, record); err != nil {
+				return err
+			}
+			if record.Status == filestore.StatusError {
+				return errors.NewBadRequestError(fmt.Sprintf("引用的文件处理失败: %s (%s)", fileID, record.StatusError), nil)
+			}
+			parts[i].Resolved = &record.File
+		}
+	}
+	return nil
+}
+
+// errFileStoreUnavailable 文件存储未初始化
+var errFileStoreUnavailable = fmt.Errorf("文件存储未初始化")
+
+// lookup 读取当前 API Key 上传的文件记录，不存在或属于其他 API Key 时返回 404
+func (s *fileService) lookup(ctx context.Context, fileID string) (filestore.Record, error) {
+	store := filestore.Current()
+	if store == nil {
+		return filestore.Record{}, errors.NewInternalError(errFileStoreUnavailable)
+	}
+	record, found, err := store.Get(fileID)
+	if err != nil {
+		return filestore.Record{}, errors.NewInternalError(err)
+	}
+	if !found || record.Owner != filestore.OwnerFromContext(ctx) {
+		return filestore.Record{}, errors.NewNotFoundError(fmt.Sprintf("文件不存在: %s", fileID))
+	}
+	return record, nil
+}
+
+// recordToFileObject 转换为OpenAI兼容的文件对象
+func recordToFileObject(record filestore.Record) *types.FileObject {
+	fileObject := &types.FileObject{
+		ID:        record.ID,
+		Object:    "file",
+		Bytes:     int(record.File.FileSize),
+		CreatedAt: record.CreatedAt,
+		Filename:  record.File.FileName,
+		Purpose:   record.Purpose,
+		Status:    record.Status,
+		StatusDetails: map[string]interface{}{
+			"tokens":         record.File.FileTokens,
+			"chunks":         record.File.FileChunks,
+			"index_state":    record.IndexState,
+			"index_progress": record.IndexProgress,
+			"mime_type":      record.MimeType,
+		},
+	}
+	// 早期版本的记录没有状态，上传时已等待解析完成
+	if fileObject.Status == "" {
+		fileObject.Status = filestore.StatusProcessed
+	}
+	if record.StatusError != "" {
+		fileObject.StatusDetails["error"] = record.StatusError
+	}
+	return fileObject
+}
+
 // shouldParseFile 判断是否需要LLM解析文件内容
 func shouldParseFile(purpose, mimeType string) bool {
 	// 根据用途和文件类型决定是否需要解析
@@ -352,9 +661,3 @@ func getMimeTypeFromExtension(ext string) string {
 		return "application/octet-stream"
 	}
 }
-
-// hashFileData 计算文件数据的MD5哈希值
-func hashFileData(data []byte) string {
-	hash := md5.Sum(data)
-	return hex.EncodeToString(hash[:])
-}
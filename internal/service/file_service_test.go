@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"monica-proxy/internal/errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenCDNContent(t *testing.T) {
+	var gotHeader http.Header
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		switch r.URL.Path {
+		case "/file":
+			http.ServeContent(w, r, "a.txt", testModTime, strings.NewReader("hello world"))
+		case "/expired":
+			http.Error(w, "<Error>AccessDenied</Error>", http.StatusForbidden)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "boom", http.StatusBadGateway)
+		}
+	}))
+	defer cdn.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		rangeHdr   string
+		wantStatus int // 返回错误时为错误的状态码
+		wantErr    bool
+		wantBody   string
+		wantRange  string
+	}{
+		{"full", "/file", "", http.StatusOK, false, "hello world", ""},
+		{"range", "/file", "bytes=0-4", http.StatusPartialContent, false, "hello", "bytes 0-4/11"},
+		{"unsatisfiable range", "/file", "bytes=100-", http.StatusRequestedRangeNotSatisfiable, false, "", "bytes */11"},
+		{"expired presigned url", "/expired", "", http.StatusForbidden, true, "", ""},
+		{"missing object", "/missing", "", http.StatusNotFound, true, "", ""},
+		{"cdn error", "/error", "", http.StatusBadGateway, true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := &FileContent{}
+			err := openCDNContent(context.Background(), cdn.Client(), cdn.URL+tt.path, tt.rangeHdr, content)
+			if tt.wantErr {
+				var appErr *errors.AppError
+				if !stderrors.As(err, &appErr) {
+					t.Fatalf("err = %v, want AppError", err)
+				}
+				if appErr.Status != tt.wantStatus {
+					t.Errorf("status = %d, want %d", appErr.Status, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer content.Close()
+			if content.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", content.StatusCode, tt.wantStatus)
+			}
+			body, _ := io.ReadAll(content.Body)
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if content.ContentRange != tt.wantRange {
+				t.Errorf("content range = %q, want %q", content.ContentRange, tt.wantRange)
+			}
+		})
+	}
+
+	// 不应把发给 Monica API 的请求头带到 CDN
+	openCDNContent(context.Background(), cdn.Client(), cdn.URL+"/file", "", &FileContent{})
+	for _, name := range []string{"X-Client-Locale", "Content-Type", "Cookie"} {
+		if v := gotHeader.Get(name); v != "" {
+			t.Errorf("header %s sent to CDN: %q", name, v)
+		}
+	}
+}
+
+var testModTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -19,11 +19,11 @@ type ImageService interface {
 
 // imageService 图像服务实现
 type imageService struct {
-	config *config.Config
+	config *config.Holder
 }
 
 // NewImageService 创建图像服务实例
-func NewImageService(cfg *config.Config) ImageService {
+func NewImageService(cfg *config.Holder) ImageService {
 	return &imageService{
 		config: cfg,
 	}
@@ -31,6 +31,9 @@ func NewImageService(cfg *config.Config) ImageService {
 
 // GenerateImage 生成图像
 func (s *imageService) GenerateImage(ctx context.Context, req *types.ImageGenerationRequest) (*types.ImageGenerationResponse, error) {
+	// 每个请求读取一次配置，热重载不影响进行中的请求
+	cfg := s.config.Get()
+
 	// 验证请求
 	if req.Prompt == "" {
 		return nil, errors.NewInvalidInputError("提示词不能为空", nil)
@@ -55,7 +58,7 @@ func (s *imageService) GenerateImage(ctx context.Context, req *types.ImageGenera
 	)
 
 	// 调用Monica API生成图像
-	response, err := monica.GenerateImage(ctx, s.config, req)
+	response, err := monica.GenerateImage(ctx, cfg, req)
 	if err != nil {
 		logger.Error("生成图像失败", zap.Error(err))
 		return nil, errors.NewImageGenerationError(err)
@@ -16,11 +16,11 @@ type ModelService interface {
 
 // modelService 模型服务实现
 type modelService struct {
-	config *config.Config
+	config *config.Holder
 }
 
 // NewModelService 创建模型服务实例
-func NewModelService(cfg *config.Config) ModelService {
+func NewModelService(cfg *config.Holder) ModelService {
 	return &modelService{
 		config: cfg,
 	}
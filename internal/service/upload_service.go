@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/filestore"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/types"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UploadService 分片上传服务接口，与 OpenAI Uploads API 一致
+type UploadService interface {
+	// CreateUpload 创建分片上传
+	CreateUpload(ctx context.Context, req types.CreateUploadRequest) (*types.UploadObject, error)
+	// GetUpload 获取上传状态及已接收的分片
+	GetUpload(ctx context.Context, uploadID string) (*types.UploadObject, error)
+	// AddPart 添加一个分片
+	AddPart(ctx context.Context, uploadID string, data io.Reader) (*types.UploadPartObject, error)
+	// CompleteUpload 按顺序组装分片并上传为文件
+	CompleteUpload(ctx context.Context, uploadID string, req types.CompleteUploadRequest) (*types.UploadObject, error)
+	// CancelUpload 取消上传并删除暂存的分片
+	CancelUpload(ctx context.Context, uploadID string) (*types.UploadObject, error)
+}
+
+// uploadService 分片上传服务实现，组装后的文件交给 fileService 上传
+type uploadService struct {
+	config *config.Holder
+	files  *fileService
+
+	// completing 正在完成的上传，同一上传的并发完成请求只处理一个
+	mu         sync.Mutex
+	completing map[string]bool
+}
+
+// NewUploadService 创建分片上传服务实例，组装后的文件与 NewFileService 一样通过 background 跟踪解析状态
+func NewUploadService(cfg *config.Holder, background Background) UploadService {
+	return &uploadService{
+		config:     cfg,
+		files:      &fileService{config: cfg, background: background},
+		completing: make(map[string]bool),
+	}
+}
+
+// CreateUpload 创建分片上传
+func (s *uploadService) CreateUpload(ctx context.Context, req types.CreateUploadRequest) (*types.UploadObject, error) {
+	cfg := s.config.Get()
+
+	if req.Filename == "" || req.Purpose == "" {
+		return nil, errors.NewBadRequestError("filename和purpose参数不能为空", nil)
+	}
+	if req.Bytes <= 0 {
+		return nil, errors.NewBadRequestError("bytes参数必须是正整数", nil)
+	}
+	if req.Bytes > types.MaxFileSize {
+		return nil, errors.NewBadRequestError(
+			fmt.Sprintf("文件大小超出限制: %d bytes > %d bytes", req.Bytes, types.MaxFileSize),
+			nil,
+		)
+	}
+
+	store := filestore.Current()
+	if store == nil {
+		return nil, errors.NewInternalError(errFileStoreUnavailable)
+	}
+	// 创建时顺带清理过期的上传，不需要单独的定时任务
+	if n, err := store.ExpireUploads(time.Now()); err != nil {
+		logger.Warn("清理过期上传失败", zap.Error(err))
+	} else if n > 0 {
+		logger.Info("已清理过期上传", zap.Int("count", n))
+	}
+
+	now := time.Now()
+	upload := filestore.Upload{
+		ID:        filestore.NewUploadID(),
+		Owner:     filestore.OwnerFromContext(ctx),
+		Filename:  filepath.Base(req.Filename),
+		Purpose:   req.Purpose,
+		MimeType:  req.MimeType,
+		Bytes:     req.Bytes,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(cfg.Files.UploadExpiry).Unix(),
+		Status:    filestore.UploadPending,
+	}
+	if err := store.PutUpload(upload); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("保存上传记录失败: %w", err))
+	}
+
+	if cfg.Logging.EnableRequestLog {
+		logger.Info("创建分片上传",
+			zap.String("operation", "create_upload"),
+			zap.String("upload_id", upload.ID),
+			zap.String("filename", upload.Filename),
+			zap.Int64("bytes", upload.Bytes),
+			zap.String("purpose", upload.Purpose),
+		)
+	}
+	return uploadToObject(upload, nil), nil
+}
+
+// GetUpload 获取上传状态，已完成时附带生成的文件
+func (s *uploadService) GetUpload(ctx context.Context, uploadID string) (*types.UploadObject, error) {
+	upload, err := s.lookup(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	var file *types.FileObject
+	if upload.FileID != "" {
+		if record, found, err := filestore.Current().Get(upload.FileID); err == nil && found {
+			file = recordToFileObject(record)
+		}
+	}
+	return uploadToObject(upload, file), nil
+}
+
+// AddPart 暂存一个分片，分片总大小不能超过创建时声明的 bytes
+func (s *uploadService) AddPart(ctx context.Context, uploadID string, data io.Reader) (*types.UploadPartObject, error) {
+	cfg := s.config.Get()
+
+	upload, err := s.lookup(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPending(upload); err != nil {
+		return nil, err
+	}
+
+	store := filestore.Current()
+	part := filestore.UploadPart{ID: filestore.NewPartID(), CreatedAt: time.Now().Unix()}
+	part.Size, part.SHA256, err = store.SavePart(upload.ID, part.ID, data, upload.Bytes-upload.ReceivedBytes())
+	if stderrors.Is(err, filestore.ErrPartTooLarge) {
+		return nil, errors.NewBadRequestError("分片总大小超过上传声明的 bytes", nil)
+	}
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("保存分片失败: %w", err))
+	}
+
+	// 写入分片期间可能有其他分片完成或上传被取消，在事务中重新检查
+	upload, _, err = store.UpdateUpload(upload.ID, func(u *filestore.Upload) error {
+		if err := checkPending(*u); err != nil {
+			return err
+		}
+		if u.ReceivedBytes()+part.Size > u.Bytes {
+			return errors.NewBadRequestError("分片总大小超过上传声明的 bytes", nil)
+		}
+		u.Parts = append(u.Parts, part)
+		return nil
+	})
+	if err != nil {
+		store.RemovePart(uploadID, part.ID)
+		var appErr *errors.AppError
+		if stderrors.As(err, &appErr) {
+			return nil, appErr
+		}
+		return nil, errors.NewInternalError(err)
+	}
+
+	if cfg.Logging.EnableRequestLog {
+		logger.Info("接收上传分片",
+			zap.String("operation", "add_upload_part"),
+			zap.String("upload_id", upload.ID),
+			zap.String("part_id", part.ID),
+			zap.Int64("size", part.Size),
+			zap.Int64("received", upload.ReceivedBytes()),
+			zap.Int64("bytes", upload.Bytes),
+		)
+	}
+	return partToObject(upload.ID, part), nil
+}
+
+// CompleteUpload 校验并组装分片，上传到 Monica 后记录到文件存储；
+// 失败时上传保持 pending，分片仍然保留，客户端可以补传分片后重试
+func (s *uploadService) CompleteUpload(ctx context.Context, uploadID string, req types.CompleteUploadRequest) (*types.UploadObject, error) {
+	cfg := s.config.Get()
+	startTime := time.Now()
+	requestID := fmt.Sprintf("upload-%d", startTime.UnixNano())
+
+	if len(req.PartIDs) == 0 {
+		return nil, errors.NewBadRequestError("part_ids参数不能为空", nil)
+	}
+	if !s.beginComplete(uploadID) {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("上传正在完成中: %s", uploadID), nil)
+	}
+	defer s.endComplete(uploadID)
+
+	upload, err := s.lookup(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPending(upload); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	seen := make(map[string]bool, len(req.PartIDs))
+	for _, id := range req.PartIDs {
+		part, ok := upload.Part(id)
+		if !ok {
+			return nil, errors.NewBadRequestError(fmt.Sprintf("分片不存在: %s", id), nil)
+		}
+		if seen[id] {
+			return nil, errors.NewBadRequestError(fmt.Sprintf("分片重复: %s", id), nil)
+		}
+		seen[id] = true
+		total += part.Size
+	}
+	if total != upload.Bytes {
+		return nil, errors.NewBadRequestError(
+			fmt.Sprintf("分片总大小与上传声明的 bytes 不一致: %d != %d", total, upload.Bytes),
+			nil,
+		)
+	}
+
+	store := filestore.Current()
+	file, sum, err := store.AssembleUpload(upload, req.PartIDs)
+	if stderrors.Is(err, filestore.ErrPartChecksum) {
+		return nil, errors.NewBadRequestError("暂存的分片已损坏，请重新上传该分片", err)
+	}
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("组装分片失败: %w", err))
+	}
+	defer func() {
+		file.Close()
+		filestore.RemoveContent(file.Name())
+	}()
+	if req.MD5 != "" && !strings.EqualFold(req.MD5, sum) {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("文件 MD5 不一致: %s != %s", req.MD5, sum), nil)
+	}
+
+	fileObject, err := s.files.uploadContent(ctx, cfg, requestID, startTime, file, upload.Filename, upload.Bytes, upload.MimeType, upload.Purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, _, err = store.UpdateUpload(upload.ID, func(u *filestore.Upload) error {
+		u.Status = filestore.UploadCompleted
+		u.FileID = fileObject.ID
+		return nil
+	})
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("保存上传记录失败: %w", err))
+	}
+	if err := store.RemoveUploadParts(upload.ID); err != nil {
+		logger.Warn("删除暂存分片失败", zap.String("upload_id", upload.ID), zap.Error(err))
+	}
+
+	if cfg.Logging.EnableRequestLog {
+		logger.Info("分片上传完成",
+			zap.String("request_id", requestID),
+			zap.String("operation", "complete_upload"),
+			zap.String("upload_id", upload.ID),
+			zap.String("file_id", fileObject.ID),
+			zap.Int("parts", len(req.PartIDs)),
+			zap.Duration("duration", time.Since(startTime)),
+		)
+	}
+	return uploadToObject(upload, fileObject), nil
+}
+
+// CancelUpload 取消仍在进行的上传并删除暂存的分片
+func (s *uploadService) CancelUpload(ctx context.Context, uploadID string) (*types.UploadObject, error) {
+	cfg := s.config.Get()
+
+	if _, err := s.lookup(ctx, uploadID); err != nil {
+		return nil, err
+	}
+	if !s.beginComplete(uploadID) {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("上传正在完成中: %s", uploadID), nil)
+	}
+	defer s.endComplete(uploadID)
+
+	store := filestore.Current()
+	upload, _, err := store.UpdateUpload(uploadID, func(u *filestore.Upload) error {
+		if err := checkPending(*u); err != nil {
+			return err
+		}
+		u.Status = filestore.UploadCancelled
+		return nil
+	})
+	if err != nil {
+		var appErr *errors.AppError
+		if stderrors.As(err, &appErr) {
+			return nil, appErr
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	if err := store.RemoveUploadParts(upload.ID); err != nil {
+		logger.Warn("删除暂存分片失败", zap.String("upload_id", upload.ID), zap.Error(err))
+	}
+
+	if cfg.Logging.EnableRequestLog {
+		logger.Info("取消分片上传",
+			zap.String("operation", "cancel_upload"),
+			zap.String("upload_id", upload.ID),
+		)
+	}
+	return uploadToObject(upload, nil), nil
+}
+
+func (s *uploadService) beginComplete(uploadID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.completing[uploadID] {
+		return false
+	}
+	s.completing[uploadID] = true
+	return true
+}
+
+func (s *uploadService) endComplete(uploadID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.completing, uploadID)
+}
+
+// lookup 读取当前 API Key 创建的上传，不存在或属于其他 API Key 时返回 404
+func (s *uploadService) lookup(ctx context.Context, uploadID string) (filestore.Upload, error) {
+	store := filestore.Current()
+	if store == nil {
+		return filestore.Upload{}, errors.NewInternalError(errFileStoreUnavailable)
+	}
+	upload, found, err := store.GetUpload(uploadID)
+	if err != nil {
+		return filestore.Upload{}, errors.NewInternalError(err)
+	}
+	if !found || upload.Owner != filestore.OwnerFromContext(ctx) {
+		return filestore.Upload{}, errors.NewNotFoundError(fmt.Sprintf("上传不存在: %s", uploadID))
+	}
+	// 过期的上传在下次创建时才会被清理，这里按过期处理
+	if upload.Status == filestore.UploadPending && upload.ExpiresAt <= time.Now().Unix() {
+		upload.Status = filestore.UploadExpired
+	}
+	return upload, nil
+}
+
+// checkPending 只有 pending 的上传可以添加分片、完成或取消
+func checkPending(upload filestore.Upload) error {
+	if upload.Status == filestore.UploadPending && upload.ExpiresAt <= time.Now().Unix() {
+		upload.Status = filestore.UploadExpired
+	}
+	if upload.Status != filestore.UploadPending {
+		return errors.NewBadRequestError(fmt.Sprintf("上传已%s: %s", uploadStatusText(upload.Status), upload.ID), nil)
+	}
+	return nil
+}
+
+func uploadStatusText(status string) string {
+	switch status {
+	case filestore.UploadCompleted:
+		return "完成"
+	case filestore.UploadCancelled:
+		return "取消"
+	case filestore.UploadExpired:
+		return "过期"
+	}
+	return status
+}
+
+// uploadToObject 转换为OpenAI兼容的上传对象
+func uploadToObject(upload filestore.Upload, file *types.FileObject) *types.UploadObject {
+	object := &types.UploadObject{
+		ID:        upload.ID,
+		Object:    "upload",
+		Bytes:     upload.Bytes,
+		CreatedAt: upload.CreatedAt,
+		Filename:  upload.Filename,
+		Purpose:   upload.Purpose,
+		Status:    upload.Status,
+		ExpiresAt: upload.ExpiresAt,
+		File:      file,
+	}
+	// 只有仍可续传的上传返回已接收的分片
+	if upload.Status == filestore.UploadPending {
+		for _, part := range upload.Parts {
+			object.Parts = append(object.Parts, *partToObject(upload.ID, part))
+		}
+	}
+	return object
+}
+
+// partToObject 转换为OpenAI兼容的分片对象
+func partToObject(uploadID string, part filestore.UploadPart) *types.UploadPartObject {
+	return &types.UploadPartObject{
+		ID:        part.ID,
+		Object:    "upload.part",
+		CreatedAt: part.CreatedAt,
+		UploadID:  uploadID,
+		Bytes:     part.Size,
+		SHA256:    part.SHA256,
+	}
+}
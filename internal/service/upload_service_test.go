@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/filestore"
+	"monica-proxy/internal/types"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testBackground 测试用的后台任务运行器，测试结束时取消任务并等待退出
+type testBackground struct {
+	ctx   context.Context
+	tasks sync.WaitGroup
+}
+
+func newTestBackground(t *testing.T) *testBackground {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &testBackground{ctx: ctx}
+	t.Cleanup(func() {
+		cancel()
+		b.tasks.Wait()
+	})
+	return b
+}
+
+func (b *testBackground) Go(task func(ctx context.Context)) {
+	b.tasks.Add(1)
+	go func() {
+		defer b.tasks.Done()
+		task(b.ctx)
+	}()
+}
+
+// newTestUploadService 使用临时目录中的文件存储创建分片上传服务
+func newTestUploadService(t *testing.T) *uploadService {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.GetDefaultConfig()
+	cfg.Files.DBPath = filepath.Join(dir, "files.db")
+	cfg.Files.ContentDir = filepath.Join(dir, "files")
+	cfg.Files.UploadsDir = filepath.Join(dir, "uploads")
+	if err := filestore.Init(cfg); err != nil {
+		t.Fatalf("filestore.Init: %v", err)
+	}
+	t.Cleanup(func() { filestore.Close() })
+	return NewUploadService(config.NewHolder(cfg, nil), newTestBackground(t)).(*uploadService)
+}
+
+// wantStatus 检查错误是否为指定状态码的 AppError
+func wantStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) {
+		t.Fatalf("err = %v, want AppError with status %d", err, status)
+	}
+	if appErr.Status != status {
+		t.Fatalf("status = %d (%s), want %d", appErr.Status, appErr.Message, status)
+	}
+}
+
+func TestCreateUploadValidation(t *testing.T) {
+	s := newTestUploadService(t)
+	tests := []struct {
+		name string
+		req  types.CreateUploadRequest
+	}{
+		{"missing filename", types.CreateUploadRequest{Purpose: "assistants", Bytes: 1}},
+		{"missing purpose", types.CreateUploadRequest{Filename: "a.txt", Bytes: 1}},
+		{"zero bytes", types.CreateUploadRequest{Filename: "a.txt", Purpose: "assistants"}},
+		{"too large", types.CreateUploadRequest{Filename: "a.txt", Purpose: "assistants", Bytes: types.MaxFileSize + 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateUpload(context.Background(), tt.req)
+			wantStatus(t, err, http.StatusBadRequest)
+		})
+	}
+
+	upload, err := s.CreateUpload(context.Background(), types.CreateUploadRequest{
+		Filename: "../dir/a.txt", Purpose: "assistants", Bytes: 11,
+	})
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+	if upload.Filename != "a.txt" || upload.Status != filestore.UploadPending || upload.ExpiresAt <= upload.CreatedAt {
+		t.Errorf("upload = %+v", upload)
+	}
+}
+
+func TestUploadPartsAndComplete(t *testing.T) {
+	s := newTestUploadService(t)
+	ctx := filestore.WithOwner(context.Background(), "sk-owner")
+
+	upload, err := s.CreateUpload(ctx, types.CreateUploadRequest{Filename: "a.txt", Purpose: "assistants", Bytes: 11})
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+	first, err := s.AddPart(ctx, upload.ID, strings.NewReader("hello "))
+	if err != nil {
+		t.Fatalf("AddPart: %v", err)
+	}
+	second, err := s.AddPart(ctx, upload.ID, strings.NewReader("world"))
+	if err != nil {
+		t.Fatalf("AddPart: %v", err)
+	}
+
+	// 超出声明大小的分片被拒绝且不记录
+	_, err = s.AddPart(ctx, upload.ID, strings.NewReader("!"))
+	wantStatus(t, err, http.StatusBadRequest)
+
+	// 其他 API Key 看不到该上传
+	_, err = s.GetUpload(filestore.WithOwner(context.Background(), "sk-other"), upload.ID)
+	wantStatus(t, err, http.StatusNotFound)
+
+	got, err := s.GetUpload(ctx, upload.ID)
+	if err != nil {
+		t.Fatalf("GetUpload: %v", err)
+	}
+	if len(got.Parts) != 2 || got.Parts[0].ID != first.ID || got.Parts[1].ID != second.ID {
+		t.Fatalf("parts = %+v", got.Parts)
+	}
+
+	tests := []struct {
+		name    string
+		req     types.CompleteUploadRequest
+		corrupt bool
+		want    string
+	}{
+		{"no parts", types.CompleteUploadRequest{}, false, "part_ids参数不能为空"},
+		{"unknown part", types.CompleteUploadRequest{PartIDs: []string{first.ID, "part_missing"}}, false, "分片不存在"},
+		{"duplicate part", types.CompleteUploadRequest{PartIDs: []string{first.ID, first.ID}}, false, "分片重复"},
+		{"size mismatch", types.CompleteUploadRequest{PartIDs: []string{second.ID}}, false, "分片总大小与上传声明的 bytes 不一致"},
+		{"md5 mismatch", types.CompleteUploadRequest{PartIDs: []string{first.ID, second.ID}, MD5: "00000000000000000000000000000000"}, false, "文件 MD5 不一致"},
+		{"corrupted part", types.CompleteUploadRequest{PartIDs: []string{first.ID, second.ID}}, true, "暂存的分片已损坏"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.corrupt {
+				path := filepath.Join(s.config.Get().Files.UploadsDir, upload.ID, second.ID)
+				if err := os.WriteFile(path, []byte("W0rld"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := s.CompleteUpload(ctx, upload.ID, tt.req)
+			wantStatus(t, err, http.StatusBadRequest)
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+			// 完成失败后上传保持 pending，可以继续重试
+			if got, _ := s.GetUpload(ctx, upload.ID); got == nil || got.Status != filestore.UploadPending {
+				t.Errorf("upload after failed complete = %+v", got)
+			}
+		})
+	}
+
+	cancelled, err := s.CancelUpload(ctx, upload.ID)
+	if err != nil {
+		t.Fatalf("CancelUpload: %v", err)
+	}
+	if cancelled.Status != filestore.UploadCancelled || len(cancelled.Parts) != 0 {
+		t.Errorf("cancelled = %+v", cancelled)
+	}
+	if _, err := os.Stat(filepath.Join(s.config.Get().Files.UploadsDir, upload.ID)); !os.IsNotExist(err) {
+		t.Error("parts kept after cancel")
+	}
+	_, err = s.AddPart(ctx, upload.ID, strings.NewReader("x"))
+	wantStatus(t, err, http.StatusBadRequest)
+	_, err = s.CompleteUpload(ctx, upload.ID, types.CompleteUploadRequest{PartIDs: []string{first.ID}})
+	wantStatus(t, err, http.StatusBadRequest)
+}
+
+func TestCompleteUploadInProgress(t *testing.T) {
+	s := newTestUploadService(t)
+	if !s.beginComplete("upload_x") {
+		t.Fatal("first beginComplete failed")
+	}
+	// 同一上传的并发完成或取消请求被拒绝
+	_, err := s.CompleteUpload(context.Background(), "upload_x", types.CompleteUploadRequest{PartIDs: []string{"part_a"}})
+	wantStatus(t, err, http.StatusBadRequest)
+	s.endComplete("upload_x")
+	if !s.beginComplete("upload_x") {
+		t.Error("beginComplete failed after endComplete")
+	}
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"monica-proxy/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useRecorder 安装记录 span 的 TracerProvider，测试结束后恢复
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"success", nil, codes.Unset},
+		{"error", errors.New("upstream failed"), codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := useRecorder(t)
+			_, span := Start(context.Background(), "op")
+			End(span, tt.err)
+
+			spans := rec.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("ended spans = %d, want 1", len(spans))
+			}
+			if got := spans[0].Status().Code; got != tt.want {
+				t.Errorf("status = %v, want %v", got, tt.want)
+			}
+			if (len(spans[0].Events()) > 0) != (tt.err != nil) {
+				t.Errorf("events = %v", spans[0].Events())
+			}
+		})
+	}
+}
+
+func TestStartServerPropagation(t *testing.T) {
+	useRecorder(t)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name      string
+		header    string
+		wantTrace string
+	}{
+		{"continues client trace", "00-" + traceID + "-00f067aa0ba902b7-01", traceID},
+		{"starts new trace", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carrier := propagation.MapCarrier{}
+			if tt.header != "" {
+				carrier.Set("traceparent", tt.header)
+			}
+			ctx, span := StartServer(context.Background(), carrier, "GET /")
+			defer span.End()
+
+			got := span.SpanContext().TraceID().String()
+			if tt.wantTrace != "" && got != tt.wantTrace {
+				t.Errorf("trace id = %s, want %s", got, tt.wantTrace)
+			}
+			if field := LogField(ctx); field.String != got {
+				t.Errorf("log field = %q, want %q", field.String, got)
+			}
+		})
+	}
+
+	if field := LogField(context.Background()); field.Key != "" {
+		t.Errorf("log field without trace = %+v", field)
+	}
+}
+
+func TestInitFileExporter(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	path := filepath.Join(t.TempDir(), "traces", "spans.jsonl")
+	cfg := config.GetDefaultConfig()
+	cfg.Tracing = config.TracingConfig{Enabled: true, Exporter: "file", FilePath: path, SampleRatio: 1}
+	shutdown, err := Init(cfg)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	_, span := Start(context.Background(), "chat.completion")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"chat.completion"`) {
+		t.Errorf("trace file = %s", data)
+	}
+
+	// 未启用时安装 no-op 实现，不产生有效的 span
+	cfg.Tracing.Enabled = false
+	if _, err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	_, span = Start(context.Background(), "noop")
+	if span.SpanContext().IsValid() {
+		t.Error("span recorded while tracing disabled")
+	}
+}
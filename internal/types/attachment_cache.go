@@ -0,0 +1,107 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"monica-proxy/internal/attachcache"
+	"monica-proxy/internal/config"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+var (
+	attachmentCache atomic.Pointer[attachcache.Cache[FileInfo]]
+	attachmentMu    sync.Mutex
+)
+
+// InitAttachmentCache 按配置创建附件缓存；磁盘路径未变化时保留已缓存的条目，只调整容量和有效期
+func InitAttachmentCache(cfg *config.Config) error {
+	attachmentMu.Lock()
+	defer attachmentMu.Unlock()
+
+	opts := attachcache.Options{
+		MaxEntries: cfg.AttachmentCache.MaxEntries,
+		TTL:        cfg.AttachmentCache.TTL,
+		DiskPath:   cfg.AttachmentCache.DBPath,
+	}
+	old := attachmentCache.Load()
+	if old != nil && old.Options().DiskPath == opts.DiskPath {
+		old.SetLimits(opts.MaxEntries, opts.TTL)
+		return nil
+	}
+
+	// 新缓存打开成功后才替换，失败时继续使用旧缓存
+	cache, err := attachcache.New[FileInfo](opts)
+	if err != nil {
+		return err
+	}
+	attachmentCache.Store(cache)
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// CloseAttachmentCache 关闭附件缓存的磁盘层
+func CloseAttachmentCache() error {
+	attachmentMu.Lock()
+	defer attachmentMu.Unlock()
+	if old := attachmentCache.Swap(nil); old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// AttachmentCacheStats 返回附件缓存的命中统计
+func AttachmentCacheStats() attachcache.Stats {
+	return currentAttachmentCache().Stats()
+}
+
+// currentAttachmentCache 返回当前缓存，未初始化时按默认配置创建仅内存的缓存
+func currentAttachmentCache() *attachcache.Cache[FileInfo] {
+	if cache := attachmentCache.Load(); cache != nil {
+		return cache
+	}
+	defaults := config.GetDefaultConfig().AttachmentCache
+	cache, _ := attachcache.New[FileInfo](attachcache.Options{MaxEntries: defaults.MaxEntries, TTL: defaults.TTL})
+	if attachmentCache.CompareAndSwap(nil, cache) {
+		return cache
+	}
+	return attachmentCache.Load()
+}
+
+// cachedAttachment 读取缓存的文件信息，返回副本，调用方修改不影响缓存
+func cachedAttachment(key string) (*FileInfo, bool) {
+	info, ok := currentAttachmentCache().Get(key)
+	if !ok {
+		return nil, false
+	}
+	return &info, true
+}
+
+// storeAttachment 缓存上传得到的文件信息
+func storeAttachment(key string, info *FileInfo) {
+	currentAttachmentCache().Set(key, *info)
+}
+
+// ForgetFile 从附件缓存中移除指定 FileUID 的条目，之后相同内容会重新上传
+func ForgetFile(fileUID string) {
+	currentAttachmentCache().DeleteFunc(func(info FileInfo) bool {
+		return info.FileUID == fileUID
+	})
+}
+
+// contentDigest 附件缓存键使用的内容哈希，使用完整内容的 SHA-256，不同内容不会得到相同的键
+func contentDigest() hash.Hash {
+	return sha256.New()
+}
+
+// attachmentKey 由账号Cookie的哈希、完整内容的哈希、文件名和MIME类型生成缓存键，digest 中已写入文件内容。
+// FileUID 只在上传它的账号下有效，热重载更换 Cookie 后不会复用旧账号上传的文件
+func attachmentKey(digest hash.Hash, cookie, fileName, mimeType string) string {
+	return strconv.FormatUint(xxhash.Sum64String(cookie), 16) + "|" + hex.EncodeToString(digest.Sum(nil)) + "|" + mimeType + "|" + fileName
+}
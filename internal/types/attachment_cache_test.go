@@ -0,0 +1,96 @@
+package types
+
+import (
+	"monica-proxy/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachmentKey(t *testing.T) {
+	key := func(cookie, content, fileName, mimeType string) string {
+		digest := contentDigest()
+		digest.Write([]byte(content))
+		return attachmentKey(digest, cookie, fileName, mimeType)
+	}
+	base := key("cookie", "hello", "a.txt", "text/plain")
+
+	tests := []struct {
+		name  string
+		other string
+		same  bool
+	}{
+		{"same input", key("cookie", "hello", "a.txt", "text/plain"), true},
+		{"different content", key("cookie", "hellO", "a.txt", "text/plain"), false},
+		{"different file name", key("cookie", "hello", "b.txt", "text/plain"), false},
+		{"different mime type", key("cookie", "hello", "a.txt", "text/markdown"), false},
+		{"cookie changed on reload", key("rotated", "hello", "a.txt", "text/plain"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.other == base) != tt.same {
+				t.Errorf("key %q vs %q, same = %v", tt.other, base, tt.same)
+			}
+		})
+	}
+}
+
+func TestForgetFile(t *testing.T) {
+	storeAttachment("key-a", &FileInfo{FileUID: "uid-a", FileName: "a.txt"})
+	storeAttachment("key-b", &FileInfo{FileUID: "uid-b", FileName: "b.txt"})
+
+	info, ok := cachedAttachment("key-a")
+	if !ok || info.FileUID != "uid-a" {
+		t.Fatalf("cachedAttachment = %+v, %v", info, ok)
+	}
+	// 返回副本，修改不影响缓存
+	info.FileName = "changed"
+	if again, _ := cachedAttachment("key-a"); again.FileName != "a.txt" {
+		t.Errorf("cached entry modified through returned copy: %q", again.FileName)
+	}
+
+	ForgetFile("uid-a")
+	if _, ok := cachedAttachment("key-a"); ok {
+		t.Error("forgotten file still cached")
+	}
+	if _, ok := cachedAttachment("key-b"); !ok {
+		t.Error("unrelated file removed")
+	}
+}
+
+func TestInitAttachmentCache(t *testing.T) {
+	t.Cleanup(func() { CloseAttachmentCache() })
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "not-a-dir")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantErr  bool
+		wantPath string
+	}{
+		{"open", filepath.Join(dir, "a.db"), false, filepath.Join(dir, "a.db")},
+		{"open failure keeps the old cache", filepath.Join(blocker, "b.db"), true, filepath.Join(dir, "a.db")},
+		{"path changed", filepath.Join(dir, "b.db"), false, filepath.Join(dir, "b.db")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.GetDefaultConfig()
+			cfg.AttachmentCache.DBPath = tt.path
+			if err := InitAttachmentCache(cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("InitAttachmentCache = %v, wantErr %v", err, tt.wantErr)
+			}
+			cache := attachmentCache.Load()
+			if cache == nil || cache.Options().DiskPath != tt.wantPath {
+				t.Fatalf("cache = %v, want disk path %s", cache, tt.wantPath)
+			}
+			storeAttachment("key", &FileInfo{FileUID: "uid"})
+			if _, ok := cachedAttachment("key"); !ok {
+				t.Error("current cache unusable")
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/logger"
+	"strings"
+	"sync/atomic"
+
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// messageContent 一条消息的文本和附件，Monica 与 Custom Bot 两种模式共用
+type messageContent struct {
+	Segments    []messageSegment    // 按出现顺序排列的文本和附件位置
+	Attachments []messageAttachment // 按出现顺序排列的附件
+}
+
+// messageSegment 消息中的一段，Attachment 不小于 0 时表示 Attachments 中对应附件所在的位置
+type messageSegment struct {
+	Text       string
+	Attachment int
+}
+
+// messageAttachment 消息中的一个附件，Resolved 不为空时引用已上传的文件，不重新上传
+type messageAttachment struct {
+	Request  AttachmentRequest
+	Resolved *FileInfo
+}
+
+// hasFiles 消息是否带有附件
+func (m messageContent) hasFiles() bool {
+	return len(m.Attachments) > 0
+}
+
+// Text 不上传附件时的文本，每个附件按出现顺序编号
+func (m messageContent) Text() string {
+	return m.render(nil)
+}
+
+// render 按顺序以换行拼接文本，附件所在位置插入 "[Attachment N: 文件名]" 占位符，
+// 占位符不随对话语言变化，模型都能识别。uploaded 为空时所有附件依次编号；否则须与 Attachments 一一对应，
+// 只有上传成功的附件参与编号，使 N 与 FileInfos 的顺序一致，上传失败的附件标记为 "[Attachment upload failed: 文件名]"
+func (m messageContent) render(uploaded []*FileInfo) string {
+	texts := make([]string, 0, len(m.Segments))
+	n := 0
+	for _, seg := range m.Segments {
+		if seg.Attachment < 0 {
+			texts = append(texts, seg.Text)
+			continue
+		}
+		a := m.Attachments[seg.Attachment]
+		if uploaded != nil && uploaded[seg.Attachment] == nil {
+			texts = append(texts, attachmentPlaceholder("Attachment upload failed", a))
+			continue
+		}
+		n++
+		texts = append(texts, attachmentPlaceholder(fmt.Sprintf("Attachment %d", n), a))
+	}
+	return strings.Join(texts, "\n")
+}
+
+// collectMessageContent 从第 index 条消息的内容部分中按顺序收集文本和附件；
+// 内容为字符串的消息直接使用其文本
+func collectMessageContent(ctx context.Context, index int, msg openai.ChatCompletionMessage) messageContent {
+	parts := messageParts(ctx, index, msg)
+	if len(parts) == 0 {
+		return messageContent{Segments: []messageSegment{{Text: msg.Content, Attachment: -1}}}
+	}
+
+	var m messageContent
+	addAttachment := func(a messageAttachment) {
+		m.Segments = append(m.Segments, messageSegment{Attachment: len(m.Attachments)})
+		m.Attachments = append(m.Attachments, a)
+	}
+
+	for _, content := range parts {
+		// 引用已上传文件的部分直接使用文件存储中的信息，不重新上传
+		if content.Resolved != nil {
+			addAttachment(messageAttachment{Resolved: content.Resolved})
+			continue
+		}
+		if fileID := content.FileID(); fileID != "" {
+			logger.Warn("引用的文件未解析，已忽略", zap.String("file_id", fileID))
+			continue
+		}
+		switch content.Type {
+		case "text":
+			// 检测文本内容中的文件信息，文件内容作为附件上传，文本替换为占位符
+			if strings.Contains(content.Text, "[file name]:") && strings.Contains(content.Text, "[file content begin]") {
+				if fileName, fileContent, found := extractFileFromText(content.Text); found {
+					addAttachment(messageAttachment{Request: AttachmentRequest{
+						Type:     "document",
+						Data:     fileContent,
+						FileName: fileName,
+						MimeType: "text/markdown",
+					}})
+					continue
+				}
+			}
+			if content.Text != "" {
+				m.Segments = append(m.Segments, messageSegment{Text: content.Text, Attachment: -1})
+			}
+
+		case "image_url":
+			if content.ImageURL == nil || content.ImageURL.URL == "" {
+				continue
+			}
+			// 图片可以是 data URI 或 http(s) URL
+			addAttachment(messageAttachment{Request: AttachmentRequest{
+				Type: "image_url",
+				Data: content.ImageURL.URL,
+			}})
+		case "file":
+			// 内联的文件内容，引用文件ID的情况已在上面处理
+			if content.File == nil || content.File.FileData == "" {
+				continue
+			}
+			addAttachment(messageAttachment{Request: AttachmentRequest{
+				Type:     "file",
+				Data:     encodedData(content.File.FileData, ""),
+				FileName: content.File.Filename,
+			}})
+		case "document":
+			if content.Document == nil || content.Document.URL == "" {
+				continue
+			}
+			addAttachment(messageAttachment{Request: AttachmentRequest{
+				Type:     "document",
+				Data:     encodedData(content.Document.URL, content.Document.MimeType),
+				FileName: content.Document.Name,
+				MimeType: content.Document.MimeType,
+			}})
+		case "audio":
+			if content.Audio == nil || content.Audio.URL == "" {
+				continue
+			}
+			addAttachment(messageAttachment{Request: AttachmentRequest{
+				Type:     "audio",
+				Data:     encodedData(content.Audio.URL, content.Audio.MimeType),
+				FileName: content.Audio.Name,
+				MimeType: content.Audio.MimeType,
+			}})
+		default:
+			logger.Warn("不支持的内容类型", zap.String("type", content.Type))
+		}
+	}
+	return m
+}
+
+// collectMessageText 只收集第 index 条消息的文本部分，用于不能携带附件的 system 消息；
+// 图片、文件等附件不会上传，也不在文本中留下占位符
+func collectMessageText(ctx context.Context, index int, msg openai.ChatCompletionMessage) string {
+	parts := messageParts(ctx, index, msg)
+	if len(parts) == 0 {
+		return msg.Content
+	}
+
+	texts := make([]string, 0, len(parts))
+	for _, content := range parts {
+		if content.Type == "text" && content.Resolved == nil && content.FileID() == "" {
+			if content.Text != "" {
+				texts = append(texts, content.Text)
+			}
+			continue
+		}
+		logger.Warn("system 消息中的附件不会上传，已忽略", zap.Int("message", index), zap.String("type", content.Type))
+	}
+	return strings.Join(texts, "\n")
+}
+
+// attachmentPlaceholder 附件在文本中的占位符，文件名未知时省略
+func attachmentPlaceholder(label string, a messageAttachment) string {
+	name := a.Request.FileName
+	if a.Resolved != nil {
+		name = a.Resolved.FileName
+	}
+	if name == "" {
+		return "[" + label + "]"
+	}
+	return fmt.Sprintf("[%s: %s]", label, name)
+}
+
+// encodedData 文档和音频的 url 字段可以是 URL、data URI 或不带前缀的 base64，后者补全为 data URI
+func encodedData(data, mimeType string) string {
+	if strings.HasPrefix(data, "data:") || strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://") {
+		return data
+	}
+	return "data:" + mimeType + ";base64," + data
+}
+
+// uploadMessageContent 上传消息的附件，返回附件编号与文件信息顺序一致的文本和上传成功的文件信息
+func uploadMessageContent(ctx context.Context, cfg *config.Config, m messageContent) (string, []FileInfo) {
+	uploaded := uploadAttachments(ctx, cfg, m)
+	fileInfoList := make([]FileInfo, 0, len(uploaded))
+	for _, f := range uploaded {
+		if f != nil {
+			fileInfoList = append(fileInfoList, *f)
+		}
+	}
+	return m.render(uploaded), fileInfoList
+}
+
+// uploadAttachments 并发上传消息的附件，返回与 Attachments 一一对应的文件信息；
+// 引用的文件直接使用，上传失败的附件记录日志后对应位置为 nil
+func uploadAttachments(ctx context.Context, cfg *config.Config, m messageContent) []*FileInfo {
+	// 创建带超时的上下文，保留追踪信息但不随客户端断开而取消
+	uploadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), FileUploadTimeout)
+	defer cancel()
+
+	// 统计上传成功和失败数量
+	var successCount, failureCount, uploadCount int64
+
+	// 并发上传所有类型的文件
+	uploadResults := lop.Map(m.Attachments, func(a messageAttachment, _ int) *FileInfo {
+		if a.Resolved != nil {
+			return a.Resolved
+		}
+		atomic.AddInt64(&uploadCount, 1)
+		attachment := a.Request
+		source, fileData := attachmentSource(attachment.Data)
+
+		// 创建上传请求
+		fileReq := &UniversalFileUploadRequest{
+			Data:      fileData,
+			Source:    source,
+			FileName:  attachment.FileName,
+			MimeType:  attachment.MimeType,
+			ParseFile: true, // 默认启用LLM解析
+		}
+
+		f, err := UploadUniversalFile(uploadCtx, cfg, fileReq)
+		if err != nil {
+			atomic.AddInt64(&failureCount, 1)
+			logger.Error("文件上传失败",
+				zap.Error(err),
+				zap.String("file_type", attachment.Type),
+				zap.String("file_name", attachment.FileName),
+				zap.String("source", source.String()),
+			)
+			return nil
+		}
+
+		if f == nil {
+			atomic.AddInt64(&failureCount, 1)
+			logger.Warn("文件上传返回空结果",
+				zap.String("file_name", attachment.FileName))
+			return nil
+		}
+
+		atomic.AddInt64(&successCount, 1)
+		return f
+	})
+
+	// 记录上传统计信息
+	if uploadCount == 0 {
+		return uploadResults
+	}
+	if failureCount > 0 {
+		logger.Warn("文件上传完成",
+			zap.Int64("success_count", successCount),
+			zap.Int64("failure_count", failureCount),
+			zap.Int64("total_attachments", uploadCount),
+		)
+	} else {
+		logger.Info("所有文件上传成功",
+			zap.Int64("success_count", successCount),
+			zap.Int64("total_attachments", uploadCount),
+		)
+	}
+	return uploadResults
+}
+
+// attachmentSource 判断附件数据的来源：data URI、http(s) URL 或纯文本内容
+func attachmentSource(data string) (FileUploadSource, interface{}) {
+	switch {
+	case strings.HasPrefix(data, "data:"):
+		return SourceBase64, data
+	case strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://"):
+		return SourceURL, data
+	default:
+		// 对于纯文本内容，使用字节数据
+		return SourceBytes, []byte(data)
+	}
+}
@@ -0,0 +1,193 @@
+package types
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestAttachmentSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantSource FileUploadSource
+		wantData   interface{}
+	}{
+		{"data uri", "data:image/png;base64,AAAA", SourceBase64, "data:image/png;base64,AAAA"},
+		{"https url", "https://example.com/a.png", SourceURL, "https://example.com/a.png"},
+		{"http url", "http://example.com/a.png", SourceURL, "http://example.com/a.png"},
+		{"plain text", "# notes", SourceBytes, []byte("# notes")},
+		{"other scheme is text", "ftp://example.com/a", SourceBytes, []byte("ftp://example.com/a")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, data := attachmentSource(tt.data)
+			if source != tt.wantSource {
+				t.Errorf("source = %s, want %s", source, tt.wantSource)
+			}
+			if !reflect.DeepEqual(data, tt.wantData) {
+				t.Errorf("data = %#v, want %#v", data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestCollectMessageContent(t *testing.T) {
+	resolved := &FileInfo{FileName: "notes.pdf"}
+	tests := []struct {
+		name      string
+		parts     []ExtendedChatMessagePart
+		content   string
+		wantText  string
+		wantFiles []AttachmentRequest
+	}{
+		{
+			name:     "plain string content",
+			content:  "hello",
+			wantText: "hello",
+		},
+		{
+			name: "text and attachments keep order",
+			parts: []ExtendedChatMessagePart{
+				{Type: "text", Text: "compare"},
+				{Type: "document", Document: &DocumentContent{URL: "https://example.com/a.pdf", Name: "a.pdf"}},
+				{Type: "image_url", ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,AAAA"}},
+				{Type: "text", Text: "and summarize"},
+			},
+			wantText: "compare\n[Attachment 1: a.pdf]\n[Attachment 2]\nand summarize",
+			wantFiles: []AttachmentRequest{
+				{Type: "document", Data: "https://example.com/a.pdf", FileName: "a.pdf"},
+				{Type: "image_url", Data: "data:image/png;base64,AAAA"},
+			},
+		},
+		{
+			name: "raw base64 is wrapped",
+			parts: []ExtendedChatMessagePart{
+				{Type: "file", File: &FilePart{FileData: "JVBERi0=", Filename: "x.pdf"}},
+				{Type: "audio", Audio: &AudioContent{URL: "AAAA", Name: "memo.mp3", MimeType: "audio/mpeg"}},
+			},
+			wantText: "[Attachment 1: x.pdf]\n[Attachment 2: memo.mp3]",
+			wantFiles: []AttachmentRequest{
+				{Type: "file", Data: "data:;base64,JVBERi0=", FileName: "x.pdf"},
+				{Type: "audio", Data: "data:audio/mpeg;base64,AAAA", FileName: "memo.mp3", MimeType: "audio/mpeg"},
+			},
+		},
+		{
+			name: "file data uri kept",
+			parts: []ExtendedChatMessagePart{
+				{Type: "file", File: &FilePart{FileData: "data:application/pdf;base64,JVBERi0=", Filename: "x.pdf"}},
+			},
+			wantText: "[Attachment 1: x.pdf]",
+			wantFiles: []AttachmentRequest{
+				{Type: "file", Data: "data:application/pdf;base64,JVBERi0=", FileName: "x.pdf"},
+			},
+		},
+		{
+			name: "file name convention becomes document",
+			parts: []ExtendedChatMessagePart{
+				{Type: "text", Text: "[file name]: a.md\n[file content begin]\n# title\n[file content end]"},
+			},
+			wantText: "[Attachment 1: a.md]",
+			wantFiles: []AttachmentRequest{
+				{Type: "document", Data: "# title", FileName: "a.md", MimeType: "text/markdown"},
+			},
+		},
+		{
+			name: "resolved and unresolved file ids",
+			parts: []ExtendedChatMessagePart{
+				{Type: "file", File: &FilePart{FileID: "file-1"}, Resolved: resolved},
+				{Type: "file", File: &FilePart{FileID: "file-missing"}},
+				{Type: "text", Text: "read it"},
+			},
+			wantText:  "[Attachment 1: notes.pdf]\nread it",
+			wantFiles: []AttachmentRequest{{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.parts != nil {
+				ctx = WithMessageParts(ctx, [][]ExtendedChatMessagePart{tt.parts})
+			}
+			m := collectMessageContent(ctx, 0, openai.ChatCompletionMessage{Content: tt.content})
+			if got := m.Text(); got != tt.wantText {
+				t.Errorf("text = %q, want %q", got, tt.wantText)
+			}
+			var got []AttachmentRequest
+			for _, a := range m.Attachments {
+				got = append(got, a.Request)
+			}
+			if !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("attachments = %+v, want %+v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestCollectMessageText(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   []ExtendedChatMessagePart
+		content string
+		want    string
+	}{
+		{"plain string content", nil, "be brief", "be brief"},
+		{"attachments left out", []ExtendedChatMessagePart{
+			{Type: "text", Text: "be brief"},
+			{Type: "image_url", ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,AAAA"}},
+			{Type: "file", File: &FilePart{FileID: "file-1"}, Resolved: &FileInfo{FileName: "notes.pdf"}},
+			{Type: "text", Text: "answer in English"},
+		}, "", "be brief\nanswer in English"},
+		// 不上传附件，文本文件保持原文写入 prompt
+		{"inline text file kept as text", []ExtendedChatMessagePart{
+			{Type: "text", Text: "[file name]: a.md\n[file content begin]\n# title\n[file content end]"},
+		}, "", "[file name]: a.md\n[file content begin]\n# title\n[file content end]"},
+		{"only attachments", []ExtendedChatMessagePart{
+			{Type: "document", Document: &DocumentContent{URL: "https://example.com/a.pdf", Name: "a.pdf"}},
+		}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.parts != nil {
+				ctx = WithMessageParts(ctx, [][]ExtendedChatMessagePart{tt.parts})
+			}
+			msg := openai.ChatCompletionMessage{Role: "system", Content: tt.content}
+			if got := collectMessageText(ctx, 0, msg); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageContentRender(t *testing.T) {
+	ctx := WithMessageParts(context.Background(), [][]ExtendedChatMessagePart{{
+		{Type: "text", Text: "see"},
+		{Type: "document", Document: &DocumentContent{URL: "https://example.com/a.pdf", Name: "a.pdf"}},
+		{Type: "document", Document: &DocumentContent{URL: "https://example.com/b.pdf", Name: "b.pdf"}},
+		{Type: "image_url", ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/c.png"}},
+	}})
+	m := collectMessageContent(ctx, 0, openai.ChatCompletionMessage{})
+	a, c := &FileInfo{FileName: "a.pdf"}, &FileInfo{FileName: "c.png"}
+
+	tests := []struct {
+		name     string
+		uploaded []*FileInfo
+		want     string
+	}{
+		{"not uploaded", nil, "see\n[Attachment 1: a.pdf]\n[Attachment 2: b.pdf]\n[Attachment 3]"},
+		{"all uploaded", []*FileInfo{a, {FileName: "b.pdf"}, c}, "see\n[Attachment 1: a.pdf]\n[Attachment 2: b.pdf]\n[Attachment 3]"},
+		// 编号只计上传成功的附件，与 FileInfos 中的顺序一致
+		{"middle failed", []*FileInfo{a, nil, c}, "see\n[Attachment 1: a.pdf]\n[Attachment upload failed: b.pdf]\n[Attachment 2]"},
+		{"all failed", []*FileInfo{nil, nil, nil}, "see\n[Attachment upload failed: a.pdf]\n[Attachment upload failed: b.pdf]\n[Attachment upload failed]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.render(tt.uploaded); got != tt.want {
+				t.Errorf("render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
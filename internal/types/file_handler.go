@@ -1,27 +1,27 @@
 package types
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/utils"
 	"net/http"
-	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
-var (
-	fileCache sync.Map
-)
+// FileIndexStateDone Monica 文件解析完成时的 index_state
+const FileIndexStateDone = 3
 
 // FileUploadSource 文件上传来源类型
 type FileUploadSource int
@@ -30,36 +30,72 @@ const (
 	SourceBase64 FileUploadSource = iota // Base64编码
 	SourceURL                            // 网络URL
 	SourceBytes                          // 字节数据
+	SourceReader                         // io.Reader，按 Size 流式上传
 )
 
+// mimeSniffLen http.DetectContentType 使用的字节数
+const mimeSniffLen = 512
+
+// String 返回来源类型名称
+func (s FileUploadSource) String() string {
+	switch s {
+	case SourceBase64:
+		return "base64"
+	case SourceURL:
+		return "url"
+	case SourceBytes:
+		return "bytes"
+	case SourceReader:
+		return "reader"
+	}
+	return "unknown"
+}
+
 // UniversalFileUploadRequest 通用文件上传请求
 type UniversalFileUploadRequest struct {
-	Data      interface{}      `json:"data"`       // 文件数据 (base64 string, URL string, or []byte)
+	Data      interface{}      `json:"data"`       // 文件数据 (base64 string, URL string, []byte or io.Reader)
+	Size      int64            `json:"size"`       // SourceReader 的内容长度
 	Source    FileUploadSource `json:"source"`     // 数据来源类型
 	FileName  string           `json:"file_name"`  // 可选的文件名
 	MimeType  string           `json:"mime_type"`  // 可选的MIME类型
 	ParseFile bool             `json:"parse_file"` // 是否需要LLM解析文件内容
+	Async     bool             `json:"async"`      // 只提交解析，不等待处理完成；结果未处理完，不写入缓存
 }
 
 // UploadUniversalFile 通用文件上传函数 - 支持所有OpenAI兼容的文件类型
-func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *UniversalFileUploadRequest) (*FileInfo, error) {
-	// 1. 预处理文件数据
-	fileData, fileName, mimeType, err := preprocessFileData(req)
+func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *UniversalFileUploadRequest) (_ *FileInfo, err error) {
+	ctx, span := tracing.Start(ctx, "UploadUniversalFile", attribute.String("file.source", req.Source.String()))
+	defer func() { tracing.End(span, err) }()
+
+	// 1. 预处理文件数据，流式来源只读取开头用于类型检测
+	src, err := openFileSource(ctx, cfg.Monica.Cookie, req)
 	if err != nil {
 		return nil, fmt.Errorf("preprocess file data failed: %v", err)
 	}
+	span.SetAttributes(
+		attribute.String("file.name", src.fileName),
+		attribute.String("file.mime_type", src.mimeType),
+		attribute.Int64("file.size", src.size),
+	)
 
-	// 2. 生成缓存key
-	cacheKey := generateFileCacheKey(fileData, fileName, mimeType)
-
-	// 3. 检查缓存
-	if value, exists := fileCache.Load(cacheKey); exists {
-		logger.Debug("File found in cache", zap.String("cache_key", cacheKey))
-		return value.(*FileInfo), nil
+	// 2-3. 缓存key已知时检查缓存；不可回读的流在上传过程中计算
+	if src.cacheKey != "" {
+		cached, exists := cachedAttachment(src.cacheKey)
+		metrics.ObserveCache("file", exists)
+		span.SetAttributes(attribute.Bool("cache.hit", exists))
+		if exists {
+			logger.Debug("File found in cache", zap.String("cache_key", src.cacheKey))
+			return cached, nil
+		}
 	}
 
+	start := time.Now()
+	defer func() {
+		metrics.ObserveUpload(src.size, time.Since(start), err)
+	}()
+
 	// 4. 验证文件格式和大小
-	fileInfo, err := validateFileData(fileData, fileName, mimeType)
+	fileInfo, err := validateFile(src)
 	if err != nil {
 		return nil, fmt.Errorf("validate file failed: %v", err)
 	}
@@ -79,7 +115,7 @@ func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *Universal
 	}
 
 	var preSignResp PreSignResponse
-	_, err = utils.RestyDefaultClient.R().
+	_, err = utils.RestyDefaultClient().R().
 		SetContext(ctx).
 		SetHeader("cookie", cfg.Monica.Cookie).
 		SetBody(preSignReq).
@@ -94,16 +130,19 @@ func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *Universal
 		return nil, fmt.Errorf("no pre-sign url or object url returned")
 	}
 
-	// 6. 上传文件数据到S3
-	_, err = utils.RestyDefaultClient.R().
-		SetContext(ctx).
-		SetHeader("Content-Type", fileInfo.FileType).
-		SetBody(fileData).
-		Put(preSignResp.Data.PreSignURLList[0])
-
-	if err != nil {
+	// 6. 流式上传文件数据到S3，同时计算缓存key
+	digest := contentDigest()
+	body := src.reader
+	if src.cacheKey == "" {
+		body = io.TeeReader(body, digest)
+	}
+	if err = putPreSigned(ctx, preSignResp.Data.PreSignURLList[0], fileInfo.FileType, body, src.size); err != nil {
 		return nil, fmt.Errorf("upload file to S3 failed: %v", err)
 	}
+	cacheKey := src.cacheKey
+	if cacheKey == "" {
+		cacheKey = attachmentKey(digest, cfg.Monica.Cookie, src.fileName, src.mimeType)
+	}
 
 	// 7. 创建LLM文件对象 (对应第二个接口)
 	fileInfo.ObjectURL = preSignResp.Data.ObjectURLList[0]
@@ -114,7 +153,7 @@ func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *Universal
 	}
 
 	var uploadResp FileUploadResponse
-	_, err = utils.RestyDefaultClient.R().
+	_, err = utils.RestyDefaultClient().R().
 		SetContext(ctx).
 		SetHeader("cookie", cfg.Monica.Cookie).
 		SetBody(uploadReq).
@@ -140,14 +179,14 @@ func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *Universal
 	fileInfo.FileURL = preSignResp.Data.CDNURLList[0]
 
 	// 8. 等待LLM处理完成 (对应第三个接口)
-	if req.ParseFile {
+	if req.ParseFile && !req.Async {
 		err = waitForFileProcessing(ctx, cfg, fileInfo.FileUID)
 		if err != nil {
 			return nil, fmt.Errorf("wait for file processing failed: %v", err)
 		}
 
 		// 重新获取处理后的文件信息
-		processedInfo, err := getProcessedFileInfo(ctx, cfg, fileInfo.FileUID)
+		processedInfo, err := GetProcessedFileInfo(ctx, cfg, fileInfo.FileUID)
 		if err != nil {
 			return nil, fmt.Errorf("get processed file info failed: %v", err)
 		}
@@ -160,7 +199,9 @@ func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *Universal
 	fileInfo.URL = ""
 	fileInfo.ObjectURL = ""
 
-	fileCache.Store(cacheKey, fileInfo)
+	if !req.Async {
+		storeAttachment(cacheKey, fileInfo)
+	}
 
 	logger.Info("File uploaded successfully",
 		zap.String("file_uid", fileInfo.FileUID),
@@ -171,8 +212,103 @@ func UploadUniversalFile(ctx context.Context, cfg *config.Config, req *Universal
 	return fileInfo, nil
 }
 
+// fileSource 待上传的文件内容，流式来源只在内存中保留开头用于类型检测的部分
+type fileSource struct {
+	reader   io.Reader // 完整内容
+	size     int64
+	head     []byte // 前 mimeSniffLen 字节
+	fileName string
+	mimeType string
+	cacheKey string // 上传前已知的缓存key，不可回读的流为空
+}
+
+// openFileSource 打开不同来源的文件数据。Base64、URL 和字节数据在内存中处理；
+// SourceReader 读取开头检测类型，可 Seek 时先流式计算缓存key再回到开头。cookie 为上传使用的账号，见 attachmentKey
+func openFileSource(ctx context.Context, cookie string, req *UniversalFileUploadRequest) (*fileSource, error) {
+	if req.Source != SourceReader {
+		fileData, fileName, mimeType, err := preprocessFileData(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		digest := contentDigest()
+		digest.Write(fileData)
+		return &fileSource{
+			reader:   bytes.NewReader(fileData),
+			size:     int64(len(fileData)),
+			head:     fileData[:min(len(fileData), mimeSniffLen)],
+			fileName: fileName,
+			mimeType: mimeType,
+			cacheKey: attachmentKey(digest, cookie, fileName, mimeType),
+		}, nil
+	}
+
+	reader, ok := req.Data.(io.Reader)
+	if !ok {
+		return nil, fmt.Errorf("invalid reader data type")
+	}
+	if req.Size <= 0 {
+		return nil, fmt.Errorf("reader size is required")
+	}
+
+	head := make([]byte, min(req.Size, mimeSniffLen))
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("read file head failed: %v", err)
+	}
+	src := &fileSource{
+		size:     req.Size,
+		head:     head[:n],
+		fileName: req.FileName,
+		mimeType: req.MimeType,
+	}
+	if src.mimeType == "" {
+		src.mimeType = http.DetectContentType(src.head)
+	}
+	if src.fileName == "" {
+		src.fileName = defaultFileName(src.mimeType)
+	}
+
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		digest := contentDigest()
+		digest.Write(src.head)
+		if _, err := io.Copy(digest, reader); err != nil {
+			return nil, fmt.Errorf("hash file failed: %v", err)
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("rewind file failed: %v", err)
+		}
+		src.reader = seeker
+		src.cacheKey = attachmentKey(digest, cookie, src.fileName, src.mimeType)
+	} else {
+		src.reader = io.MultiReader(bytes.NewReader(src.head), reader)
+	}
+	return src, nil
+}
+
+// putPreSigned 将内容流式 PUT 到预签名地址。S3 要求 Content-Length，
+// 且流无法重放，因此不经过带重试和缓冲的 resty 客户端
+func putPreSigned(ctx context.Context, url, contentType string, body io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := utils.RestyDefaultClient().GetClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d, body: %s", resp.StatusCode, detail)
+	}
+	return nil
+}
+
 // preprocessFileData 预处理不同来源的文件数据
-func preprocessFileData(req *UniversalFileUploadRequest) ([]byte, string, string, error) {
+func preprocessFileData(ctx context.Context, req *UniversalFileUploadRequest) ([]byte, string, string, error) {
 	var fileData []byte
 	var fileName, mimeType string
 	var err error
@@ -192,7 +328,7 @@ func preprocessFileData(req *UniversalFileUploadRequest) ([]byte, string, string
 		if !ok {
 			return nil, "", "", fmt.Errorf("invalid URL data type")
 		}
-		fileData, fileName, mimeType, err = downloadFileFromURL(urlData, req.FileName, req.MimeType)
+		fileData, fileName, mimeType, err = downloadFileFromURL(ctx, urlData, req.FileName, req.MimeType)
 
 	case SourceBytes:
 		// 处理字节数据
@@ -219,17 +355,20 @@ func preprocessFileData(req *UniversalFileUploadRequest) ([]byte, string, string
 
 	// 生成默认文件名（如果没有提供）
 	if fileName == "" {
-		typeInfo, exists := SupportedFileTypes[mimeType]
-		if exists {
-			fileName = fmt.Sprintf("%s%s", uuid.New().String(), typeInfo.Extension)
-		} else {
-			fileName = fmt.Sprintf("%s.bin", uuid.New().String())
-		}
+		fileName = defaultFileName(mimeType)
 	}
 
 	return fileData, fileName, mimeType, nil
 }
 
+// defaultFileName 按 MIME 类型生成随机文件名
+func defaultFileName(mimeType string) string {
+	if typeInfo, exists := SupportedFileTypes[mimeType]; exists {
+		return uuid.New().String() + typeInfo.Extension
+	}
+	return uuid.New().String() + ".bin"
+}
+
 // parseBase64File 解析Base64编码的文件
 func parseBase64File(base64Data, fileName, mimeType string) ([]byte, string, string, error) {
 	// 处理 "data:mime/type;base64,data" 格式
@@ -269,36 +408,26 @@ func parseBase64File(base64Data, fileName, mimeType string) ([]byte, string, str
 	return fileData, fileName, mimeType, nil
 }
 
-// downloadFileFromURL 从URL下载文件
-func downloadFileFromURL(fileURL, fileName, mimeType string) ([]byte, string, string, error) {
-	resp, err := http.Get(fileURL)
+// downloadFileFromURL 通过 utils.FetchURL 下载文件，受 url_fetch 的地址、大小和超时限制
+func downloadFileFromURL(ctx context.Context, fileURL, fileName, mimeType string) ([]byte, string, string, error) {
+	content, err := utils.FetchURL(ctx, fileURL, isDownloadableType)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("download file from URL failed: %v", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, "", "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
-	}
-
-	// 读取文件数据
-	fileData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("read file data failed: %v", err)
-	}
+	fileData := content.Data
 
-	// 从Content-Type头获取MIME类型
+	// 从Content-Type头获取MIME类型，通用的二进制类型按内容检测
 	if mimeType == "" {
-		mimeType = resp.Header.Get("Content-Type")
-		if mimeType == "" {
+		mimeType = content.ContentType
+		if mimeType == "" || isGenericBinaryType(mimeType) {
 			mimeType = http.DetectContentType(fileData)
 		}
 	}
 
 	// 从URL推断文件名
 	if fileName == "" {
-		fileName = filepath.Base(fileURL)
-		if fileName == "." || fileName == "/" {
+		fileName = content.FileName
+		if fileName == "" {
 			typeInfo, exists := SupportedFileTypes[mimeType]
 			if exists {
 				fileName = fmt.Sprintf("%s%s", uuid.New().String(), typeInfo.Extension)
@@ -309,31 +438,44 @@ func downloadFileFromURL(fileURL, fileName, mimeType string) ([]byte, string, st
 	return fileData, fileName, mimeType, nil
 }
 
-// validateFileData 验证文件数据的格式和大小
-func validateFileData(fileData []byte, fileName, mimeType string) (*FileInfo, error) {
-	typeInfo, supported := SupportedFileTypes[mimeType]
+// isDownloadableType URL 响应的媒体类型是否可能是支持的文件，不支持的类型不读取响应体
+func isDownloadableType(mediaType string) bool {
+	if _, ok := SupportedFileTypes[mediaType]; ok {
+		return true
+	}
+	return isGenericBinaryType(mediaType)
+}
+
+// isGenericBinaryType 对象存储常用的未指明具体格式的类型
+func isGenericBinaryType(mediaType string) bool {
+	return mediaType == "application/octet-stream" || mediaType == "binary/octet-stream"
+}
+
+// validateFile 验证文件的格式和大小，内容类型只根据开头部分检测
+func validateFile(src *fileSource) (*FileInfo, error) {
+	typeInfo, supported := SupportedFileTypes[src.mimeType]
 	if !supported {
-		return nil, fmt.Errorf("unsupported file type: %s", mimeType)
+		return nil, fmt.Errorf("unsupported file type: %s", src.mimeType)
 	}
 
-	if int64(len(fileData)) > typeInfo.MaxSize {
-		return nil, fmt.Errorf("file size exceeds limit: %d > %d bytes", len(fileData), typeInfo.MaxSize)
+	if src.size > typeInfo.MaxSize {
+		return nil, fmt.Errorf("file size exceeds limit: %d > %d bytes", src.size, typeInfo.MaxSize)
 	}
 
 	// 验证文件内容类型
-	detectedType := http.DetectContentType(fileData)
-	if !isCompatibleMimeType(detectedType, mimeType) {
+	detectedType := http.DetectContentType(src.head)
+	if !isCompatibleMimeType(detectedType, src.mimeType) {
 		logger.Warn("MIME type mismatch",
-			zap.String("provided", mimeType),
+			zap.String("provided", src.mimeType),
 			zap.String("detected", detectedType),
-			zap.String("file_name", fileName),
+			zap.String("file_name", src.fileName),
 		)
 	}
 
 	return &FileInfo{
-		FileName: fileName,
-		FileSize: int64(len(fileData)),
-		FileType: mimeType,
+		FileName: src.fileName,
+		FileSize: src.size,
+		FileType: src.mimeType,
 		FileExt:  typeInfo.Extension,
 	}, nil
 }
@@ -374,7 +516,7 @@ func waitForFileProcessing(ctx context.Context, cfg *config.Config, fileUID stri
 
 	for i := 0; i < maxRetries; i++ {
 		var batchResp FileBatchGetResponse
-		_, err := utils.RestyDefaultClient.R().
+		_, err := utils.RestyDefaultClient().R().
 			SetContext(ctx).
 			SetHeader("cookie", cfg.Monica.Cookie).
 			SetBody(reqMap).
@@ -388,8 +530,7 @@ func waitForFileProcessing(ctx context.Context, cfg *config.Config, fileUID stri
 		if len(batchResp.Data.Items) > 0 {
 			item := batchResp.Data.Items[0]
 
-			// index_state: 3 表示处理完成
-			if item.IndexState == 3 && item.FileChunks > 0 {
+			if item.IndexState == FileIndexStateDone && item.FileChunks > 0 {
 				logger.Info("File processing completed",
 					zap.String("file_uid", fileUID),
 					zap.Int("index_state", item.IndexState),
@@ -423,14 +564,14 @@ func waitForFileProcessing(ctx context.Context, cfg *config.Config, fileUID stri
 	return fmt.Errorf("file processing timeout after %d retries", maxRetries)
 }
 
-// getProcessedFileInfo 获取处理完成的文件信息
-func getProcessedFileInfo(ctx context.Context, cfg *config.Config, fileUID string) (*FileBatchGetResponse_Item, error) {
+// GetProcessedFileInfo 获取文件信息，包括解析状态 index_state/index_progress
+func GetProcessedFileInfo(ctx context.Context, cfg *config.Config, fileUID string) (*FileBatchGetResponse_Item, error) {
 	reqMap := map[string][]string{
 		"file_uids": {fileUID},
 	}
 
 	var batchResp FileBatchGetResponse
-	_, err := utils.RestyDefaultClient.R().
+	_, err := utils.RestyDefaultClient().R().
 		SetContext(ctx).
 		SetHeader("cookie", cfg.Monica.Cookie).
 		SetBody(reqMap).
@@ -464,29 +605,6 @@ func getProcessedFileInfo(ctx context.Context, cfg *config.Config, fileUID strin
 	}, nil
 }
 
-// generateFileCacheKey 生成文件缓存键
-func generateFileCacheKey(fileData []byte, fileName, mimeType string) string {
-	// 对文件数据进行采样和哈希
-	var samples []string
-
-	dataLen := len(fileData)
-	if dataLen <= 1024 {
-		// 小文件直接哈希
-		samples = append(samples, string(fileData))
-	} else {
-		// 大文件采样
-		samples = append(samples, string(fileData[:256]))
-		mid := dataLen / 2
-		samples = append(samples, string(fileData[mid-128:mid+128]))
-		samples = append(samples, string(fileData[dataLen-256:]))
-	}
-
-	// 添加文件元信息
-	samples = append(samples, fileName, mimeType)
-
-	return fmt.Sprintf("%x", xxhash.Sum64String(strings.Join(samples, "")))
-}
-
 // FileBatchGetResponse_Item 单个文件的批量获取响应项
 type FileBatchGetResponse_Item struct {
 	FileName      string         `json:"file_name"`
@@ -0,0 +1,167 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// onlyReader 隐藏底层的 Seek 能力，模拟不可回读的请求体
+type onlyReader struct{ io.Reader }
+
+func TestOpenFileSource(t *testing.T) {
+	content := strings.Repeat("hello world\n", 100) // 超过 mimeSniffLen
+	bytesSrc, err := openFileSource(context.Background(), "cookie", &UniversalFileUploadRequest{
+		Source: SourceBytes, Data: []byte(content), FileName: "a.txt", MimeType: "text/plain",
+	})
+	if err != nil {
+		t.Fatalf("openFileSource bytes: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		req          UniversalFileUploadRequest
+		wantErr      string
+		wantCacheKey bool
+		wantMime     string
+	}{
+		{
+			name:         "seekable reader hashes before upload",
+			req:          UniversalFileUploadRequest{Source: SourceReader, Data: strings.NewReader(content), Size: int64(len(content)), FileName: "a.txt", MimeType: "text/plain"},
+			wantCacheKey: true,
+			wantMime:     "text/plain",
+		},
+		{
+			name:     "stream defers cache key",
+			req:      UniversalFileUploadRequest{Source: SourceReader, Data: onlyReader{strings.NewReader(content)}, Size: int64(len(content)), FileName: "a.txt", MimeType: "text/plain"},
+			wantMime: "text/plain",
+		},
+		{
+			name:         "detects mime type from head",
+			req:          UniversalFileUploadRequest{Source: SourceReader, Data: bytes.NewReader([]byte(content)), Size: int64(len(content))},
+			wantCacheKey: true,
+			wantMime:     "text/plain; charset=utf-8",
+		},
+		{
+			name:    "size required",
+			req:     UniversalFileUploadRequest{Source: SourceReader, Data: strings.NewReader(content)},
+			wantErr: "reader size is required",
+		},
+		{
+			name:    "data must be a reader",
+			req:     UniversalFileUploadRequest{Source: SourceReader, Data: content, Size: 1},
+			wantErr: "invalid reader data type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := openFileSource(context.Background(), "cookie", &tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openFileSource: %v", err)
+			}
+			if src.mimeType != tt.wantMime || src.fileName == "" || src.size != int64(len(content)) {
+				t.Errorf("source = %q %q %d", src.fileName, src.mimeType, src.size)
+			}
+			if len(src.head) != mimeSniffLen {
+				t.Errorf("head = %d bytes, want %d", len(src.head), mimeSniffLen)
+			}
+			// 无论是否回读，上传的始终是完整内容
+			data, _ := io.ReadAll(src.reader)
+			if string(data) != content {
+				t.Errorf("reader returned %d bytes, want %d", len(data), len(content))
+			}
+			if (src.cacheKey != "") != tt.wantCacheKey {
+				t.Errorf("cacheKey = %q", src.cacheKey)
+			}
+			// 同样的内容与字节来源命中同一个缓存key
+			if tt.wantCacheKey && tt.req.FileName == "a.txt" && src.cacheKey != bytesSrc.cacheKey {
+				t.Errorf("cacheKey = %q, want %q", src.cacheKey, bytesSrc.cacheKey)
+			}
+		})
+	}
+}
+
+func TestPutPreSigned(t *testing.T) {
+	utils.InitHTTPClients(config.GetDefaultConfig())
+
+	var got struct {
+		length      int64
+		contentType string
+		body        string
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.length = r.ContentLength
+		got.contentType = r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		got.body = string(data)
+		if r.URL.Path == "/expired" {
+			http.Error(w, "<Error>AccessDenied</Error>", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"uploaded", "/ok", ""},
+		{"rejected", "/expired", "status 403"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 不可回读的流也必须带上 Content-Length，而不是分块传输
+			body := onlyReader{strings.NewReader("hello world")}
+			err := putPreSigned(context.Background(), server.URL+tt.path, "text/plain", body, 11)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("putPreSigned: %v", err)
+			}
+			if got.length != 11 || got.contentType != "text/plain" || got.body != "hello world" {
+				t.Errorf("request = %+v", got)
+			}
+		})
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		size     int64
+		wantErr  string
+	}{
+		{"supported", "text/plain", 10, ""},
+		{"too large", "text/plain", MaxFileSize + 1, "file size exceeds limit"},
+		{"unsupported", "application/x-msdownload", 10, "unsupported file type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := validateFile(&fileSource{fileName: "a", mimeType: tt.mimeType, size: tt.size, head: []byte("hello")})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || info.FileSize != tt.size || info.FileType != tt.mimeType {
+				t.Errorf("validateFile = %+v, %v", info, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/bytedance/sonic"
+	"github.com/sashabaranov/go-openai"
+)
+
+type messagePartsKey struct{}
+
+// ParseMessageParts 从原始请求体中解析每条消息的内容部分。
+// go-openai 只保留 text 和 image_url，file/document/audio 等部分需要从原文中读取；
+// 内容为字符串的消息对应 nil
+func ParseMessageParts(body []byte) ([][]ExtendedChatMessagePart, error) {
+	var raw struct {
+		Messages []struct {
+			Content sonic.NoCopyRawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := sonic.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	parts := make([][]ExtendedChatMessagePart, len(raw.Messages))
+	for i, msg := range raw.Messages {
+		content := bytes.TrimSpace(msg.Content)
+		if len(content) == 0 || content[0] != '[' {
+			continue
+		}
+		if err := sonic.Unmarshal(content, &parts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// WithMessageParts 在上下文中保存 ParseMessageParts 的结果，供请求转换时使用
+func WithMessageParts(ctx context.Context, parts [][]ExtendedChatMessagePart) context.Context {
+	return context.WithValue(ctx, messagePartsKey{}, parts)
+}
+
+// MessagePartsFromContext 返回上下文中保存的消息内容部分，未保存时为 nil
+func MessagePartsFromContext(ctx context.Context) [][]ExtendedChatMessagePart {
+	parts, _ := ctx.Value(messagePartsKey{}).([][]ExtendedChatMessagePart)
+	return parts
+}
+
+// messageParts 返回第 index 条消息的内容部分；上下文中没有原文解析结果时由 go-openai 的 MultiContent 转换
+func messageParts(ctx context.Context, index int, msg openai.ChatCompletionMessage) []ExtendedChatMessagePart {
+	if parts := MessagePartsFromContext(ctx); index < len(parts) && parts[index] != nil {
+		return parts[index]
+	}
+	if len(msg.MultiContent) == 0 {
+		return nil
+	}
+	parts := make([]ExtendedChatMessagePart, len(msg.MultiContent))
+	for i, content := range msg.MultiContent {
+		parts[i] = ExtendedChatMessagePart{
+			Type:     string(content.Type),
+			Text:     content.Text,
+			ImageURL: content.ImageURL,
+		}
+	}
+	return parts
+}
@@ -0,0 +1,105 @@
+package types
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestMessagePartFileID(t *testing.T) {
+	tests := []struct {
+		name string
+		part ExtendedChatMessagePart
+		want string
+	}{
+		{"file part", ExtendedChatMessagePart{Type: "file", File: &FilePart{FileID: "file-abc"}}, "file-abc"},
+		{"inline file data", ExtendedChatMessagePart{Type: "file", File: &FilePart{FileData: "data:text/plain;base64,aGk="}}, ""},
+		{"file without body", ExtendedChatMessagePart{Type: "file"}, ""},
+		{"image file id", ExtendedChatMessagePart{Type: "image_url", ImageURL: &openai.ChatMessageImageURL{URL: "file-img"}}, "file-img"},
+		{"image url", ExtendedChatMessagePart{Type: "image_url", ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png"}}, ""},
+		{"image data uri", ExtendedChatMessagePart{Type: "image_url", ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,AAAA"}}, ""},
+		{"text", ExtendedChatMessagePart{Type: "text", Text: "file-abc"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.part.FileID(); got != tt.want {
+				t.Errorf("FileID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageParts(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []int // 每条消息的内容部分数量，-1 表示 nil
+		wantErr bool
+	}{
+		{
+			name: "string and array content",
+			body: `{"messages":[
+				{"role":"system","content":"be brief"},
+				{"role":"user","content":[{"type":"text","text":"sum"},{"type":"file","file":{"file_id":"file-a"}}]}
+			]}`,
+			want: []int{-1, 2},
+		},
+		{"null content", `{"messages":[{"role":"assistant","content":null}]}`, []int{-1}, false},
+		{"invalid part", `{"messages":[{"role":"user","content":[{"type":1}]}]}`, nil, true},
+		{"invalid body", `not json`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMessageParts([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("messages = %d, want %d", len(got), len(tt.want))
+			}
+			for i, n := range tt.want {
+				if n < 0 && got[i] != nil || n >= 0 && len(got[i]) != n {
+					t.Errorf("message %d parts = %+v, want %d", i, got[i], n)
+				}
+			}
+		})
+	}
+}
+
+func TestMessagePartsFallback(t *testing.T) {
+	multi := openai.ChatCompletionMessage{
+		Role: "user",
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "hi"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "file-img"}},
+		},
+	}
+	parsed := [][]ExtendedChatMessagePart{nil, {{Type: "file", File: &FilePart{FileID: "file-a"}}}}
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		index int
+		msg   openai.ChatCompletionMessage
+		want  []string // 各部分的类型
+	}{
+		{"converted from go-openai", context.Background(), 0, multi, []string{"text", "image_url"}},
+		{"parsed parts take precedence", WithMessageParts(context.Background(), parsed), 1, multi, []string{"file"}},
+		{"nil parsed entry falls back", WithMessageParts(context.Background(), parsed), 0, multi, []string{"text", "image_url"}},
+		{"plain content", context.Background(), 0, openai.ChatCompletionMessage{Content: "hi"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messageParts(tt.ctx, tt.index, tt.msg)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parts = %+v, want types %v", got, tt.want)
+			}
+			for i, typ := range tt.want {
+				if got[i].Type != typ {
+					t.Errorf("part %d type = %q, want %q", i, got[i].Type, typ)
+				}
+			}
+		})
+	}
+}
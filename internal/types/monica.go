@@ -5,15 +5,14 @@ import (
 	"fmt"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/tracing"
 	"regexp"
 	"strings"
-	"sync/atomic"
 	"time"
 
-	lop "github.com/samber/lo/parallel"
-
 	"github.com/google/uuid"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -326,6 +325,32 @@ func modelToBot(model string) string {
 	return model
 }
 
+// ForAttempt 返回用于一次上游尝试的请求副本：会话和消息保持不变，仅生成新的任务ID，
+// model 非空时切换到对应的 bot
+func (r *MonicaRequest) ForAttempt(model string) *MonicaRequest {
+	clone := *r
+	clone.TaskUID = fmt.Sprintf("task:%s", uuid.New().String())
+	if model != "" {
+		clone.BotUID = modelToBot(model)
+	}
+	return &clone
+}
+
+// HasAttachments 检查请求中是否带有已上传的附件
+func (r *MonicaRequest) HasAttachments() bool {
+	return itemsHaveAttachments(r.Data.Items)
+}
+
+// itemsHaveAttachments 检查消息列表中是否存在附件
+func itemsHaveAttachments(items []Item) bool {
+	for _, item := range items {
+		if len(item.Data.FileInfos) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // CustomBotRequest 定义custom bot的请求结构
 type CustomBotRequest struct {
 	TaskUID        string        `json:"task_uid"`
@@ -338,6 +363,23 @@ type CustomBotRequest struct {
 	AIRespLanguage string        `json:"ai_resp_language,omitempty"`
 }
 
+// ForAttempt 返回用于一次上游尝试的请求副本：会话和消息保持不变，仅生成新的任务ID，
+// model 非空时切换使用的模型
+func (r *CustomBotRequest) ForAttempt(model string) *CustomBotRequest {
+	clone := *r
+	clone.TaskUID = fmt.Sprintf("task:%s", uuid.New().String())
+	if model != "" {
+		clone.Data.UseModel = model
+		clone.BotData.ToolData.UseModel = model
+	}
+	return &clone
+}
+
+// HasAttachments 检查请求中是否带有已上传的附件
+func (r *CustomBotRequest) HasAttachments() bool {
+	return itemsHaveAttachments(r.Data.Items)
+}
+
 // CustomBotData custom bot的数据字段
 type CustomBotData struct {
 	ConversationID      string `json:"conversation_id"`
@@ -425,7 +467,13 @@ func GetSupportedModels() []string {
 }
 
 // ChatGPTToMonica 将 ChatGPTRequest 转换为 MonicaRequest
-func ChatGPTToMonica(cfg *config.Config, chatReq openai.ChatCompletionRequest) (*MonicaRequest, error) {
+func ChatGPTToMonica(ctx context.Context, cfg *config.Config, chatReq openai.ChatCompletionRequest) (_ *MonicaRequest, err error) {
+	ctx, span := tracing.Start(ctx, "ChatGPTToMonica",
+		attribute.String("gen_ai.request.model", chatReq.Model),
+		attribute.Int("messages", len(chatReq.Messages)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	if len(chatReq.Messages) == 0 {
 		return nil, fmt.Errorf("empty messages")
 	}
@@ -446,53 +494,13 @@ func ChatGPTToMonica(cfg *config.Config, chatReq openai.ChatCompletionRequest) (
 	items[0] = defaultItem
 	preItemID := defaultItem.ItemID
 
-	for _, msg := range chatReq.Messages {
+	for i, msg := range chatReq.Messages {
 		if msg.Role == "system" {
 			// monica不支持设置prompt，所以直接跳过
 			continue
 		}
-		var msgContext string
-		var attachments []AttachmentRequest
-
-		// 处理多内容消息 (当前主要支持图片，为将来扩展做准备)
-		if len(msg.MultiContent) > 0 {
-			for _, content := range msg.MultiContent {
-				switch content.Type {
-				case "text":
-					msgContext = content.Text
-					
-					// 检测文本内容中的文件信息
-					if strings.Contains(msgContext, "[file name]:") && strings.Contains(msgContext, "[file content begin]") {
-						// 提取文件名和文件内容
-						fileName, fileContent, found := extractFileFromText(msgContext)
-						if found {
-							attachments = append(attachments, AttachmentRequest{
-								Type:     "document",
-								Data:     fileContent,
-								FileName: fileName,
-								MimeType: "text/markdown",
-							})
-							// 清空文本内容，避免重复
-							msgContext = ""
-						}
-					}
-					
-				case "image_url":
-					// 图片处理 (当前支持)
-					attachments = append(attachments, AttachmentRequest{
-						Type: "image_url",
-						Data: content.ImageURL.URL,
-					})
-				// TODO: 未来支持更多文件类型
-				// case "document", "file":
-				//     // 文档/文件处理
-				// case "audio":
-				//     // 音频处理
-				default:
-					logger.Warn("不支持的内容类型", zap.String("type", string(content.Type)))
-				}
-			}
-		}
+		// 按顺序收集文本和附件，文件ID、图片、文档、音频等附件统一上传
+		parts := collectMessageContent(ctx, i, msg)
 
 		itemID := fmt.Sprintf("msg:%s", uuid.New().String())
 		itemType := "question"
@@ -503,95 +511,18 @@ func ChatGPTToMonica(cfg *config.Config, chatReq openai.ChatCompletionRequest) (
 		var content ItemContent
 
 		// 处理附件上传
-		if len(attachments) > 0 {
-			// 创建带超时的上下文
-			uploadCtx, cancel := context.WithTimeout(context.Background(), FileUploadTimeout)
-			defer cancel()
-
-			// 统计上传成功和失败数量
-			var successCount, failureCount int64
-
-			// 并发上传所有类型的文件
-			uploadResults := lop.Map(attachments, func(attachment AttachmentRequest, _ int) *FileInfo {
-				// 确定文件来源类型
-				var source FileUploadSource
-				var fileData interface{}
-				
-				if strings.HasPrefix(attachment.Data, "data:") {
-					source = SourceBase64
-					fileData = attachment.Data
-				} else if strings.HasPrefix(attachment.Data, "http") {
-					source = SourceURL
-					fileData = attachment.Data
-				} else {
-					// 对于纯文本内容，使用字节数据
-					source = SourceBytes
-					fileData = []byte(attachment.Data)
-				}
-
-				// 创建上传请求
-				fileReq := &UniversalFileUploadRequest{
-					Data:      fileData,
-					Source:    source,
-					FileName:  attachment.FileName,
-					MimeType:  attachment.MimeType,
-					ParseFile: true, // 默认启用LLM解析
-				}
-
-				f, err := UploadUniversalFile(uploadCtx, cfg, fileReq)
-				if err != nil {
-					atomic.AddInt64(&failureCount, 1)
-					logger.Error("文件上传失败",
-						zap.Error(err),
-						zap.String("file_type", attachment.Type),
-						zap.String("file_name", attachment.FileName),
-					)
-					return nil
-				}
-
-				if f == nil {
-					atomic.AddInt64(&failureCount, 1)
-					logger.Warn("文件上传返回空结果",
-						zap.String("file_name", attachment.FileName))
-					return nil
-				}
-
-				atomic.AddInt64(&successCount, 1)
-				return f
-			})
-
-			// 过滤掉失败的上传
-			fileInfoList := make([]FileInfo, 0, len(uploadResults))
-			for _, result := range uploadResults {
-				if result != nil {
-					fileInfoList = append(fileInfoList, *result)
-				}
-			}
-
-			// 记录上传统计信息
-			if failureCount > 0 {
-				logger.Warn("文件上传完成",
-					zap.Int64("success_count", successCount),
-					zap.Int64("failure_count", failureCount),
-					zap.Int("total_attachments", len(attachments)),
-				)
-			} else {
-				logger.Info("所有文件上传成功",
-					zap.Int64("success_count", successCount),
-					zap.Int("total_attachments", len(attachments)),
-				)
-			}
-
+		if parts.hasFiles() {
+			text, fileInfos := uploadMessageContent(ctx, cfg, parts)
 			content = ItemContent{
 				Type:        "file_with_text",
-				Content:     msgContext,
-				FileInfos:   fileInfoList,
+				Content:     text,
+				FileInfos:   fileInfos,
 				IsIncognito: true,
 			}
 		} else {
 			content = ItemContent{
 				Type:        "text",
-				Content:     msg.Content,
+				Content:     parts.Text(),
 				IsIncognito: true,
 			}
 		}
@@ -634,7 +565,13 @@ func ChatGPTToMonica(cfg *config.Config, chatReq openai.ChatCompletionRequest) (
 }
 
 // ChatGPTToCustomBot 转换ChatGPT请求到Custom Bot请求
-func ChatGPTToCustomBot(cfg *config.Config, chatReq openai.ChatCompletionRequest, botUID string) (*CustomBotRequest, error) {
+func ChatGPTToCustomBot(ctx context.Context, cfg *config.Config, chatReq openai.ChatCompletionRequest, botUID string) (_ *CustomBotRequest, err error) {
+	ctx, span := tracing.Start(ctx, "ChatGPTToCustomBot",
+		attribute.String("gen_ai.request.model", chatReq.Model),
+		attribute.Int("messages", len(chatReq.Messages)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	if len(chatReq.Messages) == 0 {
 		return nil, fmt.Errorf("empty messages")
 	}
@@ -656,25 +593,15 @@ func ChatGPTToCustomBot(cfg *config.Config, chatReq openai.ChatCompletionRequest
 	// 提取system消息作为prompt
 	var systemPrompt string
 	// 转换消息
-	for _, msg := range chatReq.Messages {
+	for i, msg := range chatReq.Messages {
 		if msg.Role == "system" {
-			// 将system消息作为prompt
-			systemPrompt = msg.Content
+			// 将system消息作为prompt，prompt 不能携带附件，只使用文本部分
+			systemPrompt = collectMessageText(ctx, i, msg)
 			continue
 		}
 
-		var msgContext string
-		var imgUrl []*openai.ChatMessageImageURL
-		if len(msg.MultiContent) > 0 {
-			for _, content := range msg.MultiContent {
-				switch content.Type {
-				case "text":
-					msgContext = content.Text
-				case "image_url":
-					imgUrl = append(imgUrl, content.ImageURL)
-				}
-			}
-		}
+		// 与 ChatGPTToMonica 相同的附件处理：文件ID、图片 URL/data URI、文档、音频都通过 UploadUniversalFile 上传
+		parts := collectMessageContent(ctx, i, msg)
 
 		itemID := fmt.Sprintf("msg:%s", uuid.New().String())
 		itemType := "question"
@@ -683,43 +610,18 @@ func ChatGPTToCustomBot(cfg *config.Config, chatReq openai.ChatCompletionRequest
 		}
 
 		var content ItemContent
-		if len(imgUrl) > 0 {
-			// 处理图片上传
-			uploadCtx, cancel := context.WithTimeout(context.Background(), FileUploadTimeout)
-			defer cancel()
-
-			var successCount, failureCount int64
-			uploadResults := lop.Map(imgUrl, func(item *openai.ChatMessageImageURL, _ int) *FileInfo {
-				f, err := UploadBase64Image(uploadCtx, cfg, item.URL)
-				if err != nil {
-					atomic.AddInt64(&failureCount, 1)
-					logger.Error("上传图片失败",
-						zap.Error(err),
-						zap.String("image_url", item.URL),
-					)
-					return nil
-				}
-				atomic.AddInt64(&successCount, 1)
-				return f
-			})
-
-			fileIfoList := make([]FileInfo, 0, len(uploadResults))
-			for _, result := range uploadResults {
-				if result != nil {
-					fileIfoList = append(fileIfoList, *result)
-				}
-			}
-
+		if parts.hasFiles() {
+			text, fileInfos := uploadMessageContent(ctx, cfg, parts)
 			content = ItemContent{
 				Type:        "file_with_text",
-				Content:     msgContext,
-				FileInfos:   fileIfoList,
+				Content:     text,
+				FileInfos:   fileInfos,
 				IsIncognito: false,
 			}
 		} else {
 			content = ItemContent{
 				Type:        "text",
-				Content:     msg.Content,
+				Content:     parts.Text(),
 				IsIncognito: false,
 			}
 		}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"mime/multipart"
+	"strings"
 
 	"github.com/sashabaranov/go-openai"
 )
@@ -15,11 +16,39 @@ type ExtendedChatCompletionMessage struct {
 
 // ExtendedChatMessagePart 扩展的消息部分，支持更多内容类型
 type ExtendedChatMessagePart struct {
-	Type     string                      `json:"type"`                // "text", "image_url", "document", "audio", etc.
+	Type     string                      `json:"type"`                // "text", "image_url", "file", "document", "audio", etc.
 	Text     string                      `json:"text,omitempty"`      // 文本内容
-	ImageURL *openai.ChatMessageImageURL `json:"image_url,omitempty"` // 图片URL
+	ImageURL *openai.ChatMessageImageURL `json:"image_url,omitempty"` // 图片URL，也可以是 /v1/files 返回的文件ID
+	File     *FilePart                   `json:"file,omitempty"`      // 引用已上传的文件
 	Document *DocumentContent            `json:"document,omitempty"`  // 文档内容
 	Audio    *AudioContent               `json:"audio,omitempty"`     // 音频内容
+
+	// Resolved 文件ID对应的已上传文件，由服务层从文件存储中查出，直接作为附件而不重新上传
+	Resolved *FileInfo `json:"-"`
+}
+
+// FilePart OpenAI 的 file 内容部分
+type FilePart struct {
+	FileID   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"` // base64 data URI
+}
+
+// FileID 返回内容部分引用的已上传文件ID，未引用时为空；
+// image_url 的 URL 不含协议时视为文件ID
+func (p ExtendedChatMessagePart) FileID() string {
+	switch p.Type {
+	case "file":
+		if p.File != nil {
+			return p.File.FileID
+		}
+	case "image_url":
+		if p.ImageURL != nil && p.ImageURL.URL != "" &&
+			!strings.HasPrefix(p.ImageURL.URL, "data:") && !strings.Contains(p.ImageURL.URL, "://") {
+			return p.ImageURL.URL
+		}
+	}
+	return ""
 }
 
 // ExtendedChatCompletionRequest 扩展的聊天完成请求
@@ -46,8 +75,11 @@ type FileObject struct {
 
 // FileListResponse OpenAI兼容的文件列表响应
 type FileListResponse struct {
-	Object string       `json:"object"` // 固定为 "list"
-	Data   []FileObject `json:"data"`   // 文件列表
+	Object  string       `json:"object"`             // 固定为 "list"
+	Data    []FileObject `json:"data"`               // 文件列表
+	FirstID string       `json:"first_id,omitempty"` // 本页第一个文件的ID
+	LastID  string       `json:"last_id,omitempty"`  // 本页最后一个文件的ID，可作为下一页的 after
+	HasMore bool         `json:"has_more"`           // 之后是否还有文件
 }
 
 // FileUploadRequest OpenAI兼容的文件上传请求
@@ -63,6 +95,44 @@ type DeleteFileResponse struct {
 	Deleted bool   `json:"deleted"` // 是否删除成功
 }
 
+// UploadObject OpenAI兼容的分片上传对象
+type UploadObject struct {
+	ID        string             `json:"id"`              // 上传ID
+	Object    string             `json:"object"`          // 固定为 "upload"
+	Bytes     int64              `json:"bytes"`           // 声明的文件总大小
+	CreatedAt int64              `json:"created_at"`      // 创建时间戳
+	Filename  string             `json:"filename"`        // 文件名
+	Purpose   string             `json:"purpose"`         // 文件用途
+	Status    string             `json:"status"`          // pending、completed、cancelled 或 expired
+	ExpiresAt int64              `json:"expires_at"`      // 过期时间戳
+	File      *FileObject        `json:"file"`            // 完成后生成的文件
+	Parts     []UploadPartObject `json:"parts,omitempty"` // 已接收的分片，中断后据此续传
+}
+
+// UploadPartObject OpenAI兼容的上传分片对象
+type UploadPartObject struct {
+	ID        string `json:"id"`               // 分片ID
+	Object    string `json:"object"`           // 固定为 "upload.part"
+	CreatedAt int64  `json:"created_at"`       // 创建时间戳
+	UploadID  string `json:"upload_id"`        // 所属上传ID
+	Bytes     int64  `json:"bytes,omitempty"`  // 分片大小
+	SHA256    string `json:"sha256,omitempty"` // 分片内容的 SHA-256
+}
+
+// CreateUploadRequest OpenAI兼容的创建上传请求
+type CreateUploadRequest struct {
+	Filename string `json:"filename"`  // 文件名
+	Purpose  string `json:"purpose"`   // 文件用途
+	Bytes    int64  `json:"bytes"`     // 文件总大小
+	MimeType string `json:"mime_type"` // 文件MIME类型
+}
+
+// CompleteUploadRequest OpenAI兼容的完成上传请求
+type CompleteUploadRequest struct {
+	PartIDs []string `json:"part_ids"`      // 按顺序排列的分片ID
+	MD5     string   `json:"md5,omitempty"` // 可选，组装后文件的 MD5，用于校验
+}
+
 // ImageGenerationRequest represents a request to create an image using DALL-E
 type ImageGenerationRequest struct {
 	Model          string `json:"model"`                     // Required. Currently supports: dall-e-3
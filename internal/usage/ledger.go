@@ -0,0 +1,198 @@
+package usage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"monica-proxy/internal/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var recordsBucket = []byte("records")
+
+const (
+	queueSize = 1024
+	batchSize = 128
+)
+
+// Record 一次已完成请求的用量记录
+type Record struct {
+	ID               string    `json:"id"`
+	Time             time.Time `json:"time"`
+	APIKey           string    `json:"api_key"` // 脱敏后的API Key
+	Route            string    `json:"route"`
+	RequestedModel   string    `json:"requested_model"`
+	Model            string    `json:"model"`   // 实际提供服务的模型
+	Account          int       `json:"account"` // 上游账号序号，0为主账号
+	Stream           bool      `json:"stream"`
+	PromptTokens     int       `json:"prompt_tokens"`     // 估算值
+	CompletionTokens int       `json:"completion_tokens"` // 估算值
+	Attachments      int       `json:"attachments"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Status           int       `json:"status"`
+	Outcome          string    `json:"outcome"` // success、client_error 或 error
+	Credits          int       `json:"credits"`
+}
+
+// Ledger 基于 bbolt 的用量账本，写入通过后台队列批量完成，不阻塞请求
+type Ledger struct {
+	db    *bolt.DB
+	path  string
+	queue chan Record
+	done  chan struct{}
+
+	// mu 保护 closed 和关闭队列；请求开始时取得的账本可能在请求结束前被重载关闭
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Open 打开或创建账本文件
+func Open(path string) (*Ledger, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create usage directory failed: %w", err)
+		}
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open usage ledger failed: %w", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(recordsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init usage ledger failed: %w", err)
+	}
+
+	l := &Ledger{
+		db:    db,
+		path:  path,
+		queue: make(chan Record, queueSize),
+		done:  make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Path 账本文件路径
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Add 提交一条记录，队列已满或账本已关闭时丢弃并记录警告
+func (l *Ledger) Add(r Record) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		logger.Warn("用量账本已关闭，丢弃记录", zap.String("id", r.ID))
+		return
+	}
+	select {
+	case l.queue <- r:
+	default:
+		logger.Warn("用量记录队列已满，丢弃记录", zap.String("id", r.ID))
+	}
+}
+
+// Close 写完队列中剩余的记录后关闭账本，之后提交的记录被丢弃；重复调用无副作用
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	return l.db.Close()
+}
+
+// run 后台批量写入
+func (l *Ledger) run() {
+	defer close(l.done)
+	batch := make([]Record, 0, batchSize)
+	for r := range l.queue {
+		batch = append(batch[:0], r)
+	fill:
+		for len(batch) < batchSize {
+			select {
+			case next, ok := <-l.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+		if err := l.write(batch); err != nil {
+			logger.Error("写入用量记录失败", zap.Int("count", len(batch)), zap.Error(err))
+		}
+	}
+}
+
+func (l *Ledger) write(batch []Record) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		for _, r := range batch {
+			value, err := sonic.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(recordKey(r), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordKey 按时间排序的键：8字节纳秒时间戳 + 请求ID
+func recordKey(r Record) []byte {
+	key := make([]byte, 8, 8+len(r.ID))
+	binary.BigEndian.PutUint64(key, uint64(r.Time.UnixNano()))
+	return append(key, r.ID...)
+}
+
+// Scan 按时间顺序遍历 [from, to) 区间内的记录，fn 返回 false 时停止
+func (l *Ledger) Scan(from, to time.Time, fn func(Record) bool) error {
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, uint64(from.UnixNano()))
+	end := uint64(to.UnixNano())
+
+	return l.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(recordsBucket).Cursor()
+		for k, v := cursor.Seek(start); k != nil; k, v = cursor.Next() {
+			if binary.BigEndian.Uint64(k[:8]) >= end {
+				break
+			}
+			var r Record
+			if err := sonic.Unmarshal(v, &r); err != nil {
+				continue
+			}
+			if !fn(r) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// Records 返回区间内的原始记录，limit 为0时不限制
+func (l *Ledger) Records(from, to time.Time, limit int) ([]Record, error) {
+	var records []Record
+	err := l.Scan(from, to, func(r Record) bool {
+		records = append(records, r)
+		return limit <= 0 || len(records) < limit
+	})
+	return records, err
+}
@@ -0,0 +1,159 @@
+package usage
+
+import (
+	"monica-proxy/internal/config"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestLedger(t *testing.T) *Ledger {
+	t.Helper()
+	l, err := Open(filepath.Join(t.TempDir(), "usage.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return l
+}
+
+func TestLedgerRecords(t *testing.T) {
+	l := openTestLedger(t)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c", "d"} {
+		l.Add(Record{ID: id, Time: base.Add(time.Duration(i) * time.Hour)})
+	}
+	// Close 写完队列后才返回，之后重新打开读取
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	l, err := Open(l.Path())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		limit    int
+		want     []string
+	}{
+		{"all", base, base.Add(24 * time.Hour), 0, []string{"a", "b", "c", "d"}},
+		{"half open range", base.Add(time.Hour), base.Add(3 * time.Hour), 0, []string{"b", "c"}},
+		{"limit", base, base.Add(24 * time.Hour), 2, []string{"a", "b"}},
+		{"empty", base.Add(48 * time.Hour), base.Add(72 * time.Hour), 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := l.Records(tt.from, tt.to, tt.limit)
+			if err != nil {
+				t.Fatalf("Records: %v", err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, r.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLedgerAddAfterClose(t *testing.T) {
+	l := openTestLedger(t)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// 请求开始时取得的账本在重载后被关闭，结束时提交的记录应被丢弃而不是 panic
+	l.Add(Record{ID: "late", Time: time.Now()})
+	if err := l.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestLedgerConcurrentAddAndClose(t *testing.T) {
+	l := openTestLedger(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				l.Add(Record{ID: "r", Time: time.Now()})
+			}
+		}()
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	wg.Wait()
+}
+
+func TestTrackerFinishAfterReload(t *testing.T) {
+	l := openTestLedger(t)
+	current.Store(l)
+	defer current.Store(nil)
+
+	_, tracker := Start(t.Context(), "req", "/v1/chat/completions", "sk-test-key")
+	if tracker == nil {
+		t.Fatal("Start returned nil tracker with ledger enabled")
+	}
+	if err := Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	tracker.Finish(200, nil)
+}
+
+func TestInit(t *testing.T) {
+	t.Cleanup(func() { Close() })
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "not-a-dir")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		path     string
+		wantErr  bool
+		wantPath string // 空表示未启用
+	}{
+		{"enable", true, filepath.Join(dir, "a.db"), false, filepath.Join(dir, "a.db")},
+		{"unchanged", true, filepath.Join(dir, "a.db"), false, filepath.Join(dir, "a.db")},
+		{"open failure keeps the old ledger", true, filepath.Join(blocker, "b.db"), true, filepath.Join(dir, "a.db")},
+		{"path changed", true, filepath.Join(dir, "b.db"), false, filepath.Join(dir, "b.db")},
+		{"disable", false, filepath.Join(dir, "b.db"), false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.GetDefaultConfig()
+			cfg.Usage.Enabled = tt.enabled
+			cfg.Usage.DBPath = tt.path
+			if err := Init(cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("Init = %v, wantErr %v", err, tt.wantErr)
+			}
+			l := Current()
+			if tt.wantPath == "" {
+				if l != nil {
+					t.Errorf("ledger still open at %s", l.Path())
+				}
+				return
+			}
+			if l == nil || l.Path() != tt.wantPath {
+				t.Fatalf("ledger = %v, want path %s", l, tt.wantPath)
+			}
+			if _, err := l.Records(time.Time{}, time.Now(), 1); err != nil {
+				t.Errorf("current ledger unusable: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 支持的聚合维度
+const (
+	GroupKey   = "key"
+	GroupModel = "model"
+	GroupDay   = "day"
+)
+
+// DayLayout 按天聚合时使用的日期格式（本地时区）
+const DayLayout = "2006-01-02"
+
+// Row 聚合结果，未参与聚合的维度为空
+type Row struct {
+	Key              string `json:"key,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Day              string `json:"day,omitempty"`
+	Requests         int    `json:"requests"`
+	Errors           int    `json:"errors"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Attachments      int    `json:"attachments"`
+	Credits          int    `json:"credits"`
+	AvgLatencyMs     int64  `json:"avg_latency_ms"`
+
+	totalLatency int64
+}
+
+// ParseGroupBy 解析逗号分隔的聚合维度
+func ParseGroupBy(value string) ([]string, error) {
+	if value == "" {
+		return []string{GroupKey, GroupModel, GroupDay}, nil
+	}
+	var groups []string
+	for _, g := range strings.Split(value, ",") {
+		g = strings.TrimSpace(g)
+		switch g {
+		case GroupKey, GroupModel, GroupDay:
+			groups = append(groups, g)
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported group_by: %s", g)
+		}
+	}
+	return groups, nil
+}
+
+// Aggregate 按给定维度聚合区间内的记录，结果按维度排序
+func (l *Ledger) Aggregate(from, to time.Time, groupBy []string) ([]Row, error) {
+	rows := make(map[[3]string]*Row)
+	err := l.Scan(from, to, func(r Record) bool {
+		var dims [3]string
+		for _, g := range groupBy {
+			switch g {
+			case GroupKey:
+				dims[0] = r.APIKey
+			case GroupModel:
+				dims[1] = r.Model
+			case GroupDay:
+				dims[2] = r.Time.Local().Format(DayLayout)
+			}
+		}
+
+		row, ok := rows[dims]
+		if !ok {
+			row = &Row{Key: dims[0], Model: dims[1], Day: dims[2]}
+			rows[dims] = row
+		}
+		row.Requests++
+		if r.Outcome != OutcomeSuccess {
+			row.Errors++
+		}
+		row.PromptTokens += r.PromptTokens
+		row.CompletionTokens += r.CompletionTokens
+		row.Attachments += r.Attachments
+		row.Credits += r.Credits
+		row.totalLatency += r.LatencyMs
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		row.AvgLatencyMs = row.totalLatency / int64(row.Requests)
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Model < b.Model
+	})
+	return result, nil
+}
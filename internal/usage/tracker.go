@@ -0,0 +1,259 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"monica-proxy/internal/config"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/bytedance/sonic"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 请求结果
+const (
+	OutcomeSuccess     = "success"
+	OutcomeClientError = "client_error"
+	OutcomeError       = "error"
+)
+
+var (
+	current atomic.Pointer[Ledger]
+	initMu  sync.Mutex
+)
+
+// Init 按配置打开全局账本；路径未变化时复用已打开的账本，未启用时关闭
+func Init(cfg *config.Config) error {
+	initMu.Lock()
+	defer initMu.Unlock()
+
+	old := current.Load()
+	if !cfg.Usage.Enabled {
+		if old != nil {
+			current.Store(nil)
+			return old.Close()
+		}
+		return nil
+	}
+	if old != nil && old.Path() == cfg.Usage.DBPath {
+		return nil
+	}
+
+	// 新账本打开成功后才替换，失败时继续使用旧账本
+	ledger, err := Open(cfg.Usage.DBPath)
+	if err != nil {
+		return err
+	}
+	current.Store(ledger)
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Current 返回当前账本，未启用时为 nil
+func Current() *Ledger {
+	return current.Load()
+}
+
+// Close 关闭全局账本
+func Close() error {
+	initMu.Lock()
+	defer initMu.Unlock()
+	if old := current.Swap(nil); old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// Tracker 单个请求的用量跟踪，所有方法对 nil 安全
+type Tracker struct {
+	ledger *Ledger
+	start  time.Time
+
+	mu         sync.Mutex
+	record     Record
+	completion tokenCounter
+}
+
+type trackerKey struct{}
+
+// Start 开始跟踪一个请求，未启用账本时返回原 ctx 和 nil
+func Start(ctx context.Context, id, route, apiKey string) (context.Context, *Tracker) {
+	ledger := current.Load()
+	if ledger == nil {
+		return ctx, nil
+	}
+	t := &Tracker{
+		ledger: ledger,
+		start:  time.Now(),
+		record: Record{
+			ID:     id,
+			Time:   time.Now(),
+			APIKey: MaskKey(apiKey),
+			Route:  route,
+		},
+	}
+	return context.WithValue(ctx, trackerKey{}, t), t
+}
+
+// FromContext 获取当前请求的用量跟踪
+func FromContext(ctx context.Context) *Tracker {
+	t, _ := ctx.Value(trackerKey{}).(*Tracker)
+	return t
+}
+
+// SetChatRequest 记录聊天请求的模型、估算的输入 token 和附件数量
+func (t *Tracker) SetChatRequest(req *openai.ChatCompletionRequest) {
+	if t == nil {
+		return
+	}
+	var prompt tokenCounter
+	attachments := 0
+	for _, msg := range req.Messages {
+		prompt.add(msg.Content)
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				prompt.add(part.Text)
+			} else {
+				attachments++
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.RequestedModel = req.Model
+	t.record.Stream = req.Stream
+	t.record.PromptTokens = prompt.tokens()
+	t.record.Attachments = attachments
+}
+
+// SetModel 记录请求的模型（非聊天请求）
+func (t *Tracker) SetModel(model string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.RequestedModel = model
+}
+
+// SetServed 记录实际提供服务的模型和上游账号
+func (t *Tracker) SetServed(model string, account int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Model = model
+	t.record.Account = account
+}
+
+// TeeUpstream 返回在读取上游SSE的同时统计输出 token 的 Reader
+func (t *Tracker) TeeUpstream(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return io.TeeReader(r, &sseTextCounter{counter: &t.completion, mu: &t.mu})
+}
+
+// Finish 结束跟踪并写入账本；credits 为按模型配置的每次请求消耗
+func (t *Tracker) Finish(status int, credits map[string]int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	r := t.record
+	r.CompletionTokens = t.completion.tokens()
+	t.mu.Unlock()
+
+	if r.Model == "" {
+		r.Model = r.RequestedModel
+	}
+	r.Status = status
+	r.LatencyMs = time.Since(t.start).Milliseconds()
+	switch {
+	case status >= http.StatusInternalServerError:
+		r.Outcome = OutcomeError
+	case status >= http.StatusBadRequest:
+		r.Outcome = OutcomeClientError
+	default:
+		r.Outcome = OutcomeSuccess
+		r.Credits = credits[r.Model]
+	}
+	t.ledger.Add(r)
+}
+
+// MaskKey 脱敏API Key，只保留前缀用于区分
+func MaskKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return "***"
+	}
+	return key[:8] + "..."
+}
+
+// tokenCounter 粗略估算 token 数：中日韩字符按1个计，其余字符按4个一个计
+type tokenCounter struct {
+	cjk   int
+	other int
+}
+
+func (c *tokenCounter) add(text string) {
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			c.cjk++
+		} else {
+			c.other++
+		}
+	}
+}
+
+func (c *tokenCounter) tokens() int {
+	return c.cjk + (c.other+3)/4
+}
+
+// sseTextCounter 解析经过的SSE数据行，累计其中的文本
+type sseTextCounter struct {
+	counter *tokenCounter
+	mu      *sync.Mutex
+	partial []byte
+}
+
+func (w *sseTextCounter) Write(p []byte) (int, error) {
+	data := append(w.partial, p...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		w.countLine(data[:idx])
+		data = data[idx+1:]
+	}
+	w.partial = append(w.partial[:0], data...)
+	return len(p), nil
+}
+
+func (w *sseTextCounter) countLine(line []byte) {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	var chunk struct {
+		Text string `json:"text"`
+	}
+	if sonic.Unmarshal(bytes.TrimSpace(payload), &chunk) != nil || chunk.Text == "" {
+		return
+	}
+	w.mu.Lock()
+	w.counter.add(chunk.Text)
+	w.mu.Unlock()
+}
@@ -1,28 +1,58 @@
 package utils
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"monica-proxy/internal/config"
+	"monica-proxy/internal/metrics"
 	"net"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
 var (
-	// 全局客户端实例，将在初始化时设置
-	RestySSEClient     *resty.Client
-	RestyDefaultClient *resty.Client
+	// 全局客户端实例，将在初始化时设置，重载配置时整体替换
+	sseClient     atomic.Pointer[resty.Client]
+	defaultClient atomic.Pointer[resty.Client]
 )
 
-// InitHTTPClients 初始化HTTP客户端
+// InitHTTPClients 初始化HTTP客户端；进行中的请求继续使用替换前的客户端
 func InitHTTPClients(cfg *config.Config) {
-	RestySSEClient = createSSEClient(cfg)
-	RestyDefaultClient = createDefaultClient(cfg)
+	sseClient.Store(instrument(createSSEClient(cfg)))
+	defaultClient.Store(instrument(createDefaultClient(cfg)))
+	urlFetcher.Store(newFetcher(cfg))
+}
+
+// RestySSEClient 返回当前的SSE客户端，未初始化时为 nil
+func RestySSEClient() *resty.Client {
+	return sseClient.Load()
+}
+
+// RestyDefaultClient 返回当前的默认客户端，未初始化时为 nil
+func RestyDefaultClient() *resty.Client {
+	return defaultClient.Load()
+}
+
+// instrument 为客户端添加上游请求指标采集
+func instrument(client *resty.Client) *resty.Client {
+	client.OnSuccess(func(c *resty.Client, resp *resty.Response) {
+		metrics.ObserveUpstream(resp.Request.URL, resp.StatusCode())
+	})
+	client.OnError(func(req *resty.Request, err error) {
+		// 收到响应但状态码异常时按状态码记录，否则记为连接错误
+		if respErr, ok := err.(*resty.ResponseError); ok {
+			metrics.ObserveUpstream(req.URL, respErr.Response.StatusCode())
+			return
+		}
+		metrics.ObserveUpstream(req.URL, 0)
+	})
+	return client
 }
 
 // createSSEClient 创建SSE专用客户端
@@ -56,13 +86,12 @@ func createSSEClient(cfg *config.Config) *resty.Client {
 		}
 	}
 
+	// SSE请求不在resty层重试：重试需要感知流内容（首个内容块之前才能重试），
+	// 由 monica.OpenChatStream 负责，并支持切换账号与降级模型
 	client := resty.NewWithClient(&http.Client{
 		Transport: transport,
 		Timeout:   cfg.HTTPClient.Timeout,
 	}).
-		SetRetryCount(cfg.HTTPClient.RetryCount).
-		SetRetryWaitTime(cfg.HTTPClient.RetryWaitTime).
-		SetRetryMaxWaitTime(cfg.HTTPClient.RetryMaxWaitTime).
 		SetDoNotParseResponse(true). // SSE需要流式处理
 		SetHeaders(map[string]string{
 			"Content-Type":    "application/json",
@@ -78,12 +107,6 @@ func createSSEClient(cfg *config.Config) *resty.Client {
 			return nil
 		})
 
-	// 添加重试条件
-	client.AddRetryCondition(func(r *resty.Response, err error) bool {
-		// 网络错误或5xx错误时重试
-		return err != nil || r.StatusCode() >= 500
-	})
-
 	return client
 }
 
@@ -166,6 +189,11 @@ type MonicaQuotaResponse struct {
 
 // GetMonicaQuota 获取Monica额度信息
 func GetMonicaQuota(cfg *config.Config) (*MonicaQuotaResponse, error) {
+	return GetMonicaQuotaContext(context.Background(), cfg)
+}
+
+// GetMonicaQuotaContext 获取Monica额度信息，可通过 ctx 控制超时
+func GetMonicaQuotaContext(ctx context.Context, cfg *config.Config) (*MonicaQuotaResponse, error) {
 	// 创建专用的HTTP客户端
 	client := resty.New().
 		SetTimeout(30 * time.Second).
@@ -205,6 +233,7 @@ func GetMonicaQuota(cfg *config.Config) (*MonicaQuotaResponse, error) {
 	if cfg.Monica.Cookie != "" {
 		client.SetHeader("Cookie", cfg.Monica.Cookie)
 	}
+	instrument(client)
 
 	// 准备请求数据
 	requestData := map[string]interface{}{
@@ -212,7 +241,7 @@ func GetMonicaQuota(cfg *config.Config) (*MonicaQuotaResponse, error) {
 	}
 
 	// 发送请求
-	resp, err := client.R().SetBody(requestData).Post("https://api.monica.im/api/usagev2/get_quotas")
+	resp, err := client.R().SetContext(ctx).SetBody(requestData).Post("https://api.monica.im/api/usagev2/get_quotas")
 	if err != nil {
 		return nil, fmt.Errorf("请求失败: %w", err)
 	}
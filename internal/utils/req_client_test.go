@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"monica-proxy/internal/config"
+	"sync"
+	"testing"
+)
+
+func TestInitHTTPClientsConcurrentReload(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	InitHTTPClients(cfg)
+
+	// 重载替换客户端的同时请求仍在读取，go test -race 下不应报告数据竞争
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				InitHTTPClients(cfg)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if RestySSEClient() == nil || RestyDefaultClient() == nil {
+					t.Error("client is nil during reload")
+					return
+				}
+				FetchURL(context.Background(), "file:///etc/passwd", nil)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"monica-proxy/internal/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrURLBlocked URL 的协议、主机或解析出的地址不允许访问
+var ErrURLBlocked = errors.New("url is not allowed")
+
+// ErrURLTooLarge 响应体超过 url_fetch.max_size
+var ErrURLTooLarge = errors.New("url content exceeds size limit")
+
+// URLContent 下载得到的内容
+type URLContent struct {
+	Data        []byte
+	ContentType string // 响应的媒体类型，不含参数，可能为空
+	FileName    string // 最终 URL 路径的最后一段，可能为空
+}
+
+// urlFetcher 当前的 URL 下载器，由 InitHTTPClients 创建
+var urlFetcher atomic.Pointer[fetcher]
+
+// FetchURL 下载 URL 附件。只允许 http/https；按 url_fetch 的主机列表过滤，默认拒绝内网地址，
+// 地址在 DNS 解析后和每次重定向时都会检查；accept 不为空时用于检查响应的媒体类型
+func FetchURL(ctx context.Context, rawURL string, accept func(mediaType string) bool) (*URLContent, error) {
+	f := urlFetcher.Load()
+	if f == nil {
+		return nil, fmt.Errorf("http clients not initialized")
+	}
+	return f.fetch(ctx, rawURL, accept)
+}
+
+// fetcher 带地址检查、大小和超时限制的下载器
+type fetcher struct {
+	cfg    config.URLFetchConfig
+	allow  hostRules
+	deny   hostRules
+	client *http.Client
+
+	// proxies 本下载器使用过的代理地址，拨号到代理时不做内网检查，目标地址已在请求前检查
+	proxies sync.Map
+}
+
+// newFetcher 创建下载器，使用与其他客户端相同的代理和 TLS 设置
+func newFetcher(cfg *config.Config) *fetcher {
+	f := &fetcher{
+		cfg:   cfg.URLFetch,
+		allow: parseHostRules(cfg.URLFetch.AllowHosts),
+		deny:  parseHostRules(cfg.URLFetch.DenyHosts),
+	}
+
+	proxy := configuredProxy(cfg)
+	transport := &http.Transport{
+		DialContext:           f.dialContext,
+		MaxIdleConns:          cfg.HTTPClient.MaxIdleConns,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: cfg.URLFetch.Timeout,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: cfg.Security.TLSSkipVerify,
+			MinVersion:         tls.VersionTLS12, // 强制使用TLS 1.2+
+		},
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			u, err := proxy(req)
+			if u != nil {
+				f.proxies.Store(canonicalAddr(u), true)
+			}
+			return u, err
+		},
+	}
+
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   cfg.URLFetch.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", f.cfg.MaxRedirects)
+			}
+			return f.checkURL(req.Context(), req.URL)
+		},
+	}
+	return f
+}
+
+// configuredProxy 返回配置的代理，未配置时使用环境变量中的代理设置
+func configuredProxy(cfg *config.Config) func(*http.Request) (*url.URL, error) {
+	proxyURL := cfg.Proxy.HTTPProxy
+	if proxyURL == "" {
+		proxyURL = cfg.Proxy.HTTPSProxy
+	}
+	if proxyURL != "" {
+		if parsed, err := url.Parse(proxyURL); err == nil {
+			return http.ProxyURL(parsed)
+		}
+	}
+	return http.ProxyFromEnvironment
+}
+
+func (f *fetcher) fetch(ctx context.Context, rawURL string, accept func(string) bool) (*URLContent, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+	defer cancel()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	if err := f.checkURL(ctx, u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	}
+
+	maxSize := int64(f.cfg.MaxSize)
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("%w: %d > %d bytes", ErrURLTooLarge, resp.ContentLength, maxSize)
+	}
+
+	content := &URLContent{}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		content.ContentType = mediaType
+	}
+	if accept != nil && content.ContentType != "" && !accept(content.ContentType) {
+		return nil, fmt.Errorf("unsupported content type: %s", content.ContentType)
+	}
+
+	// 多读一个字节用于判断是否超出限制，Content-Length 缺失或不准确时也不会读入过多数据
+	content.Data, err = io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read url content failed: %v", err)
+	}
+	if int64(len(content.Data)) > maxSize {
+		return nil, fmt.Errorf("%w: > %d bytes", ErrURLTooLarge, maxSize)
+	}
+
+	if name := resp.Request.URL.Path; name != "" {
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		content.FileName, _ = url.PathUnescape(name)
+	}
+	return content, nil
+}
+
+// checkURL 检查协议和主机，并解析主机名检查其地址；经过代理时这是唯一的地址检查
+func (f *fetcher) checkURL(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", ErrURLBlocked, u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrURLBlocked)
+	}
+	_, err := f.resolve(ctx, host)
+	return err
+}
+
+// resolve 解析主机并返回允许访问的地址，任一地址被拒绝时返回错误
+func (f *fetcher) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if f.deny.matchHost(host) {
+		return nil, fmt.Errorf("%w: host %s is denied", ErrURLBlocked, host)
+	}
+
+	allowedHost := f.allow.matchHost(host)
+	// 允许列表只有域名时无需解析即可拒绝
+	if !f.allow.empty() && !allowedHost && len(f.allow.prefixes) == 0 {
+		return nil, fmt.Errorf("%w: host %s is not in allow list", ErrURLBlocked, host)
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		addrs = ips
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address for host %s", host)
+	}
+
+	for i, addr := range addrs {
+		addr = addr.Unmap()
+		addrs[i] = addr
+		if f.deny.matchAddr(addr) {
+			return nil, fmt.Errorf("%w: address %s of %s is denied", ErrURLBlocked, addr, host)
+		}
+		allowedAddr := f.allow.matchAddr(addr)
+		if !f.allow.empty() && !allowedHost && !allowedAddr {
+			return nil, fmt.Errorf("%w: host %s is not in allow list", ErrURLBlocked, host)
+		}
+		// 允许列表中明确列出的 IP/CIDR 可以是内网地址
+		if !f.cfg.AllowPrivate && !allowedAddr && isInternalAddr(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to internal address %s", ErrURLBlocked, host, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// dialContext 直连目标时拨号到已检查的地址，避免检查之后 DNS 结果变化；拨号到代理时不检查
+func (f *fetcher) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if _, ok := f.proxies.Load(addr); ok {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := f.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// canonicalAddr 返回代理 URL 的 host:port，端口缺省时按协议补全
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// cgnatPrefix 运营商级 NAT 地址段，同样不应从公网访问
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// isInternalAddr 判断是否为内网、回环、链路本地（含云厂商元数据地址 169.254.169.254）等非公网地址
+func isInternalAddr(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || cgnatPrefix.Contains(addr) ||
+		(addr.Is4() && addr.As4()[0] == 0) // 0.0.0.0/8 在部分系统上等同于本机
+}
+
+// hostRules 主机列表，域名同时匹配其子域名，IP 和 CIDR 匹配解析后的地址
+type hostRules struct {
+	hosts    []string
+	prefixes []netip.Prefix
+}
+
+func parseHostRules(entries []string) hostRules {
+	var rules hostRules
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			rules.prefixes = append(rules.prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			rules.prefixes = append(rules.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		} else {
+			rules.hosts = append(rules.hosts, strings.TrimPrefix(strings.TrimSuffix(entry, "."), "*."))
+		}
+	}
+	return rules
+}
+
+func (r hostRules) empty() bool {
+	return len(r.hosts) == 0 && len(r.prefixes) == 0
+}
+
+func (r hostRules) matchHost(host string) bool {
+	for _, h := range r.hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r hostRules) matchAddr(addr netip.Addr) bool {
+	for _, prefix := range r.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
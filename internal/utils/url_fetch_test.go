@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"monica-proxy/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testFetcher(modify func(cfg *config.Config)) *fetcher {
+	cfg := config.GetDefaultConfig()
+	cfg.HTTPClient.MaxIdleConns = 1
+	if modify != nil {
+		modify(cfg)
+	}
+	return newFetcher(cfg)
+}
+
+func TestIsInternalAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isInternalAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("isInternalAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetcherCheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetch   config.URLFetchConfig
+		url     string
+		blocked bool
+	}{
+		{"public ip", config.URLFetchConfig{}, "http://93.184.216.34/a.png", false},
+		{"unsupported scheme", config.URLFetchConfig{}, "file:///etc/passwd", true},
+		{"missing host", config.URLFetchConfig{}, "http:///a.png", true},
+		{"loopback", config.URLFetchConfig{}, "http://127.0.0.1:8080/", true},
+		{"metadata", config.URLFetchConfig{}, "http://169.254.169.254/latest/meta-data", true},
+		{"ipv6 loopback", config.URLFetchConfig{}, "http://[::1]/", true},
+		{"ipv4 mapped loopback", config.URLFetchConfig{}, "http://[::ffff:127.0.0.1]/", true},
+		{"private allowed", config.URLFetchConfig{AllowPrivate: true}, "http://10.0.0.1/", false},
+		{"allow list cidr admits private", config.URLFetchConfig{AllowHosts: []string{"10.0.0.0/8"}}, "http://10.0.0.1/", false},
+		{"allow list rejects others", config.URLFetchConfig{AllowHosts: []string{"10.0.0.0/8"}}, "http://93.184.216.34/", true},
+		{"allow list domain only", config.URLFetchConfig{AllowHosts: []string{"example.com"}}, "http://other.test/", true},
+		{"deny host with subdomain", config.URLFetchConfig{DenyHosts: []string{"evil.test"}}, "http://cdn.evil.test/", true},
+		{"deny cidr", config.URLFetchConfig{DenyHosts: []string{"93.184.0.0/16"}}, "http://93.184.216.34/", true},
+		{"deny beats allow private", config.URLFetchConfig{AllowPrivate: true, DenyHosts: []string{"127.0.0.1"}}, "http://127.0.0.1/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFetcher(func(cfg *config.Config) {
+				cfg.URLFetch.AllowHosts = tt.fetch.AllowHosts
+				cfg.URLFetch.DenyHosts = tt.fetch.DenyHosts
+				cfg.URLFetch.AllowPrivate = tt.fetch.AllowPrivate
+			})
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = f.checkURL(context.Background(), u)
+			if got := errors.Is(err, ErrURLBlocked); got != tt.blocked {
+				t.Errorf("checkURL err = %v, blocked %v", err, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestFetchPrivateTargetNotDialed(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	_, err := testFetcher(nil).fetch(context.Background(), srv.URL+"/a.txt", nil)
+	if !errors.Is(err, ErrURLBlocked) {
+		t.Fatalf("err = %v, want ErrURLBlocked", err)
+	}
+	if hits != 0 {
+		t.Errorf("server received %d requests", hits)
+	}
+
+	content, err := testFetcher(func(cfg *config.Config) {
+		cfg.URLFetch.AllowPrivate = true
+	}).fetch(context.Background(), srv.URL+"/a.txt", nil)
+	if err != nil {
+		t.Fatalf("fetch with allow_private: %v", err)
+	}
+	if content.FileName != "a.txt" {
+		t.Errorf("file name = %q", content.FileName)
+	}
+}
+
+func plainText(mediaType string) bool {
+	return mediaType == "text/plain"
+}
+
+// TestFetchRedirects 通过代理访问公网地址，由代理返回重定向，检查每一跳的目标地址
+func TestFetchRedirects(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/to-metadata":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+		case "/to-loopback":
+			http.Redirect(w, r, "http://127.0.0.1:1/", http.StatusFound)
+		case "/to-file":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/to-public":
+			http.Redirect(w, r, "http://93.184.216.35/final.txt", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/big":
+			w.Write(make([]byte, 64))
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html></html>"))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   func(string) bool
+		wantErr  string // 为空表示成功
+		wantName string
+	}{
+		{"redirect to metadata", "/to-metadata", nil, "internal address 169.254.169.254", ""},
+		{"redirect to loopback", "/to-loopback", nil, "internal address 127.0.0.1", ""},
+		{"redirect to other scheme", "/to-file", nil, ErrURLBlocked.Error(), ""},
+		{"redirect to public", "/to-public", nil, "", "final.txt"},
+		{"too many redirects", "/loop", nil, "stopped after 3 redirects", ""},
+		{"too large", "/big", nil, ErrURLTooLarge.Error(), ""},
+		{"content type rejected", "/html", plainText, "unsupported content type: text/html", ""},
+		{"content type accepted", "/a.txt", plainText, "", "a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFetcher(func(cfg *config.Config) {
+				cfg.Proxy.HTTPProxy = proxy.URL
+				cfg.URLFetch.MaxRedirects = 3
+				cfg.URLFetch.MaxSize = 32
+			})
+			content, err := f.fetch(context.Background(), "http://93.184.216.34"+tt.path, tt.accept)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			if content.FileName != tt.wantName {
+				t.Errorf("file name = %q, want %q", content.FileName, tt.wantName)
+			}
+		})
+	}
+}
@@ -15,8 +15,14 @@ import (
 
 	"monica-proxy/internal/apiserver"
 	"monica-proxy/internal/config"
+	"monica-proxy/internal/filestore"
 	"monica-proxy/internal/logger"
 	customMiddleware "monica-proxy/internal/middleware"
+	"monica-proxy/internal/recorder"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/tracing"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
 	utils "monica-proxy/internal/utils"
 
 	"github.com/go-resty/resty/v2"
@@ -25,7 +31,7 @@ import (
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
-	"gopkg.in/yaml.v3"
+	"go.uber.org/zap"
 )
 
 //go:embed all:frontend/dist
@@ -39,8 +45,18 @@ var (
 
 // WailsBackendApp 结构体包含后端应用程序的状态和配置
 type WailsBackendApp struct {
-	config *config.Config
-	server *echo.Echo
+	config   *config.Config
+	server   *echo.Echo
+	metrics  *echo.Echo // 独立端口的指标服务，可能为 nil
+	drainer  *apiserver.Drainer
+	stopping bool
+
+	drainOnce sync.Once // StopService 与应用关闭可能同时触发停机，只执行一次
+
+	holder    *config.Holder // 运行中的配置，支持热重载
+	stopWatch func()         // 停止监听配置文件
+
+	shutdownTracing func(context.Context) error
 }
 
 // WailsApp Wails应用程序结构
@@ -88,15 +104,13 @@ func NewWailsConfigManager() *WailsConfigManager {
 	return &WailsConfigManager{config: cfg}
 }
 
-// SaveConfig 保存配置
+// SaveConfig 保存配置，敏感字段加密后写入，文件权限为 0600
 func (cm *WailsConfigManager) SaveConfig() error {
-	// 将配置保存到config.yaml文件
-	data, err := yaml.Marshal(cm.config)
-	if err != nil {
-		return err
-	}
+	return config.Save(cm.config, cm.ConfigPath())
+}
 
-	// 获取用户配置目录
+// ConfigPath 返回配置文件保存路径，优先使用用户配置目录
+func (cm *WailsConfigManager) ConfigPath() string {
 	configPath := "config.yaml"
 	if userHome, err := os.UserHomeDir(); err == nil {
 		configPath = filepath.Join(userHome, ".monica-proxy", "config.yaml")
@@ -106,8 +120,7 @@ func (cm *WailsConfigManager) SaveConfig() error {
 			configPath = "config.yaml"
 		}
 	}
-
-	return os.WriteFile(configPath, data, 0644)
+	return configPath
 }
 
 // GetConfig 获取配置
@@ -128,6 +141,8 @@ type WailsTestResult struct {
 // ServiceStatus 服务状态
 type ServiceStatus struct {
 	IsRunning bool   `json:"isRunning"`
+	Stopping  bool   `json:"stopping"`
+	InFlight  int64  `json:"inFlight"`
 	Message   string `json:"message"`
 	Address   string `json:"address,omitempty"`
 	APIKey    string `json:"apiKey,omitempty"`
@@ -140,6 +155,23 @@ type QuotaInfo struct {
 	Error     string `json:"error,omitempty"`
 }
 
+// UsageSeries 单个模型的每日用量
+type UsageSeries struct {
+	Model    string `json:"model"`
+	Requests []int  `json:"requests"`
+	Tokens   []int  `json:"tokens"`
+}
+
+// UsageChart 用量图表数据
+type UsageChart struct {
+	Days          []string      `json:"days"`
+	Series        []UsageSeries `json:"series"`
+	TotalRequests int           `json:"totalRequests"`
+	TotalTokens   int           `json:"totalTokens"`
+	TotalCredits  int           `json:"totalCredits"`
+	Error         string        `json:"error,omitempty"`
+}
+
 // NewWailsApp 创建Wails应用
 func NewWailsApp() *WailsApp {
 	return &WailsApp{
@@ -159,18 +191,31 @@ func (a *WailsApp) DomReady(ctx context.Context) {
 
 // Shutdown 在应用关闭时调用
 func (a *WailsApp) Shutdown(ctx context.Context) {
-	// 停止服务
+	// 停止服务，等待进行中的流式响应结束
 	wailsServerMu.Lock()
-	if wailsServerApp != nil && wailsServerApp.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		wailsServerApp.server.Shutdown(ctx)
-		wailsServerApp = nil
-	}
+	app := wailsServerApp
 	wailsServerMu.Unlock()
+
+	if app != nil && app.server != nil {
+		app.drain()
+	}
+	usage.Close()
+	filestore.Close()
+	types.CloseAttachmentCache()
+}
+
+// secretPlaceholder 界面中代替已设置的敏感值，提交回来时表示保持原值不变
+const secretPlaceholder = "********"
+
+// maskSecret 敏感值不以明文返回给界面，已设置时返回占位符
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return secretPlaceholder
 }
 
-// GetConfig 获取当前配置
+// GetConfig 获取当前配置，Cookie 和 API Key 等敏感值以占位符返回
 func (a *WailsApp) GetConfig() map[string]interface{} {
 	cfg := a.configManager.GetConfig()
 	return map[string]interface{}{
@@ -187,12 +232,12 @@ func (a *WailsApp) GetConfig() map[string]interface{} {
 			"noProxy":    cfg.Proxy.NoProxy,
 		},
 		"monica": map[string]interface{}{
-			"cookie":              cfg.Monica.Cookie,
+			"cookie":              maskSecret(cfg.Monica.Cookie),
 			"botUID":              cfg.Monica.BotUID,
 			"enableCustomBotMode": cfg.Monica.EnableCustomBotMode,
 		},
 		"security": map[string]interface{}{
-			"bearerToken":      cfg.Security.BearerToken,
+			"bearerToken":      maskSecret(cfg.Security.BearerToken),
 			"tlsSkipVerify":    cfg.Security.TLSSkipVerify,
 			"rateLimitEnabled": cfg.Security.RateLimitEnabled,
 			"rateLimitRPS":     cfg.Security.RateLimitRPS,
@@ -204,6 +249,11 @@ func (a *WailsApp) GetConfig() map[string]interface{} {
 			"output":           cfg.Logging.Output,
 			"enableRequestLog": cfg.Logging.EnableRequestLog,
 			"maskSensitive":    cfg.Logging.MaskSensitive,
+			"maxSizeMB":        cfg.Logging.MaxSizeMB,
+			"maxAgeDays":       cfg.Logging.MaxAgeDays,
+			"maxBackups":       cfg.Logging.MaxBackups,
+			"compress":         cfg.Logging.Compress,
+			"maxBodyBytes":     cfg.Logging.MaxBodyBytes,
 		},
 	}
 }
@@ -237,7 +287,7 @@ func (a *WailsApp) UpdateConfig(configData map[string]interface{}) error {
 
 	// 更新Monica配置
 	if monica, ok := configData["monica"].(map[string]interface{}); ok {
-		if cookie, ok := monica["cookie"].(string); ok {
+		if cookie, ok := monica["cookie"].(string); ok && cookie != secretPlaceholder {
 			cfg.Monica.Cookie = cookie
 		}
 		if botUID, ok := monica["botUID"].(string); ok {
@@ -250,7 +300,7 @@ func (a *WailsApp) UpdateConfig(configData map[string]interface{}) error {
 
 	// 更新安全配置
 	if security, ok := configData["security"].(map[string]interface{}); ok {
-		if bearerToken, ok := security["bearerToken"].(string); ok {
+		if bearerToken, ok := security["bearerToken"].(string); ok && bearerToken != secretPlaceholder {
 			cfg.Security.BearerToken = bearerToken
 		}
 		if tlsSkipVerify, ok := security["tlsSkipVerify"].(bool); ok {
@@ -281,6 +331,21 @@ func (a *WailsApp) UpdateConfig(configData map[string]interface{}) error {
 		if maskSensitive, ok := logging["maskSensitive"].(bool); ok {
 			cfg.Logging.MaskSensitive = maskSensitive
 		}
+		if maxSizeMB, ok := logging["maxSizeMB"].(float64); ok {
+			cfg.Logging.MaxSizeMB = int(maxSizeMB)
+		}
+		if maxAgeDays, ok := logging["maxAgeDays"].(float64); ok {
+			cfg.Logging.MaxAgeDays = int(maxAgeDays)
+		}
+		if maxBackups, ok := logging["maxBackups"].(float64); ok {
+			cfg.Logging.MaxBackups = int(maxBackups)
+		}
+		if compress, ok := logging["compress"].(bool); ok {
+			cfg.Logging.Compress = compress
+		}
+		if maxBodyBytes, ok := logging["maxBodyBytes"].(float64); ok {
+			cfg.Logging.MaxBodyBytes = int(maxBodyBytes)
+		}
 	}
 
 	return a.configManager.SaveConfig()
@@ -305,7 +370,13 @@ func (a *WailsApp) StartService() error {
 			logOutput = "./logs/monica-proxy.log"
 		}
 	}
-	logger.UpdateConfig(cfg.Logging.Level, cfg.Logging.Format, logOutput, cfg.Logging.MaskSensitive)
+	logger.UpdateConfig(cfg.Logging.Level, cfg.Logging.Format, logOutput, cfg.Logging.MaskSensitive, logger.RotateConfig{
+		MaxSizeMB:  cfg.Logging.MaxSizeMB,
+		Interval:   cfg.Logging.RotateInterval,
+		MaxAgeDays: cfg.Logging.MaxAgeDays,
+		MaxBackups: cfg.Logging.MaxBackups,
+		Compress:   cfg.Logging.Compress,
+	})
 
 	// 创建应用实例
 	utils.InitHTTPClients(cfg)
@@ -315,9 +386,46 @@ func (a *WailsApp) StartService() error {
 
 	// 如果服务已在运行，先停止
 	if wailsServerApp != nil {
+		if wailsServerApp.stopping {
+			return fmt.Errorf("服务正在停止，请稍后再试")
+		}
 		return fmt.Errorf("服务已在运行")
 	}
 
+	// 初始化链路追踪
+	shutdownTracing, err := tracing.Init(cfg)
+	if err != nil {
+		return fmt.Errorf("初始化链路追踪失败: %v", err)
+	}
+
+	// 初始化脱敏规则，请求日志与流量录制共用
+	if err := redact.Init(cfg); err != nil {
+		return fmt.Errorf("初始化脱敏规则失败: %v", err)
+	}
+
+	// 初始化流量录制
+	if err := recorder.Init(cfg); err != nil {
+		return fmt.Errorf("初始化流量录制失败: %v", err)
+	}
+
+	// 打开用量账本
+	if err := initUsageLedger(cfg); err != nil {
+		return fmt.Errorf("打开用量账本失败: %v", err)
+	}
+
+	// 打开文件存储
+	if err := initFileStore(cfg); err != nil {
+		return fmt.Errorf("打开文件存储失败: %v", err)
+	}
+
+	// 创建附件缓存
+	if err := initAttachmentCache(cfg); err != nil {
+		return fmt.Errorf("打开附件缓存失败: %v", err)
+	}
+
+	// 运行中的服务使用配置快照；界面保存配置会写入被监听的配置文件，随后热重载到运行中的服务
+	holder, stopWatch := newConfigHolder(cfg, a.configManager.ConfigPath())
+
 	// 创建Echo服务器
 	e := echo.New()
 	e.Logger.SetOutput(os.Stderr)
@@ -332,22 +440,30 @@ func (a *WailsApp) StartService() error {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 	e.Use(middleware.RequestID())
-	e.Use(customMiddleware.RateLimit(cfg))
+	e.Use(customMiddleware.RateLimit(holder))
 
 	// 注册路由
-	apiserver.RegisterRoutes(e, cfg)
+	drainer := apiserver.RegisterRoutes(e, holder)
 
 	wailsServerApp = &WailsBackendApp{
-		config: cfg,
-		server: e,
+		config:          cfg,
+		server:          e,
+		metrics:         apiserver.NewMetricsServer(holder),
+		drainer:         drainer,
+		holder:          holder,
+		stopWatch:       stopWatch,
+		shutdownTracing: shutdownTracing,
 	}
 
 	// 启动服务器
+	app := wailsServerApp
 	go func() {
-		if err := wailsServerApp.Start(); err != nil {
+		if err := app.Start(); err != nil && err != http.ErrServerClosed {
 			log.Printf("服务器启动失败: %v", err)
 			wailsServerMu.Lock()
-			wailsServerApp = nil
+			if wailsServerApp == app {
+				wailsServerApp = nil
+			}
 			wailsServerMu.Unlock()
 		}
 	}()
@@ -356,6 +472,7 @@ func (a *WailsApp) StartService() error {
 }
 
 // StopService 停止服务
+// 服务立即停止接受新请求，进行中的流式响应在后台排空，可通过 GetServiceStatus 查看剩余数量
 func (a *WailsApp) StopService() error {
 	wailsServerMu.Lock()
 	defer wailsServerMu.Unlock()
@@ -363,15 +480,12 @@ func (a *WailsApp) StopService() error {
 	if wailsServerApp == nil || wailsServerApp.server == nil {
 		return fmt.Errorf("服务未运行")
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := wailsServerApp.server.Shutdown(ctx); err != nil {
-		wailsServerApp.server.Close()
+	if wailsServerApp.stopping {
+		return fmt.Errorf("服务正在停止")
 	}
 
-	wailsServerApp = nil
+	wailsServerApp.stopping = true
+	go wailsServerApp.drain()
 	return nil
 }
 
@@ -385,8 +499,16 @@ func (a *WailsApp) GetServiceStatus() ServiceStatus {
 		Message:   "服务未启动",
 	}
 
+	if wailsServerApp != nil && wailsServerApp.stopping {
+		status.Stopping = true
+		status.InFlight = wailsServerApp.drainer.InFlight()
+		status.Message = fmt.Sprintf("服务正在停止，剩余 %d 个请求", status.InFlight)
+		return status
+	}
+
 	if wailsServerApp != nil && wailsServerApp.server != nil {
 		status.IsRunning = true
+		status.InFlight = wailsServerApp.drainer.InFlight()
 		status.Message = "服务正在运行"
 
 		cfg := a.configManager.GetConfig()
@@ -556,16 +678,79 @@ func (a *WailsApp) GetQuota() QuotaInfo {
 	}
 }
 
-// OpenLogDirectory 打开日志文件所在目录
-func (a *WailsApp) OpenLogDirectory() error {
-	// 获取用户日志目录
-	var logDir string
-	if userHome, err := os.UserHomeDir(); err == nil {
-		logDir = filepath.Join(userHome, ".monica-proxy", "logs")
-	} else {
-		// 回退到当前目录
-		logDir = "logs"
+// GetUsageChart 获取最近若干天按模型统计的每日用量，用于界面图表
+func (a *WailsApp) GetUsageChart(days int) UsageChart {
+	if days <= 0 {
+		days = 7
+	}
+
+	// 服务未启动时也允许查看历史用量
+	if usage.Current() == nil {
+		if err := initUsageLedger(a.configManager.GetConfig()); err != nil {
+			return UsageChart{Error: err.Error()}
+		}
+	}
+	ledger := usage.Current()
+	if ledger == nil {
+		return UsageChart{Error: "用量账本未启用"}
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1-days)
+	rows, err := ledger.Aggregate(from, now.Add(time.Second), []string{usage.GroupModel, usage.GroupDay})
+	if err != nil {
+		return UsageChart{Error: err.Error()}
+	}
+
+	chart := UsageChart{Days: make([]string, days)}
+	dayIndex := make(map[string]int, days)
+	for i := range chart.Days {
+		chart.Days[i] = from.AddDate(0, 0, i).Format(usage.DayLayout)
+		dayIndex[chart.Days[i]] = i
+	}
+
+	seriesIndex := make(map[string]int)
+	for _, row := range rows {
+		idx, ok := seriesIndex[row.Model]
+		if !ok {
+			idx = len(chart.Series)
+			seriesIndex[row.Model] = idx
+			chart.Series = append(chart.Series, UsageSeries{
+				Model:    row.Model,
+				Requests: make([]int, days),
+				Tokens:   make([]int, days),
+			})
+		}
+		tokens := row.PromptTokens + row.CompletionTokens
+		if day, ok := dayIndex[row.Day]; ok {
+			chart.Series[idx].Requests[day] += row.Requests
+			chart.Series[idx].Tokens[day] += tokens
+		}
+		chart.TotalRequests += row.Requests
+		chart.TotalTokens += tokens
+		chart.TotalCredits += row.Credits
 	}
+	return chart
+}
+
+// initUsageLedger 打开用量账本，相对路径放在数据目录（默认 ~/.monica-proxy）下
+func initUsageLedger(cfg *config.Config) error {
+	return usage.Init(cfg.WithDataPaths())
+}
+
+// initFileStore 打开文件存储，相对路径放在数据目录下
+func initFileStore(cfg *config.Config) error {
+	return filestore.Init(cfg.WithDataPaths())
+}
+
+// initAttachmentCache 创建附件缓存，磁盘层的相对路径放在数据目录下
+func initAttachmentCache(cfg *config.Config) error {
+	return types.InitAttachmentCache(cfg.WithDataPaths())
+}
+
+// OpenLogDirectory 打开日志文件所在目录，轮转后的归档文件也在该目录下
+func (a *WailsApp) OpenLogDirectory() error {
+	logDir := filepath.Dir(a.GetLogFilePath())
 
 	// 如果日志目录不存在，创建它
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
@@ -615,23 +800,27 @@ func (a *WailsApp) GetLogFilePath() string {
 	return logPath
 }
 
-// GetLogFileSize 获取日志文件大小
+// GetLogFileSize 获取日志文件大小，包含轮转后的归档文件
 func (a *WailsApp) GetLogFileSize() string {
-	logPath := a.GetLogFilePath()
-	
-	// 检查文件是否存在
-	if _, err := os.Stat(logPath); os.IsNotExist(err) {
-		return "文件不存在"
-	}
-	
-	// 获取文件信息
-	fileInfo, err := os.Stat(logPath)
+	segments, err := logger.LogSegments(a.GetLogFilePath())
 	if err != nil {
 		return fmt.Sprintf("获取文件大小失败: %v", err)
 	}
-	
+	if len(segments) == 0 {
+		return "文件不存在"
+	}
+
+	var size int64
+	for _, segment := range segments {
+		if fileInfo, err := os.Stat(segment); err == nil {
+			size += fileInfo.Size()
+		}
+	}
+
 	// 转换为人类可读格式
-	size := fileInfo.Size()
+	if len(segments) > 1 {
+		return fmt.Sprintf("%s (%d 个文件)", formatFileSize(size), len(segments))
+	}
 	return formatFileSize(size)
 }
 
@@ -644,9 +833,8 @@ func (a *WailsApp) ClearLogFile() error {
 		return fmt.Errorf("日志文件不存在")
 	}
 	
-	// 清空文件内容（截断文件）
-	err := os.WriteFile(logPath, []byte{}, 0644)
-	if err != nil {
+	// 清空文件内容（截断文件）并删除轮转归档
+	if err := logger.ClearLogFiles(logPath); err != nil {
 		return fmt.Errorf("清空日志文件失败: %v", err)
 	}
 	
@@ -677,6 +865,28 @@ func newWailsBackendApp(cfg *config.Config) *WailsBackendApp {
 	// 初始化HTTP客户端
 	utils.InitHTTPClients(cfg)
 
+	// 初始化链路追踪，失败时不影响服务启动
+	shutdownTracing, err := tracing.Init(cfg)
+	if err != nil {
+		log.Printf("初始化链路追踪失败: %v", err)
+		shutdownTracing = nil
+	}
+	if err := redact.Init(cfg); err != nil {
+		log.Printf("初始化脱敏规则失败: %v", err)
+	}
+	if err := recorder.Init(cfg); err != nil {
+		log.Printf("初始化流量录制失败: %v", err)
+	}
+	if err := initUsageLedger(cfg); err != nil {
+		log.Printf("打开用量账本失败: %v", err)
+	}
+	if err := initFileStore(cfg); err != nil {
+		log.Printf("打开文件存储失败: %v", err)
+	}
+	if err := initAttachmentCache(cfg); err != nil {
+		log.Printf("打开附件缓存失败: %v", err)
+	}
+
 	// 设置 Echo Server
 	e := echo.New()
 	e.Logger.SetOutput(os.Stderr)
@@ -693,22 +903,93 @@ func newWailsBackendApp(cfg *config.Config) *WailsBackendApp {
 	e.Use(middleware.RequestID())
 
 	// 添加限流中间件
-	e.Use(customMiddleware.RateLimit(cfg))
+	holder := config.NewHolder(cfg, nil)
+	e.Use(customMiddleware.RateLimit(holder))
 
 	// 注册路由
-	apiserver.RegisterRoutes(e, cfg)
+	drainer := apiserver.RegisterRoutes(e, holder)
 
 	return &WailsBackendApp{
-		config: cfg,
-		server: e,
+		config:          cfg,
+		server:          e,
+		metrics:         apiserver.NewMetricsServer(holder),
+		drainer:         drainer,
+		holder:          holder,
+		shutdownTracing: shutdownTracing,
 	}
 }
 
+// newConfigHolder 创建运行中服务的配置持有者，并监听配置文件变化自动重载；界面保存配置写入同一文件，同样会触发重载
+func newConfigHolder(cfg *config.Config, path string) (*config.Holder, func()) {
+	snapshot := *cfg
+	holder := config.NewHolder(&snapshot, func() (*config.Config, error) {
+		return config.LoadFile(path)
+	})
+	holder.OnChange(apiserver.ApplyConfigChange)
+	holder.OnChange(func(_, cfg *config.Config) {
+		if err := initUsageLedger(cfg); err != nil {
+			logger.Error("重载用量账本失败", zap.Error(err))
+		}
+		if err := initFileStore(cfg); err != nil {
+			logger.Error("重载文件存储失败", zap.Error(err))
+		}
+		if err := initAttachmentCache(cfg); err != nil {
+			logger.Error("重载附件缓存失败", zap.Error(err))
+		}
+	})
+
+	stopWatch := holder.Watch(path, 2*time.Second, func(err error) {
+		if err != nil {
+			logger.Warn("配置文件已变化但重载失败，继续使用原配置", zap.String("path", path), zap.Error(err))
+		}
+	})
+	return holder, stopWatch
+}
+
 // Start 启动应用
 func (a *WailsBackendApp) Start() error {
+	if a.metrics != nil {
+		go func() {
+			if err := a.metrics.Start(a.config.GetMetricsAddress()); err != nil && err != http.ErrServerClosed {
+				log.Printf("指标服务启动失败: %v", err)
+			}
+		}()
+	}
 	return a.server.Start(a.config.GetAddress())
 }
 
+// drain 优雅停机，完成后清除全局服务实例；并发调用时等待正在进行的停机完成
+func (a *WailsBackendApp) drain() {
+	a.drainOnce.Do(a.shutdown)
+}
+
+func (a *WailsBackendApp) shutdown() {
+	if a.stopWatch != nil {
+		a.stopWatch()
+	}
+	if err := a.drainer.Shutdown(a.server, a.config.Server.ShutdownGracePeriod); err != nil {
+		log.Printf("服务停止异常: %v", err)
+	}
+	if a.metrics != nil {
+		a.metrics.Close()
+	}
+	recorder.Close()
+	if a.shutdownTracing != nil {
+		// 刷新尚未导出的 span
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := a.shutdownTracing(ctx); err != nil {
+			log.Printf("关闭链路追踪失败: %v", err)
+		}
+		cancel()
+	}
+
+	wailsServerMu.Lock()
+	if wailsServerApp == a {
+		wailsServerApp = nil
+	}
+	wailsServerMu.Unlock()
+}
+
 func main() {
 	// 创建Wails应用
 	app := NewWailsApp()